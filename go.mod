@@ -5,5 +5,6 @@ go 1.14
 require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/google/uuid v1.1.1
+	github.com/tidwall/buntdb v1.1.0
 	gopkg.in/oauth2.v3 v3.12.0
 )
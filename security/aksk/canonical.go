@@ -0,0 +1,93 @@
+package aksk
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//
+// 规范请求的公共部分
+//
+// bce-signer-v1和AWS SigV4生成规范请求的步骤基本相同：对URI、QueryString、Header分别编码、排序，再拼接起来。
+// 两者都按RFC 3986编码，区别在于排序方式和拼接格式，由各自的Signer决定。
+//
+
+// 生成规范URI，对Path的每一段编码，斜杠（/）不做编码
+// 使用编码后的Path分段，避免Path中编码过的斜杠(%2F)被当成分隔符
+func canonicalURI(u *url.URL, escape func(string) string) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+type queryPair struct {
+	key   string
+	value string
+}
+
+// 对QueryString中所有的key、value编码，同一个key的多个value都参与签名
+// skip为存放签名的参数，不参与签名
+func encodeQuery(query url.Values, escape func(string) string, skip string) []queryPair {
+	pairs := make([]queryPair, 0, len(query))
+	for k, vs := range query {
+		if k == skip {
+			continue
+		}
+		for _, v := range vs {
+			pairs = append(pairs, queryPair{escape(k), escape(v)})
+		}
+	}
+	return pairs
+}
+
+// 按策略选择参与签名的Header，key为小写
+// Authorization存放签名本身，不参与签名
+func selectHeaders(header http.Header, policy HeaderPolicy) map[string][]string {
+	selected := make(map[string][]string)
+	for k, v := range header {
+		key := strings.ToLower(k)
+		if key != "authorization" && policy(key) {
+			selected[key] = append(selected[key], v...)
+		}
+	}
+	return selected
+}
+
+// 同名Header的多个值，去掉首尾空白后用逗号连接
+func joinHeaderValues(values []string) string {
+	vs := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.Trim(v, "\t "); v != "" {
+			vs = append(vs, v)
+		}
+	}
+	return strings.Join(vs, ",")
+}
+
+// RFC 3986编码，只保留非保留字符A-Z、a-z、0-9、-、_、.、~，其余字符按UTF-8字节编码为%XX
+func uriEscape(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
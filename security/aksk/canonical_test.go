@@ -0,0 +1,145 @@
+package aksk
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestURIEscape(t *testing.T) {
+	tests := map[string]string{
+		"abcXYZ019-_.~":    "abcXYZ019-_.~",
+		"a b":              "a%20b",
+		"a+b":              "a%2Bb",
+		"a/b":              "a%2Fb",
+		"测试":               "%E6%B5%8B%E8%AF%95",
+		"!*'();:@&=$,?#[]": "%21%2A%27%28%29%3B%3A%40%26%3D%24%2C%3F%23%5B%5D",
+	}
+	for in, want := range tests {
+		if got := uriEscape(in); got != want {
+			t.Errorf("uriEscape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// 百度云API 生成认证字符串 https://cloud.baidu.com/doc/Reference/s/njwvz1yfu
+func TestBceCanonicalGolden(t *testing.T) {
+	signer := NewBceSigner(testAccessKey, testSecretKey)
+
+	uris := map[string]string{
+		"":                               "/",
+		"/":                              "/",
+		"/v1/test/myfolder/readme.txt":   "/v1/test/myfolder/readme.txt",
+		"/example/测试":                    "/example/%E6%B5%8B%E8%AF%95",
+		"/a%20b/c+d/e~f":                 "/a%20b/c%2Bd/e~f",
+		"/bucket/a%2Fb":                  "/bucket/a%2Fb",
+		"/bucket/(1)/%E4%B8%AD%E6%96%87": "/bucket/%281%29/%E4%B8%AD%E6%96%87",
+	}
+	for path, want := range uris {
+		u := &url.URL{}
+		if path != "" {
+			var err error
+			if u, err = url.Parse("http://bj.bcebos.com" + path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := signer.buildCanonicalURI(u); got != want {
+			t.Errorf("uri %q: got %q, want %q", path, got, want)
+		}
+	}
+
+	queries := map[string]string{
+		"partNumber=9&uploadId=a44cc9bab11cbd156984767aad637851": "partNumber=9&uploadId=a44cc9bab11cbd156984767aad637851",
+		"acl":                               "acl=",
+		"text=a+b&key=a%20b":                "key=a%20b&text=a%20b",
+		"tag=b&tag=a&tag=c":                 "tag=a&tag=b&tag=c",
+		"prefix=%E6%B5%8B%E8%AF%95/&max=10": "max=10&prefix=%E6%B5%8B%E8%AF%95%2F",
+		"x=1&authorization=abc":             "x=1",
+	}
+	for raw, want := range queries {
+		query, _ := url.ParseQuery(raw)
+		if got := signer.buildCanonicalQueryString(query); got != want {
+			t.Errorf("query %q: got %q, want %q", raw, got, want)
+		}
+	}
+}
+
+// 百度云文档示例中的派生密钥和签名
+const (
+	bceDocSigningKey = "1d5ce5f464064cbee060330d973218821825ac6952368a482a592e6615aef479"
+	bceDocSignature  = "d74a04362e6a848f5b39b15421cb449427f419c95a480fd6b8cf9fc783e2999e"
+)
+
+// 百度云文档中的完整示例
+func TestBceCanonicalRequestGolden(t *testing.T) {
+	req, _ := http.NewRequest("PUT", "http://bj.bcebos.com/v1/test/myfolder/readme.txt?partNumber=9&uploadId=a44cc9bab11cbd156984767aad637851", nil)
+	req.Header.Set("Host", "bj.bcebos.com")
+	req.Header.Set("Date", "Mon, 27 Apr 2015 16:23:49 +0800")
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Content-Length", "8")
+	req.Header.Set("Content-Md5", "NFzcPqhviddjRNnSOGo4rw==")
+	req.Header.Set("x-bce-date", "2015-04-27T08:23:49Z")
+
+	canonicalRequest, signedHeaders := NewBceSigner(testAccessKey, testSecretKey).buildCanonicalRequest(req)
+	want := strings.Join([]string{
+		"PUT",
+		"/v1/test/myfolder/readme.txt",
+		"partNumber=9&uploadId=a44cc9bab11cbd156984767aad637851",
+		"content-length:8",
+		"content-md5:NFzcPqhviddjRNnSOGo4rw%3D%3D",
+		"content-type:text%2Fplain",
+		"host:bj.bcebos.com",
+		"x-bce-date:2015-04-27T08%3A23%3A49Z",
+	}, "\n")
+	if canonicalRequest != want {
+		t.Errorf("canonical request:\n%s\nwant:\n%s", canonicalRequest, want)
+	}
+	if signedHeaders != "content-length;content-md5;content-type;host;x-bce-date" {
+		t.Errorf("signed headers = %s", signedHeaders)
+	}
+
+	// 文档中的派生密钥和签名，校验HMAC链的最后一步
+	signer := NewBceSigner(testAccessKey, testSecretKey)
+	if got := signer.buildSignature(bceDocSigningKey, canonicalRequest); got != bceDocSignature {
+		t.Errorf("signature = %s, want %s", got, bceDocSignature)
+	}
+
+	// 文档使用bce-auth-v1前缀，这里的前缀是bce-signer-v1，派生密钥和认证字符串由独立的HMAC-SHA256实现计算
+	detail := signer.Explain(req, 1800)
+	if detail.AuthStringPrefix != "bce-signer-v1/"+testAccessKey+"/2015-04-27T08:23:49Z/1800" {
+		t.Errorf("auth string prefix = %s", detail.AuthStringPrefix)
+	}
+	if detail.SigningKey != "c23254f869be5e6f3b8822ef89c514dc7ba3b307fd28f65e2d99e6f1a1988a8e" {
+		t.Errorf("signing key = %s", detail.SigningKey)
+	}
+	want = detail.AuthStringPrefix + "/content-length;content-md5;content-type;host;x-bce-date/aa1f60fce2d6c5813fdd9ad77484712ec7df819d16cd1931cd7e95629cb775cd"
+	if detail.AuthString != want {
+		t.Errorf("auth string = %s, want %s", detail.AuthString, want)
+	}
+}
+
+// 含空格、非ASCII字符、重复参数的请求，签名后能通过校验，篡改任意一个值都会失败
+func TestVerifyUnicodeAndMultiValue(t *testing.T) {
+	newRequest := func() *http.Request {
+		req, _ := http.NewRequest("GET", "http://bj.bcebos.com/bucket/%E6%B5%8B%E8%AF%95%20file.txt?tag=a&tag=b&q=hello+world", nil)
+		req.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+		req.Header.Set("x-bce-meta-name", "张三 ")
+		NewBceSigner(testAccessKey, testSecretKey).Sign(req, 1800)
+		return req
+	}
+	if _, err := newTestVerifier().Verify(newRequest()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := newRequest()
+	req.URL.RawQuery = "tag=a&tag=c&q=hello+world"
+	if _, err := newTestVerifier().Verify(req); err != ErrSignatureMismatch {
+		t.Errorf("second value tampered: err = %v", err)
+	}
+	req = newRequest()
+	req.Header.Set("x-bce-meta-name", "李四")
+	if _, err := newTestVerifier().Verify(req); err != ErrSignatureMismatch {
+		t.Errorf("unicode header tampered: err = %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"paradigm/security/aksk"
+)
+
+//
+// AK/SK签名调试工具
+//
+// 签名：按curl的习惯构造请求，输出规范请求、signedHeaders、派生密钥前缀和认证字符串
+//   aksk sign -ak AK -sk SK -X PUT -H "Content-Type: text/plain" -d @readme.txt http://bj.bcebos.com/v1/test/readme.txt
+// 解析：查看认证字符串中的AK、时间、有效期和signedHeaders
+//   aksk inspect "bce-signer-v1/..."
+// 对比：逐行对比Server端记录的规范请求(Verifier.OnSignatureMismatch)和Client端的规范请求，"-"表示标准输入
+//   aksk diff server.txt client.txt
+//
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "sign":
+		err = sign(os.Args[2:], os.Stdout)
+	case "inspect":
+		err = inspect(os.Args[2:], os.Stdout)
+	case "diff":
+		var same bool
+		same, err = diff(os.Args[2:], os.Stdout)
+		if err == nil && !same {
+			os.Exit(1)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  aksk sign -ak AK -sk SK [-X method] [-H "Key: Value"]... [-d data|@file] [-date 2006-01-02T15:04:05Z] [-exp seconds] [-token sessionToken] [-headers default|all|h1,h2] URL
+  aksk inspect AUTH_STRING
+  aksk diff SERVER_FILE CLIENT_FILE`)
+}
+
+// 可重复的-H参数
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("invalid header %q, want \"Key: Value\"", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+func sign(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("sign", flag.ContinueOnError)
+	accessKey := fs.String("ak", os.Getenv("AKSK_ACCESS_KEY"), "access key, defaults to $AKSK_ACCESS_KEY")
+	secretKey := fs.String("sk", os.Getenv("AKSK_SECRET_KEY"), "secret key, defaults to $AKSK_SECRET_KEY")
+	method := fs.String("X", "GET", "request method")
+	data := fs.String("d", "", "request body, @file reads from file")
+	date := fs.String("date", "", "x-bce-date, defaults to now")
+	exp := fs.Int("exp", 1800, "expiration period in seconds")
+	token := fs.String("token", "", "STS session token")
+	headers := fs.String("headers", "default", "signed headers: default, all, or comma separated names")
+	var header headerFlags
+	fs.Var(&header, "H", "request header, can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *accessKey == "" || *secretKey == "" {
+		return errors.New("sign: need -ak, -sk and exactly one URL")
+	}
+
+	request, err := newRequest(*method, fs.Arg(0), header, *data)
+	if err != nil {
+		return err
+	}
+	signer := aksk.NewSessionBceSigner(*accessKey, *secretKey, *token)
+	switch *headers {
+	case "default":
+	case "all":
+		signer.HeaderPolicy = aksk.SignAllHeaders
+	default:
+		signer.HeaderPolicy = aksk.HeaderList(strings.Split(*headers, ",")...)
+	}
+	if *date == "" {
+		signer.SetDate(request, time.Now())
+	} else if _, err := time.Parse(aksk.BceDateFormat, *date); err != nil {
+		return fmt.Errorf("invalid -date %q: %v", *date, err)
+	} else {
+		request.Header.Set("x-bce-date", *date)
+	}
+	if *token != "" {
+		request.Header.Set(aksk.SecurityTokenHeader, *token)
+	}
+
+	detail := signer.Explain(request, *exp)
+	fmt.Fprintf(w, "== canonical request ==\n%s\n\n", detail.CanonicalRequest)
+	fmt.Fprintf(w, "== signed headers ==\n%s\n\n", detail.SignedHeaders)
+	fmt.Fprintf(w, "== auth string prefix ==\n%s\n\n", detail.AuthStringPrefix)
+	// 派生密钥在有效期内可以代替SK签名，只输出前缀用于核对
+	fmt.Fprintf(w, "== signing key ==\n%s...\n\n", detail.SigningKey[:8])
+	fmt.Fprintf(w, "== authorization ==\n%s\n", detail.AuthString)
+	return nil
+}
+
+// 构造请求，Host和Content-Length按实际发送时的值写入Header，以便参与签名
+func newRequest(method string, rawURL string, header []string, data string) (*http.Request, error) {
+	var body []byte
+	if strings.HasPrefix(data, "@") {
+		b, err := ioutil.ReadFile(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	} else {
+		body = []byte(data)
+	}
+	request, err := http.NewRequest(strings.ToUpper(method), rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if request.URL.Host == "" {
+		return nil, fmt.Errorf("url %q has no host", rawURL)
+	}
+	request.Header.Set("Host", request.URL.Host)
+	if len(body) > 0 {
+		request.Header.Set("Content-Length", fmt.Sprint(len(body)))
+	}
+	for _, h := range header {
+		kv := strings.SplitN(h, ":", 2)
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if strings.EqualFold(key, "Host") {
+			request.Header.Set(key, value)
+			continue
+		}
+		request.Header.Add(key, value)
+	}
+	return request, nil
+}
+
+func inspect(args []string, w io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("inspect: need exactly one auth string")
+	}
+	auth, err := aksk.ParseAuthString(strings.TrimSpace(args[0]))
+	if err != nil {
+		return err
+	}
+	expireAt := auth.Timestamp.Add(time.Duration(auth.ExpirationPeriodInSeconds) * time.Second)
+	fmt.Fprintf(w, "access key:     %s\n", auth.AccessKey)
+	fmt.Fprintf(w, "timestamp:      %s\n", auth.Timestamp.Format(aksk.BceDateFormat))
+	fmt.Fprintf(w, "expiration:     %ds (until %s)\n", auth.ExpirationPeriodInSeconds, expireAt.Format(aksk.BceDateFormat))
+	fmt.Fprintf(w, "signed headers: %s\n", strings.Join(auth.SignedHeaders, ";"))
+	fmt.Fprintf(w, "signature:      %s\n", auth.Signature)
+	if now := time.Now(); now.After(expireAt) {
+		fmt.Fprintf(w, "status:         expired %s ago\n", now.Sub(expireAt).Round(time.Second))
+	} else if auth.Timestamp.After(now) {
+		fmt.Fprintf(w, "status:         timestamp is %s in the future\n", auth.Timestamp.Sub(now).Round(time.Second))
+	} else {
+		fmt.Fprintf(w, "status:         valid for %s\n", expireAt.Sub(now).Round(time.Second))
+	}
+	return nil
+}
+
+func diff(args []string, w io.Writer) (bool, error) {
+	if len(args) != 2 {
+		return false, errors.New("diff: need SERVER_FILE and CLIENT_FILE")
+	}
+	server, err := readLines(args[0])
+	if err != nil {
+		return false, err
+	}
+	client, err := readLines(args[1])
+	if err != nil {
+		return false, err
+	}
+	return writeDiff(w, server, client), nil
+}
+
+func readLines(name string) ([]string, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(strings.Replace(string(data), "\r\n", "\n", -1), "\n"), "\n"), nil
+}
+
+// 规范请求的前三行是Method、URI、QueryString，之后是Header
+var sections = []string{"method", "uri", "query"}
+
+func section(i int) string {
+	if i < len(sections) {
+		return sections[i]
+	}
+	return "header"
+}
+
+// 按最长公共子序列逐行对比，"-"为只在Server端出现的行，"+"为只在Client端出现的行
+// 规范请求只有几十行，直接用动态规划
+func writeDiff(w io.Writer, server []string, client []string) bool {
+	n, m := len(server), len(client)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if server[i] == client[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	same := true
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && server[i] == client[j]:
+			fmt.Fprintf(w, "  %-7s %s\n", section(i), server[i])
+			i++
+			j++
+		case j == m || i < n && lcs[i+1][j] >= lcs[i][j+1]:
+			fmt.Fprintf(w, "- %-7s %s\n", section(i), server[i])
+			same = false
+			i++
+		default:
+			fmt.Fprintf(w, "+ %-7s %s\n", section(j), client[j])
+			same = false
+			j++
+		}
+	}
+	if same {
+		fmt.Fprintln(w, "canonical requests are identical")
+	}
+	return same
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"paradigm/security/aksk"
+)
+
+func TestSign(t *testing.T) {
+	var out bytes.Buffer
+	err := sign([]string{
+		"-ak", "ak", "-sk", "sk", "-X", "put", "-date", "2015-04-27T08:23:49Z",
+		"-H", "Content-Type: text/plain", "-H", "Content-MD5: NFzcPqhviddjRNnSOGo4rw==", "-d", "readme!!",
+		"http://bj.bcebos.com/v1/test/myfolder/readme.txt?partNumber=9&uploadId=a44cc9bab11cbd156984767aad637851",
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"PUT",
+		"/v1/test/myfolder/readme.txt",
+		"partNumber=9&uploadId=a44cc9bab11cbd156984767aad637851",
+		"content-length:8",
+		"content-md5:NFzcPqhviddjRNnSOGo4rw%3D%3D",
+		"content-type:text%2Fplain",
+		"host:bj.bcebos.com",
+		"x-bce-date:2015-04-27T08%3A23%3A49Z",
+	}, "\n")
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("canonical request not found in:\n%s", out.String())
+	}
+
+	// 与BceSigner.Sign的结果一致
+	req, _ := http.NewRequest("PUT", "http://bj.bcebos.com/v1/test/myfolder/readme.txt?partNumber=9&uploadId=a44cc9bab11cbd156984767aad637851", nil)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Content-MD5", "NFzcPqhviddjRNnSOGo4rw==")
+	req.Header.Set("Content-Length", "8")
+	req.Header.Set("x-bce-date", "2015-04-27T08:23:49Z")
+	aksk.NewBceSigner("ak", "sk").Sign(req, 1800)
+	if !strings.Contains(out.String(), "== authorization ==\n"+req.Header.Get("Authorization")+"\n") {
+		t.Errorf("authorization %q not found in:\n%s", req.Header.Get("Authorization"), out.String())
+	}
+
+	if err := sign([]string{"-ak", "ak", "http://bj.bcebos.com/"}, &out); err == nil {
+		t.Error("missing sk accepted")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	var out bytes.Buffer
+	if err := inspect([]string{"bce-signer-v1/ak/2015-04-27T08:23:49Z/1800/host;x-bce-date/abc"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"access key:     ak", "until 2015-04-27T08:53:49Z", "signed headers: host;x-bce-date", "status:         expired"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("%q not found in:\n%s", want, out.String())
+		}
+	}
+	if err := inspect([]string{"bce-auth-v1/ak"}, &out); err != aksk.ErrMalformedAuthString {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aksk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := filepath.Join(dir, "server.txt")
+	client := filepath.Join(dir, "client.txt")
+	ioutil.WriteFile(server, []byte("GET\n/a\n\ncontent-type:text%2Fplain%3Bcharset%3Dutf-8\nhost:example.com\n"), 0600)
+	ioutil.WriteFile(client, []byte("GET\n/a\n\ncontent-type:text%2Fplain\nhost:example.com\n"), 0600)
+
+	var out bytes.Buffer
+	same, err := diff([]string{server, client}, &out)
+	if err != nil || same {
+		t.Fatalf("same = %v, err = %v", same, err)
+	}
+	want := "  method  GET\n" +
+		"  uri     /a\n" +
+		"  query   \n" +
+		"- header  content-type:text%2Fplain%3Bcharset%3Dutf-8\n" +
+		"+ header  content-type:text%2Fplain\n" +
+		"  header  host:example.com\n"
+	if out.String() != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if same, _ := diff([]string{client, client}, &out); !same || !strings.Contains(out.String(), "identical") {
+		t.Errorf("same = %v, out = %s", same, out.String())
+	}
+}
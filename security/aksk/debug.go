@@ -0,0 +1,38 @@
+package aksk
+
+import (
+	"fmt"
+	"net/http"
+)
+
+//
+// 签名调试
+//
+// 签名不一致时，只能通过对比Client和Server两边的规范请求找到原因，常见的有：
+// 1)代理修改或去掉了参与签名的Header，例如Content-Type被加上了charset
+// 2)URI、QueryString的编码方式不一致，例如空格编码成了+
+// 3)Client和Server的时间、有效期不一致
+// Client使用Explain得到签名的中间结果，Server通过Verifier.OnSignatureMismatch记录自己生成的规范请求，两者逐行对比即可。
+// 规范请求不包含SK，可以写入日志；派生密钥可以在有效期内代替SK签名，不要完整输出。
+//
+
+// 签名过程的中间结果
+type SigningDetail struct {
+	CanonicalRequest string
+	SignedHeaders    string
+	AuthStringPrefix string // bce-signer-v1/{accessKeyId}/{timestamp}/{expirationPeriodInSeconds}
+	SigningKey       string // 派生密钥
+	Signature        string
+	AuthString       string
+}
+
+// 按与Sign相同的步骤计算签名，返回中间结果，不修改请求
+// 请求中需要已经设置Host和x-bce-date
+func (signer *BceSigner) Explain(request *http.Request, expirationPeriodInSeconds int) *SigningDetail {
+	detail := &SigningDetail{}
+	detail.AuthStringPrefix, detail.SigningKey = signer.buildSigningKey(request.Header.Get("x-bce-date"), expirationPeriodInSeconds)
+	detail.CanonicalRequest, detail.SignedHeaders = signer.buildCanonicalRequest(request)
+	detail.Signature = signer.buildSignature(detail.SigningKey, detail.CanonicalRequest)
+	detail.AuthString = fmt.Sprintf("%s/%s/%s", detail.AuthStringPrefix, detail.SignedHeaders, detail.Signature)
+	return detail
+}
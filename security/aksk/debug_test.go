@@ -0,0 +1,42 @@
+package aksk
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Server端记录的规范请求与Client端Explain的结果对比，找出被代理修改的Header
+func TestExplainAndSignatureMismatch(t *testing.T) {
+	req := newSignedRequest(t, testNow, 1800)
+	detail := NewBceSigner(testAccessKey, testSecretKey).Explain(req, 1800)
+	if detail.AuthString != req.Header.Get("Authorization") {
+		t.Fatalf("explain = %q, sign = %q", detail.AuthString, req.Header.Get("Authorization"))
+	}
+	if detail.SignedHeaders != "content-type;host;x-bce-date" {
+		t.Errorf("signed headers = %q", detail.SignedHeaders)
+	}
+
+	var serverCanonicalRequest string
+	verifier := newTestVerifier()
+	verifier.OnSignatureMismatch = func(_ *http.Request, _ *AuthString, canonicalRequest string) {
+		serverCanonicalRequest = canonicalRequest
+	}
+	if _, err := verifier.Verify(req); err != nil {
+		t.Fatal(err)
+	}
+	if serverCanonicalRequest != "" {
+		t.Error("callback called on success")
+	}
+
+	req.Header.Set("Content-Type", "text/plain;charset=utf-8")
+	if _, err := verifier.Verify(req); err != ErrSignatureMismatch {
+		t.Fatalf("err = %v", err)
+	}
+	want := "GET\n/bucket/object\nacl=&max=10\ncontent-type:text%2Fplain%3Bcharset%3Dutf-8\nhost:bj.bcebos.com\nx-bce-date:2020-05-01T12%3A00%3A00Z"
+	if serverCanonicalRequest != want {
+		t.Errorf("server canonical request:\n%s\nwant:\n%s", serverCanonicalRequest, want)
+	}
+	if serverCanonicalRequest == detail.CanonicalRequest {
+		t.Error("canonical requests should differ")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"paradigm/security/aksk"
+)
+
+func main() {
+	// 准备 url 和 request
+	urlStr := "https://jowin-dev.bj.bcebos.com/meiyou"
+	req, _ := http.NewRequest("GET", urlStr, nil)
+
+	// SigningTransport自动设置x-bce-date，添加鉴权信息
+	signer := aksk.NewBceSigner("00862f7e445143478fa2b1483874d365", "31dab24594ca410d9ecd3d65874938cb")
+
+	// 生成预签名URL，可以直接分享给用户，有效期1小时
+	presignedURL, err := signer.PresignURL("GET", urlStr, 3600)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("presigned url: %s\n", presignedURL)
+
+	// S3兼容的存储使用SigV4，例如本地的MinIO
+	var s3Signer aksk.Signer = aksk.NewSigV4Signer("minioadmin", "minioadmin", "us-east-1", "s3")
+	s3URL, err := s3Signer.PresignURL("GET", "http://localhost:9000/bucket/meiyou", 3600)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("s3 presigned url: %s\n", s3URL)
+
+	// 请求Object
+	client := &http.Client{Transport: aksk.NewSigningTransport(signer, 1800)}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if resp.StatusCode != 200 {
+		fmt.Printf("get object failed, resp_code:%d\n", resp.StatusCode)
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	fmt.Printf("resp:\n%s\n", string(body))
+
+	return
+}
@@ -0,0 +1,65 @@
+package aksk
+
+import (
+	"strings"
+)
+
+// 签名Header的选择策略
+//
+// 计算签名时，如果选择的Header太少，则可能遭到中间人攻击；选择的Header太多，经过代理时又可能被修改，导致签名失败。
+// HeaderPolicy决定哪些Header参与签名，key为小写的Header名称。
+// Server端不需要知道Client使用的策略，按认证字符串中的signedHeaders校验即可。
+type HeaderPolicy func(key string) bool
+
+// 百度云API建议的默认策略：Host、Content-Length、Content-Type、Content-MD5、所有以x-bce-开头的Header
+func DefaultHeaderPolicy(key string) bool {
+	return key == "host" ||
+		key == "content-length" ||
+		key == "content-type" ||
+		key == "content-md5" ||
+		strings.HasPrefix(key, "x-bce-")
+}
+
+// 对所有Header签名
+func SignAllHeaders(key string) bool {
+	return true
+}
+
+// 对指定的Header签名
+func HeaderList(keys ...string) HeaderPolicy {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[strings.ToLower(k)] = true
+	}
+	return func(key string) bool {
+		return set[key]
+	}
+}
+
+// 对指定前缀的Header签名
+func HeaderPrefix(prefixes ...string) HeaderPolicy {
+	lower := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		lower[i] = strings.ToLower(prefix)
+	}
+	return func(key string) bool {
+		for _, prefix := range lower {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// 组合多个策略，满足任意一个即签名
+func AnyHeader(policies ...HeaderPolicy) HeaderPolicy {
+	return func(key string) bool {
+		for _, policy := range policies {
+			if policy(key) {
+				return true
+			}
+		}
+		return false
+	}
+}
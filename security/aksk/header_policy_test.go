@@ -0,0 +1,67 @@
+package aksk
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHeaderPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy HeaderPolicy
+		want   string
+	}{
+		{"default", nil, "content-type;host;x-bce-date;x-bce-meta-a"},
+		{"list", HeaderList("Host", "User-Agent"), "host;user-agent"},
+		{"prefix", AnyHeader(HeaderList("host"), HeaderPrefix("X-Bce-Meta-")), "host;x-bce-meta-a"},
+		{"all", SignAllHeaders, "content-type;host;user-agent;x-bce-date;x-bce-meta-a"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("PUT", "http://bj.bcebos.com/bucket/object", nil)
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set("User-Agent", "aksk-test")
+		req.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+		req.Header.Set("x-bce-meta-a", "1")
+		signer := NewBceSigner(testAccessKey, testSecretKey)
+		signer.HeaderPolicy = tt.policy
+		signer.Sign(req, 1800)
+
+		auth, err := newTestVerifier().Verify(req)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := strings.Join(auth.SignedHeaders, ";"); got != tt.want {
+			t.Errorf("%s: signed headers = %q, want %q", tt.name, got, tt.want)
+		}
+
+		// 篡改签名的Header
+		req.Header.Set(auth.SignedHeaders[len(auth.SignedHeaders)-1], "tampered")
+		if _, err := newTestVerifier().Verify(req); err != ErrSignatureMismatch {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, ErrSignatureMismatch)
+		}
+	}
+}
+
+func TestRequiredSignedHeaders(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://bj.bcebos.com/bucket/object", nil)
+	req.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+	signer := NewBceSigner(testAccessKey, testSecretKey)
+	signer.HeaderPolicy = HeaderList("x-bce-date")
+	signer.Sign(req, 1800)
+	if _, err := newTestVerifier().Verify(req); err != ErrHeaderNotSigned {
+		t.Fatalf("err = %v, want %v", err, ErrHeaderNotSigned)
+	}
+}
+
+func TestHeaderPrefixCopiesArgs(t *testing.T) {
+	prefixes := []string{"X-Bce-Meta-"}
+	policy := HeaderPrefix(prefixes...)
+	if prefixes[0] != "X-Bce-Meta-" {
+		t.Errorf("prefixes modified: %v", prefixes)
+	}
+	if !policy("x-bce-meta-a") {
+		t.Error("prefix not matched")
+	}
+}
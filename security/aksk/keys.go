@@ -0,0 +1,338 @@
+package aksk
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//
+// AK/SK生命周期管理
+//
+// KeyManager负责生成、保存、轮换AK/SK，同时实现CredentialStore，供Verifier查找SK：
+// 1)AK/SK使用crypto/rand生成，SK只在创建时返回一次，之后无法再查看
+// 2)HMAC签名需要SK原文，所以SK不能像密码一样保存摘要，这里使用主密钥(AES-256-GCM)加密后保存在文件中，AK作为附加数据，
+//   加密后的SK不能挪到其他AK下使用；主密钥应该来自环境变量或KMS，不要和密钥文件放在一起
+// 3)每个Principal最多两个AK，轮换时先创建新AK，Client切换后禁用旧AK，确认没有调用后再删除，整个过程不需要停机
+// 4)禁用的AK校验失败，可以重新启用；删除后不能恢复
+// 5)记录每个AK最后一次校验通过的时间，用于发现长期不用的AK；为了避免每个请求都写文件，同一个AK一分钟内最多写一次
+//
+// 参考 AWS IAM 轮换访问密钥 https://docs.aws.amazon.com/IAM/latest/UserGuide/id_credentials_access-keys.html#Using_RotateAccessKey
+//
+
+var (
+	ErrKeyNotFound       = errors.New("aksk: access key not found")
+	ErrTooManyKeys       = errors.New("aksk: too many access keys for principal")
+	ErrInvalidMasterKey  = errors.New("aksk: master key must be 32 bytes")
+	ErrKeyFileCorrupted  = errors.New("aksk: key file corrupted")
+	ErrPrincipalRequired = errors.New("aksk: principal required")
+)
+
+const (
+	MaxKeysPerPrincipal = 2
+
+	KeyStatusActive   = "Active"
+	KeyStatusDisabled = "Disabled"
+
+	lastUsedFlushInterval = time.Minute
+)
+
+// AK的元信息，不包含SK
+type KeyMetadata struct {
+	AccessKey    string    `json:"accessKey"`
+	Principal    string    `json:"principal"` // AK所属的用户或服务
+	Status       string    `json:"status"`    // Active或Disabled
+	CreateTime   time.Time `json:"createTime"`
+	LastUsedTime time.Time `json:"lastUsedTime,omitempty"` // 最后一次校验通过的时间，从未使用时为零值
+}
+
+// 保存在文件中的AK，SK为加密后的密文
+type storedKey struct {
+	KeyMetadata
+	EncryptedSecret string `json:"encryptedSecret"`
+}
+
+// 校验通过后记录AK的使用情况，CredentialStore实现该接口时由Verifier调用
+type UsageRecorder interface {
+	RecordUsage(accessKey string, t time.Time)
+}
+
+// 基于文件的AK/SK管理，实现CredentialStore
+type KeyManager struct {
+	sync.RWMutex
+	path      string
+	aead      cipher.AEAD
+	keys      map[string]*storedKey
+	lastFlush map[string]time.Time
+	now       func() time.Time
+}
+
+var (
+	_ CredentialStore = (*KeyManager)(nil)
+	_ UsageRecorder   = (*KeyManager)(nil)
+)
+
+// 加载密钥文件，文件不存在时在第一次写入时创建
+// masterKey为32字节的AES-256密钥
+func NewKeyManager(path string, masterKey []byte) (*KeyManager, error) {
+	if len(masterKey) != 32 {
+		return nil, ErrInvalidMasterKey
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	manager := &KeyManager{
+		path:      path,
+		aead:      aead,
+		keys:      make(map[string]*storedKey),
+		lastFlush: make(map[string]time.Time),
+		now:       time.Now,
+	}
+	if err := manager.load(); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// 为principal生成一对新的AK/SK，SK只在这里返回一次
+func (manager *KeyManager) Create(principal string) (*KeyMetadata, string, error) {
+	if principal == "" {
+		return nil, "", ErrPrincipalRequired
+	}
+	manager.Lock()
+	defer manager.Unlock()
+	count := 0
+	for _, key := range manager.keys {
+		if key.Principal == principal {
+			count++
+		}
+	}
+	if count >= MaxKeysPerPrincipal {
+		return nil, "", ErrTooManyKeys
+	}
+
+	accessKey, secretKey := randomHex(16), randomHex(16)
+	encrypted, err := manager.encrypt(accessKey, secretKey)
+	if err != nil {
+		return nil, "", err
+	}
+	key := &storedKey{
+		KeyMetadata: KeyMetadata{
+			AccessKey:  accessKey,
+			Principal:  principal,
+			Status:     KeyStatusActive,
+			CreateTime: manager.now().UTC(),
+		},
+		EncryptedSecret: encrypted,
+	}
+	manager.keys[accessKey] = key
+	if err := manager.save(); err != nil {
+		delete(manager.keys, accessKey)
+		return nil, "", err
+	}
+	info := key.KeyMetadata
+	return &info, secretKey, nil
+}
+
+// 查看AK的元信息
+func (manager *KeyManager) Get(accessKey string) (*KeyMetadata, error) {
+	manager.RLock()
+	defer manager.RUnlock()
+	key, ok := manager.keys[accessKey]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	info := key.KeyMetadata
+	return &info, nil
+}
+
+// 列出principal的所有AK，按创建时间排序；principal为空时列出所有AK
+func (manager *KeyManager) List(principal string) []KeyMetadata {
+	manager.RLock()
+	defer manager.RUnlock()
+	keys := make([]KeyMetadata, 0)
+	for _, key := range manager.keys {
+		if principal == "" || key.Principal == principal {
+			keys = append(keys, key.KeyMetadata)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreateTime.Equal(keys[j].CreateTime) {
+			return keys[i].CreateTime.Before(keys[j].CreateTime)
+		}
+		return keys[i].AccessKey < keys[j].AccessKey
+	})
+	return keys
+}
+
+// 禁用AK，禁用后使用该AK的请求校验失败
+func (manager *KeyManager) Disable(accessKey string) error {
+	return manager.setStatus(accessKey, KeyStatusDisabled)
+}
+
+// 重新启用AK
+func (manager *KeyManager) Enable(accessKey string) error {
+	return manager.setStatus(accessKey, KeyStatusActive)
+}
+
+func (manager *KeyManager) setStatus(accessKey string, status string) error {
+	manager.Lock()
+	defer manager.Unlock()
+	key, ok := manager.keys[accessKey]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if key.Status == status {
+		return nil
+	}
+	old := key.Status
+	key.Status = status
+	if err := manager.save(); err != nil {
+		key.Status = old
+		return err
+	}
+	return nil
+}
+
+// 删除AK，不能恢复
+func (manager *KeyManager) Delete(accessKey string) error {
+	manager.Lock()
+	defer manager.Unlock()
+	key, ok := manager.keys[accessKey]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	delete(manager.keys, accessKey)
+	if err := manager.save(); err != nil {
+		manager.keys[accessKey] = key
+		return err
+	}
+	delete(manager.lastFlush, accessKey)
+	return nil
+}
+
+// 实现CredentialStore，AK不存在或已禁用时返回ErrInvalidAccessKey
+func (manager *KeyManager) GetSecretKey(accessKey string) (string, error) {
+	manager.RLock()
+	key, ok := manager.keys[accessKey]
+	if !ok || key.Status != KeyStatusActive {
+		manager.RUnlock()
+		return "", ErrInvalidAccessKey
+	}
+	encrypted := key.EncryptedSecret
+	manager.RUnlock()
+	return manager.decrypt(accessKey, encrypted)
+}
+
+// 实现UsageRecorder，记录最后使用时间
+func (manager *KeyManager) RecordUsage(accessKey string, t time.Time) {
+	manager.Lock()
+	defer manager.Unlock()
+	key, ok := manager.keys[accessKey]
+	if !ok || t.Before(key.LastUsedTime) {
+		return
+	}
+	key.LastUsedTime = t.UTC()
+	if t.Sub(manager.lastFlush[accessKey]) < lastUsedFlushInterval {
+		return
+	}
+	// 写文件失败不影响请求，下次使用时再写
+	if err := manager.save(); err == nil {
+		manager.lastFlush[accessKey] = t
+	}
+}
+
+// 加密SK，格式为base64(nonce + 密文)
+func (manager *KeyManager) encrypt(accessKey string, secretKey string) (string, error) {
+	nonce := make([]byte, manager.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := manager.aead.Seal(nonce, nonce, []byte(secretKey), []byte(accessKey))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (manager *KeyManager) decrypt(accessKey string, encrypted string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < manager.aead.NonceSize() {
+		return "", ErrKeyFileCorrupted
+	}
+	nonceSize := manager.aead.NonceSize()
+	secretKey, err := manager.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(accessKey))
+	if err != nil {
+		return "", ErrKeyFileCorrupted
+	}
+	return string(secretKey), nil
+}
+
+type keyFile struct {
+	Keys []*storedKey `json:"keys"`
+}
+
+func (manager *KeyManager) load() error {
+	data, err := ioutil.ReadFile(manager.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return ErrKeyFileCorrupted
+	}
+	for _, key := range file.Keys {
+		// 主密钥不对时尽早失败，而不是等到校验请求时
+		if _, err := manager.decrypt(key.AccessKey, key.EncryptedSecret); err != nil {
+			return err
+		}
+		manager.keys[key.AccessKey] = key
+	}
+	return nil
+}
+
+// 先写临时文件再rename，避免写到一半时进程退出导致文件损坏；调用方需要持有写锁
+func (manager *KeyManager) save() error {
+	file := keyFile{Keys: make([]*storedKey, 0, len(manager.keys))}
+	for _, key := range manager.keys {
+		file.Keys = append(file.Keys, key)
+	}
+	sort.Slice(file.Keys, func(i, j int) bool {
+		return file.Keys[i].AccessKey < file.Keys[j].AccessKey
+	})
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(manager.path), filepath.Base(manager.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), manager.path)
+}
@@ -0,0 +1,155 @@
+package aksk
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+//
+// AK/SK管理接口
+//
+// 需要挂在Verifier.Middleware之后，并使用http.StripPrefix去掉路由前缀：
+//
+//	GET    /?principal=xxx    列出AK，不带principal时列出所有AK
+//	POST   /                  创建AK，Body: {"principal": "xxx"}，SK只在响应中出现一次
+//	GET    /{ak}              查看AK
+//	POST   /{ak}/disable      禁用AK
+//	POST   /{ak}/enable       启用AK
+//	DELETE /{ak}              删除AK
+//
+// Admins中的Principal可以管理所有AK，其他Principal只能管理自己的AK，用于自助轮换；临时凭证不能调用。
+//
+
+type KeyAdmin struct {
+	Keys   *KeyManager
+	Admins []string // 管理员的Principal
+}
+
+func NewKeyAdmin(keys *KeyManager, admins ...string) *KeyAdmin {
+	return &KeyAdmin{
+		Keys:   keys,
+		Admins: admins,
+	}
+}
+
+// 创建AK的响应，包含SK
+type createKeyResponse struct {
+	KeyMetadata
+	SecretAccessKey string `json:"secretAccessKey"`
+}
+
+func (admin *KeyAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caller, ok := admin.caller(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		principal := r.URL.Query().Get("principal")
+		if !admin.allowed(caller, principal) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		writeJSON(w, http.StatusOK, admin.Keys.List(principal))
+	case parts[0] == "" && r.Method == http.MethodPost:
+		var body struct {
+			Principal string `json:"principal"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Principal == "" {
+			http.Error(w, "invalid principal", http.StatusBadRequest)
+			return
+		}
+		if !admin.allowed(caller, body.Principal) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		key, secretKey, err := admin.Keys.Create(body.Principal)
+		if err != nil {
+			admin.writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, createKeyResponse{*key, secretKey})
+	case parts[0] != "" && len(parts) <= 2:
+		key, err := admin.Keys.Get(parts[0])
+		// AK不存在和无权访问都返回404，不暴露其他Principal的AK
+		if err == ErrKeyNotFound || err == nil && !admin.allowed(caller, key.Principal) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			admin.writeError(w, err)
+			return
+		}
+		admin.serveKey(w, r, key, parts[1:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// 单个AK的操作
+func (admin *KeyAdmin) serveKey(w http.ResponseWriter, r *http.Request, key *KeyMetadata, action []string) {
+	var err error
+	switch {
+	case len(action) == 0 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, key)
+		return
+	case len(action) == 0 && r.Method == http.MethodDelete:
+		err = admin.Keys.Delete(key.AccessKey)
+	case len(action) == 1 && action[0] == "disable" && r.Method == http.MethodPost:
+		err = admin.Keys.Disable(key.AccessKey)
+	case len(action) == 1 && action[0] == "enable" && r.Method == http.MethodPost:
+		err = admin.Keys.Enable(key.AccessKey)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		admin.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 调用方的Principal，只接受KeyManager中的长期AK
+func (admin *KeyAdmin) caller(r *http.Request) (string, bool) {
+	auth, ok := AuthStringFromContext(r.Context())
+	if !ok || auth.Session != nil {
+		return "", false
+	}
+	key, err := admin.Keys.Get(auth.AccessKey)
+	if err != nil {
+		return "", false
+	}
+	return key.Principal, true
+}
+
+// 管理员可以管理所有AK，其他Principal只能管理自己的AK
+func (admin *KeyAdmin) allowed(caller string, principal string) bool {
+	for _, p := range admin.Admins {
+		if p == caller {
+			return true
+		}
+	}
+	return principal != "" && principal == caller
+}
+
+func (admin *KeyAdmin) writeError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrKeyNotFound:
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case ErrTooManyKeys:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,95 @@
+package aksk
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testKeyAdminServer struct {
+	*httptest.Server
+	manager *KeyManager
+}
+
+func newTestKeyAdminServer(t *testing.T) *testKeyAdminServer {
+	manager, _ := newTestKeyManager(t)
+	verifier := NewVerifier(manager)
+	verifier.Now = func() time.Time { return testNow }
+	mux := http.NewServeMux()
+	mux.Handle("/keys/", verifier.Middleware(http.StripPrefix("/keys", NewKeyAdmin(manager, "root"))))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return &testKeyAdminServer{server, manager}
+}
+
+func (server *testKeyAdminServer) do(t *testing.T, accessKey string, secretKey string, method string, path string, body string) *http.Response {
+	req, _ := http.NewRequest(method, server.URL+"/keys"+path, strings.NewReader(body))
+	req.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+	NewBceSigner(accessKey, secretKey).Sign(req, 1800)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestKeyAdmin(t *testing.T) {
+	server := newTestKeyAdminServer(t)
+	root, rootSecret, _ := server.manager.Create("root")
+
+	// 管理员为alice创建AK
+	resp := server.do(t, root.AccessKey, rootSecret, "POST", "/", `{"principal":"alice"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: status = %d", resp.StatusCode)
+	}
+	var created createKeyResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	if created.Principal != "alice" || created.SecretAccessKey == "" {
+		t.Fatalf("created = %+v", created)
+	}
+
+	// alice自助轮换
+	resp = server.do(t, created.AccessKey, created.SecretAccessKey, "POST", "/", `{"principal":"alice"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("self create: status = %d", resp.StatusCode)
+	}
+	resp = server.do(t, created.AccessKey, created.SecretAccessKey, "POST", "/", `{"principal":"alice"}`)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("third key: status = %d", resp.StatusCode)
+	}
+	resp = server.do(t, created.AccessKey, created.SecretAccessKey, "GET", "/?principal=alice", "")
+	var keys []KeyMetadata
+	json.NewDecoder(resp.Body).Decode(&keys)
+	if len(keys) != 2 {
+		t.Errorf("list = %+v", keys)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		t.Errorf("content type = %s", resp.Header.Get("Content-Type"))
+	}
+
+	// alice不能管理其他Principal的AK
+	if resp := server.do(t, created.AccessKey, created.SecretAccessKey, "GET", "/?principal=root", ""); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("list other: status = %d", resp.StatusCode)
+	}
+	if resp := server.do(t, created.AccessKey, created.SecretAccessKey, "POST", "/"+root.AccessKey+"/disable", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("disable other: status = %d", resp.StatusCode)
+	}
+
+	// 管理员禁用、删除alice的AK
+	if resp := server.do(t, root.AccessKey, rootSecret, "POST", "/"+created.AccessKey+"/disable", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("disable: status = %d", resp.StatusCode)
+	}
+	if resp := server.do(t, created.AccessKey, created.SecretAccessKey, "GET", "/?principal=alice", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("disabled key: status = %d", resp.StatusCode)
+	}
+	if resp := server.do(t, root.AccessKey, rootSecret, "DELETE", "/"+created.AccessKey, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete: status = %d", resp.StatusCode)
+	}
+	if resp := server.do(t, root.AccessKey, rootSecret, "GET", "/"+created.AccessKey, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("get deleted: status = %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,222 @@
+package aksk
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMasterKey = bytes.Repeat([]byte{0x42}, 32)
+
+func newTestKeyManager(t *testing.T) (*KeyManager, string) {
+	dir, err := ioutil.TempDir("", "aksk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "keys.json")
+	manager, err := NewKeyManager(path, testMasterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.now = func() time.Time { return testNow }
+	return manager, path
+}
+
+func signedRequestWith(accessKey string, secretKey string) *http.Request {
+	req, _ := http.NewRequest("GET", "http://bj.bcebos.com/bucket/object", nil)
+	req.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+	NewBceSigner(accessKey, secretKey).Sign(req, 1800)
+	return req
+}
+
+func TestKeyManagerLifecycle(t *testing.T) {
+	manager, _ := newTestKeyManager(t)
+	verifier := NewVerifier(manager)
+	verifier.Now = func() time.Time { return testNow }
+
+	oldKey, oldSecret, err := manager.Create("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(oldKey.AccessKey) != 32 || len(oldSecret) != 32 || oldKey.Status != KeyStatusActive {
+		t.Fatalf("unexpected key %+v", oldKey)
+	}
+	if _, err := verifier.Verify(signedRequestWith(oldKey.AccessKey, oldSecret)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 轮换：两个AK同时有效
+	newKey, newSecret, err := manager.Create("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := manager.Create("alice"); err != ErrTooManyKeys {
+		t.Errorf("third key: err = %v", err)
+	}
+	for _, pair := range [][2]string{{oldKey.AccessKey, oldSecret}, {newKey.AccessKey, newSecret}} {
+		if _, err := verifier.Verify(signedRequestWith(pair[0], pair[1])); err != nil {
+			t.Errorf("%s: %v", pair[0], err)
+		}
+	}
+
+	if err := manager.Disable(oldKey.AccessKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(signedRequestWith(oldKey.AccessKey, oldSecret)); err != ErrInvalidAccessKey {
+		t.Errorf("disabled key: err = %v", err)
+	}
+	if err := manager.Enable(oldKey.AccessKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(signedRequestWith(oldKey.AccessKey, oldSecret)); err != nil {
+		t.Errorf("enabled key: err = %v", err)
+	}
+
+	if err := manager.Delete(oldKey.AccessKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(signedRequestWith(oldKey.AccessKey, oldSecret)); err != ErrInvalidAccessKey {
+		t.Errorf("deleted key: err = %v", err)
+	}
+	if err := manager.Delete(oldKey.AccessKey); err != ErrKeyNotFound {
+		t.Errorf("delete twice: err = %v", err)
+	}
+	if keys := manager.List("alice"); len(keys) != 1 || keys[0].AccessKey != newKey.AccessKey {
+		t.Errorf("list = %+v", keys)
+	}
+	if _, _, err := manager.Create(""); err != ErrPrincipalRequired {
+		t.Errorf("empty principal: err = %v", err)
+	}
+}
+
+// 禁用长期AK后，由它申请的临时凭证也不能再使用
+func TestKeyManagerRevokesSessions(t *testing.T) {
+	manager, _ := newTestKeyManager(t)
+	sessions := NewMemorySessionStore()
+	verifier := NewVerifier(manager)
+	verifier.Sessions = sessions
+	verifier.Now = func() time.Time { return testNow }
+	sts := NewSTSService(sessions)
+	sts.Now = verifier.Now
+
+	key, _, err := manager.Create("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := Policy{AccessControlList: []Grant{{Effect: "Allow", Resource: []string{"/bucket/*"}, Permission: []string{PermissionRead}}}}
+	credential, err := sts.CreateSession(key.AccessKey, policy, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedRequest := func() *http.Request {
+		req, _ := http.NewRequest("GET", "http://bj.bcebos.com/bucket/object", nil)
+		req.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+		credential.Signer().Sign(req, 1800)
+		return req
+	}
+	if _, err := verifier.Verify(signedRequest()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.Disable(key.AccessKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(signedRequest()); err != ErrInvalidSessionToken {
+		t.Errorf("disabled parent: err = %v, want %v", err, ErrInvalidSessionToken)
+	}
+	if err := manager.Delete(key.AccessKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(signedRequest()); err != ErrInvalidSessionToken {
+		t.Errorf("deleted parent: err = %v, want %v", err, ErrInvalidSessionToken)
+	}
+}
+
+func TestKeyManagerPersistence(t *testing.T) {
+	manager, path := newTestKeyManager(t)
+	key, secret, err := manager.Create("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Disable(key.AccessKey); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Error("secret key stored in plaintext")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("file mode = %v", info.Mode())
+	}
+
+	reloaded, err := NewKeyManager(path, testMasterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reloaded.Get(key.AccessKey)
+	if err != nil || got.Principal != "bob" || got.Status != KeyStatusDisabled {
+		t.Fatalf("reloaded key = %+v, err = %v", got, err)
+	}
+	reloaded.Enable(key.AccessKey)
+	if sk, err := reloaded.GetSecretKey(key.AccessKey); err != nil || sk != secret {
+		t.Errorf("secret key = %q, err = %v", sk, err)
+	}
+
+	if _, err := NewKeyManager(path, bytes.Repeat([]byte{0x24}, 32)); err != ErrKeyFileCorrupted {
+		t.Errorf("wrong master key: err = %v", err)
+	}
+	if _, err := NewKeyManager(path, []byte("short")); err != ErrInvalidMasterKey {
+		t.Errorf("short master key: err = %v", err)
+	}
+
+	// 密文挪到其他AK下无法解密
+	tampered := strings.Replace(string(data), key.AccessKey, strings.Repeat("0", 32), -1)
+	ioutil.WriteFile(path, []byte(tampered), 0600)
+	if _, err := NewKeyManager(path, testMasterKey); err != ErrKeyFileCorrupted {
+		t.Errorf("moved secret: err = %v", err)
+	}
+}
+
+func TestKeyManagerLastUsed(t *testing.T) {
+	manager, path := newTestKeyManager(t)
+	key, secret, _ := manager.Create("carol")
+	verifier := NewVerifier(manager)
+	now := testNow
+	verifier.Now = func() time.Time { return now }
+
+	// 签名错误的请求不记录
+	if _, err := verifier.Verify(signedRequestWith(key.AccessKey, "wrong")); err != ErrSignatureMismatch {
+		t.Fatalf("err = %v", err)
+	}
+	if got, _ := manager.Get(key.AccessKey); !got.LastUsedTime.IsZero() {
+		t.Errorf("last used = %v", got.LastUsedTime)
+	}
+
+	if _, err := verifier.Verify(signedRequestWith(key.AccessKey, secret)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := manager.Get(key.AccessKey); !got.LastUsedTime.Equal(testNow) {
+		t.Errorf("last used = %v", got.LastUsedTime)
+	}
+
+	// 一分钟内只更新内存，不写文件
+	now = testNow.Add(10 * time.Second)
+	verifier.Verify(signedRequestWith(key.AccessKey, secret))
+	if got, _ := manager.Get(key.AccessKey); !got.LastUsedTime.Equal(now) {
+		t.Errorf("last used = %v", got.LastUsedTime)
+	}
+	reloaded, _ := NewKeyManager(path, testMasterKey)
+	if got, _ := reloaded.Get(key.AccessKey); !got.LastUsedTime.Equal(testNow) {
+		t.Errorf("persisted last used = %v", got.LastUsedTime)
+	}
+}
@@ -0,0 +1,65 @@
+package aksk
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+//
+// 防重放
+//
+// 认证字符串只能防止在有效期之外重放请求，有效期内截获的请求可以被任意重放。
+// Client在每个请求中加入一个随机数x-bce-nonce，它以x-bce-开头，和其他Header一起参与签名；
+// Server记录处理过的nonce，重复出现时拒绝请求。
+// 为了不让nonce无限增长，开启防重放后，x-bce-date与Server时间的偏差必须在ClockSkew之内，
+// nonce只需要保存到x-bce-date + ClockSkew，之后同样的请求会因为时间超出范围被拒绝。
+//
+
+const NonceHeader = "x-bce-nonce"
+
+var (
+	ErrMissingNonce = errors.New("aksk: missing nonce")
+	ErrNonceReused  = errors.New("aksk: nonce already used")
+)
+
+// nonce存储，需要保证检查和写入是原子的
+// 使用Redis时，可以用 SET key 1 NX PX ttl 实现Add
+type NonceStore interface {
+	// 记录key，ttl之后过期；key已存在时返回false
+	Add(key string, ttl time.Duration) (bool, error)
+}
+
+// 基于内存的NonceStore，过期的nonce在Add时定期清理
+type MemoryNonceStore struct {
+	sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		nonces: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+func (store *MemoryNonceStore) Add(key string, ttl time.Duration) (bool, error) {
+	store.Lock()
+	defer store.Unlock()
+	now := store.now()
+	if now.Sub(store.lastSweep) > time.Minute {
+		for k, expireAt := range store.nonces {
+			if now.After(expireAt) {
+				delete(store.nonces, k)
+			}
+		}
+		store.lastSweep = now
+	}
+	if expireAt, ok := store.nonces[key]; ok && !now.After(expireAt) {
+		return false, nil
+	}
+	store.nonces[key] = now.Add(ttl)
+	return true, nil
+}
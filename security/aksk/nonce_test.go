@@ -0,0 +1,96 @@
+package aksk
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newNonceRequest(t *testing.T, date time.Time) *http.Request {
+	req, _ := http.NewRequest("GET", "http://bj.bcebos.com/bucket/object", nil)
+	req.Header.Set("x-bce-date", date.UTC().Format(BceDateFormat))
+	signer := NewBceSigner(testAccessKey, testSecretKey)
+	signer.Nonce = true
+	signer.Sign(req, 1800)
+	return req
+}
+
+func TestVerifyNonce(t *testing.T) {
+	verifier := newTestVerifier()
+	verifier.Nonces = NewMemoryNonceStore()
+	verifier.RequireNonce = true
+
+	req := newNonceRequest(t, testNow)
+	if req.Header.Get(NonceHeader) == "" {
+		t.Fatal("nonce not set")
+	}
+	if _, err := verifier.Verify(req); err != nil {
+		t.Fatal(err)
+	}
+	// 重放
+	if _, err := verifier.Verify(req); err != ErrNonceReused {
+		t.Fatalf("replay: err = %v, want %v", err, ErrNonceReused)
+	}
+	// 每次签名生成新的nonce
+	if _, err := verifier.Verify(newNonceRequest(t, testNow)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyNonceClockSkew(t *testing.T) {
+	verifier := newTestVerifier()
+	verifier.Nonces = NewMemoryNonceStore()
+
+	// 在有效期内，但超出了ClockSkew
+	req := newNonceRequest(t, testNow.Add(-10*time.Minute))
+	if _, err := verifier.Verify(req); err != ErrRequestExpired {
+		t.Fatalf("err = %v, want %v", err, ErrRequestExpired)
+	}
+	req = newNonceRequest(t, testNow.Add(-4*time.Minute))
+	if _, err := verifier.Verify(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyNonceRequired(t *testing.T) {
+	verifier := newTestVerifier()
+	verifier.Nonces = NewMemoryNonceStore()
+	verifier.RequireNonce = true
+	if _, err := verifier.Verify(newSignedRequest(t, testNow, 1800)); err != ErrMissingNonce {
+		t.Fatalf("err = %v, want %v", err, ErrMissingNonce)
+	}
+
+	// nonce没有参与签名
+	req, _ := http.NewRequest("GET", "http://bj.bcebos.com/bucket/object", nil)
+	req.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+	req.Header.Set(NonceHeader, "abc")
+	signer := NewBceSigner(testAccessKey, testSecretKey)
+	signer.HeaderPolicy = HeaderList("host", "x-bce-date")
+	signer.Sign(req, 1800)
+	if _, err := verifier.Verify(req); err != ErrHeaderNotSigned {
+		t.Fatalf("err = %v, want %v", err, ErrHeaderNotSigned)
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewMemoryNonceStore()
+	now := testNow
+	store.now = func() time.Time { return now }
+
+	if ok, _ := store.Add("a", time.Minute); !ok {
+		t.Fatal("first add failed")
+	}
+	if ok, _ := store.Add("a", time.Minute); ok {
+		t.Fatal("duplicate accepted")
+	}
+	now = now.Add(2 * time.Minute)
+	if ok, _ := store.Add("b", time.Minute); !ok {
+		t.Fatal("add b failed")
+	}
+	if _, ok := store.nonces["a"]; ok {
+		t.Error("expired nonce not swept")
+	}
+	if ok, _ := store.Add("a", time.Minute); !ok {
+		t.Fatal("expired nonce not reusable")
+	}
+}
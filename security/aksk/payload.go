@@ -0,0 +1,171 @@
+package aksk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+//
+// 请求体摘要
+//
+// 默认的签名只覆盖Method、URL和Header，请求体可以被篡改。
+// Client计算请求体的SHA256，放到x-bce-content-sha256中，它以x-bce-开头，和其他Header一起参与签名；
+// Server一边读请求体一边计算摘要，读完时对比，不需要把整个请求体缓存在内存中。
+//
+
+// 请求体SHA256摘要，HEX编码
+const ContentSha256Header = "x-bce-content-sha256"
+
+var ErrPayloadMismatch = errors.New("aksk: payload digest does not match")
+
+// 计算请求体摘要，设置x-bce-content-sha256，需要在Sign之前调用
+func SetContentSha256(request *http.Request) error {
+	digest, err := payloadSha256(request)
+	if err != nil {
+		return err
+	}
+	request.Header.Set(ContentSha256Header, digest)
+	return nil
+}
+
+// 计算请求体SHA256摘要
+// 请求体可以Seek或者设置了GetBody时，直接读一遍计算摘要；否则边读边计算摘要，同时写到临时文件，再从临时文件发送
+func payloadSha256(request *http.Request) (string, error) {
+	h := sha256.New()
+	switch body := request.Body.(type) {
+	case nil:
+	case io.ReadSeeker:
+		offset, err := body.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return "", err
+		}
+		if _, err = io.Copy(h, body); err != nil {
+			return "", err
+		}
+		if _, err = body.Seek(offset, io.SeekStart); err != nil {
+			return "", err
+		}
+	default:
+		if request.Body == http.NoBody {
+			break
+		}
+		if request.GetBody != nil {
+			rc, err := request.GetBody()
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(h, rc)
+			rc.Close()
+			if err != nil {
+				return "", err
+			}
+			break
+		}
+		spooled, size, err := spoolBody(request.Body, h)
+		if err != nil {
+			return "", err
+		}
+		request.Body = spooled
+		request.ContentLength = size
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 临时文件，Close时删除
+type tempFileBody struct {
+	*os.File
+}
+
+func (body tempFileBody) Close() error {
+	err := body.File.Close()
+	os.Remove(body.File.Name())
+	return err
+}
+
+// 把请求体写到临时文件，同时计算摘要
+func spoolBody(body io.ReadCloser, h hash.Hash) (io.ReadCloser, int64, error) {
+	defer body.Close()
+	f, err := ioutil.TempFile("", "aksk-body-")
+	if err != nil {
+		return nil, 0, err
+	}
+	spooled := tempFileBody{f}
+	size, err := io.Copy(io.MultiWriter(f, h), body)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spooled.Close()
+		return nil, 0, err
+	}
+	return spooled, size, nil
+}
+
+// 边读边计算摘要，读完请求体时对比，不一致时返回ErrPayloadMismatch
+//
+// 有Content-Length时，读到最后一个字节即校验，不依赖EOF：用io.ReadFull只读Content-Length个字节的解码器也能拿到错误。
+// 校验失败时最后一次读取的数据不返回给调用方，之后的Read都返回ErrPayloadMismatch。
+// 没有读完就Close时，先读完剩余的请求体再校验，Close返回校验的结果。
+type digestReader struct {
+	body     io.ReadCloser
+	hash     hash.Hash
+	expected string
+	length   int64 // Content-Length，-1表示未知
+	read     int64
+	checked  bool
+	err      error
+}
+
+func (reader *digestReader) Read(p []byte) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+	n, err := reader.body.Read(p)
+	reader.hash.Write(p[:n])
+	reader.read += int64(n)
+	switch {
+	case reader.checked && n > 0, reader.length >= 0 && reader.read > reader.length:
+		// 请求体比Content-Length长
+		reader.err = ErrPayloadMismatch
+	case !reader.checked && (err == io.EOF || reader.length >= 0 && reader.read == reader.length):
+		reader.checked = true
+		if hex.EncodeToString(reader.hash.Sum(nil)) != reader.expected {
+			reader.err = ErrPayloadMismatch
+		}
+	}
+	if reader.err != nil {
+		return 0, reader.err
+	}
+	return n, err
+}
+
+func (reader *digestReader) Close() error {
+	if !reader.checked && reader.err == nil {
+		io.Copy(ioutil.Discard, reader)
+	}
+	err := reader.body.Close()
+	if reader.err != nil {
+		return reader.err
+	}
+	return err
+}
+
+// 替换请求体，读取时校验摘要
+func verifyPayload(request *http.Request, expected string) {
+	body := request.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	request.Body = &digestReader{
+		body:     body,
+		hash:     sha256.New(),
+		expected: expected,
+		length:   request.ContentLength,
+	}
+}
@@ -0,0 +1,145 @@
+package aksk
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	testPayload       = "hello, world"
+	testPayloadSha256 = "09ca7e4eaa6e8ae9c7d261167129184883644d07dfba7cbfbc4c8a2e08360d5b"
+)
+
+// 只实现io.Reader，模拟无法Seek的流
+type streamReader struct {
+	io.Reader
+}
+
+func TestSetContentSha256(t *testing.T) {
+	f, err := ioutil.TempFile("", "aksk-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(testPayload)
+	f.Seek(0, io.SeekStart)
+
+	bodies := map[string]io.Reader{
+		"get body": strings.NewReader(testPayload),
+		"seeker":   f,
+		"stream":   streamReader{strings.NewReader(testPayload)},
+	}
+	for name, body := range bodies {
+		req, _ := http.NewRequest("PUT", "http://bj.bcebos.com/bucket/object", body)
+		if err := SetContentSha256(req); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := req.Header.Get(ContentSha256Header); got != testPayloadSha256 {
+			t.Errorf("%s: digest = %s", name, got)
+		}
+		// 计算摘要后，请求体仍然可以完整读出
+		b, _ := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if string(b) != testPayload {
+			t.Errorf("%s: body = %q", name, b)
+		}
+	}
+}
+
+func TestVerifyPayload(t *testing.T) {
+	verifier := newTestVerifier()
+	verifier.RequirePayloadDigest = true
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	newRequest := func() *http.Request {
+		req, _ := http.NewRequest("PUT", "http://bj.bcebos.com/bucket/object", strings.NewReader(testPayload))
+		req.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+		return req
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	signer := NewBceSigner(testAccessKey, testSecretKey)
+
+	req := newRequest()
+	SetContentSha256(req)
+	signer.Sign(req, 1800)
+	if rec := serve(req); rec.Code != http.StatusOK {
+		t.Fatalf("code = %d, body = %q", rec.Code, rec.Body.String())
+	}
+
+	// 篡改请求体
+	req = newRequest()
+	SetContentSha256(req)
+	signer.Sign(req, 1800)
+	req.Body = ioutil.NopCloser(bytes.NewBufferString("hello, hacker"))
+	if rec := serve(req); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), ErrPayloadMismatch.Error()) {
+		t.Fatalf("tampered: code = %d, body = %q", rec.Code, rec.Body.String())
+	}
+
+	// 摘要没有参与签名
+	req = newRequest()
+	unsigned := NewBceSigner(testAccessKey, testSecretKey)
+	unsigned.HeaderPolicy = HeaderList("host", "x-bce-date")
+	SetContentSha256(req)
+	unsigned.Sign(req, 1800)
+	if _, err := verifier.Verify(req); err != ErrHeaderNotSigned {
+		t.Fatalf("err = %v, want %v", err, ErrHeaderNotSigned)
+	}
+
+	// 缺少摘要
+	req = newRequest()
+	signer.Sign(req, 1800)
+	if _, err := verifier.Verify(req); err != ErrMissingPayloadDigest {
+		t.Fatalf("err = %v, want %v", err, ErrMissingPayloadDigest)
+	}
+}
+
+func TestDigestReader(t *testing.T) {
+	newReader := func(payload string, length int64) *digestReader {
+		req, _ := http.NewRequest("PUT", "http://bj.bcebos.com/bucket/object", ioutil.NopCloser(strings.NewReader(payload)))
+		req.ContentLength = length
+		verifyPayload(req, testPayloadSha256)
+		return req.Body.(*digestReader)
+	}
+
+	// 只读Content-Length个字节，不等EOF
+	buf := make([]byte, len(testPayload))
+	if _, err := io.ReadFull(newReader(testPayload, int64(len(testPayload))), buf); err != nil {
+		t.Errorf("ReadFull: %v", err)
+	}
+	if _, err := io.ReadFull(newReader("hello, hackr", int64(len(testPayload))), buf); err != ErrPayloadMismatch {
+		t.Errorf("tampered ReadFull: %v", err)
+	}
+
+	// 长度未知时读到EOF校验
+	if _, err := ioutil.ReadAll(newReader("hello, hackr", -1)); err != ErrPayloadMismatch {
+		t.Errorf("tampered ReadAll: %v", err)
+	}
+
+	// 没有读完就Close
+	reader := newReader(testPayload, -1)
+	reader.Read(make([]byte, 5))
+	if err := reader.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	reader = newReader("hello, hackr", -1)
+	reader.Read(make([]byte, 5))
+	if err := reader.Close(); err != ErrPayloadMismatch {
+		t.Errorf("tampered Close: %v", err)
+	}
+}
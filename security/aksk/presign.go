@@ -0,0 +1,50 @@
+package aksk
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+//
+// 预签名URL
+//
+// 把认证字符串放到URL的Query String中(authorization=<认证字符串>)，生成一个可以直接分享的临时URL，用于签名URL防盗链。
+// 使用者访问URL时不会携带x-bce-date等Header，所以只对Host签名，有效期从认证字符串中的时间开始计算。
+// 使用STS临时授权时，SessionToken也放到Query String中，参与签名。
+//
+
+// 生成预签名URL，expirationPeriodInSeconds为URL的有效时长
+func (signer *BceSigner) PresignURL(method string, rawURL string, expirationPeriodInSeconds int) (string, error) {
+	return signer.presignURL(method, rawURL, time.Now(), expirationPeriodInSeconds)
+}
+
+func (signer *BceSigner) presignURL(method string, rawURL string, timestamp time.Time, expirationPeriodInSeconds int) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("aksk: url %q has no host", rawURL)
+	}
+	query := u.Query()
+	query.Del("authorization")
+	if signer.SessionToken != "" {
+		query.Set(SecurityTokenHeader, signer.SessionToken)
+	}
+	u.RawQuery = query.Encode()
+
+	request := &http.Request{
+		Method: method,
+		URL:    u,
+		Header: http.Header{"Host": {u.Host}},
+	}
+	authStringPrefix, signingKey := signer.buildSigningKey(timestamp.UTC().Format(BceDateFormat), expirationPeriodInSeconds)
+	canonicalRequest, signedHeaders := signer.buildCanonicalRequest(request)
+	signature := signer.buildSignature(signingKey, canonicalRequest)
+
+	query.Set("authorization", fmt.Sprintf("%s/%s/%s", authStringPrefix, signedHeaders, signature))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
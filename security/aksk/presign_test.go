@@ -0,0 +1,78 @@
+package aksk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPresignURL(t *testing.T) {
+	verifier := newTestVerifier()
+	server := httptest.NewServer(verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})))
+	defer server.Close()
+
+	signer := NewBceSigner(testAccessKey, testSecretKey)
+	presigned, err := signer.presignURL("GET", server.URL+"/bucket/object?x=1", testNow, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(presigned)
+	if u.Query().Get("authorization") == "" {
+		t.Fatalf("no authorization in %s", presigned)
+	}
+
+	get := func(rawURL string) int {
+		resp, err := http.Get(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get(presigned); code != http.StatusOK {
+		t.Fatalf("presigned url: code = %d", code)
+	}
+
+	// 篡改参数
+	tampered := *u
+	query := tampered.Query()
+	query.Set("x", "2")
+	tampered.RawQuery = query.Encode()
+	if code := get(tampered.String()); code != http.StatusUnauthorized {
+		t.Errorf("tampered query: code = %d", code)
+	}
+
+	// 过期
+	verifier.Now = func() time.Time { return testNow.Add(601 * time.Second) }
+	if code := get(presigned); code != http.StatusUnauthorized {
+		t.Errorf("expired: code = %d", code)
+	}
+}
+
+func TestPresignURLReplacesAuthorization(t *testing.T) {
+	signer := NewBceSigner(testAccessKey, testSecretKey)
+	presigned, err := signer.presignURL("GET", "http://bj.bcebos.com/bucket/object?authorization=old", testNow, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", presigned, nil)
+	if _, err := newTestVerifier().Verify(req); err != nil {
+		t.Fatal(err)
+	}
+	if v := req.URL.Query()["authorization"]; len(v) != 1 || v[0] == "old" {
+		t.Fatalf("authorization = %v", v)
+	}
+}
+
+func TestPresignURLMethod(t *testing.T) {
+	signer := NewBceSigner(testAccessKey, testSecretKey)
+	presigned, _ := signer.presignURL("GET", "http://bj.bcebos.com/bucket/object", testNow, 600)
+	req, _ := http.NewRequest("DELETE", presigned, nil)
+	if _, err := newTestVerifier().Verify(req); err != ErrSignatureMismatch {
+		t.Fatalf("err = %v, want %v", err, ErrSignatureMismatch)
+	}
+}
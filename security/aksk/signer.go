@@ -1,11 +1,10 @@
-package main
+package aksk
 
 import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"sort"
@@ -13,6 +12,25 @@ import (
 	"time"
 )
 
+// x-bce-date的时间格式，UTC时间
+const BceDateFormat = "2006-01-02T15:04:05Z"
+
+// STS临时授权的SessionToken
+const SecurityTokenHeader = "x-bce-security-token"
+
+// 签名算法，目前支持百度云bce-signer-v1和AWS Signature Version 4
+type Signer interface {
+	// 对请求签名，把认证信息放入Authorization Header
+	Sign(request *http.Request, expirationPeriodInSeconds int)
+	// 生成预签名URL
+	PresignURL(method string, rawURL string, expirationPeriodInSeconds int) (string, error)
+	// 设置签名时间
+	SetDate(request *http.Request, timestamp time.Time)
+}
+
+var _ Signer = (*BceSigner)(nil)
+var _ Signer = (*SigV4Signer)(nil)
+
 //
 // 百度云API AK/SK 鉴权例子
 //
@@ -25,6 +43,7 @@ import (
 //   计算签名时，如果选择的Header太少，则可能遭到中间人攻击。百度云API建议至少选择：Host、Content-Length、Content-Type、Content-MD5、所有以x-bce-开头的Header。
 // 3)防止重放攻击
 //   认证字符串(Authorization)都具有指定的有效时间。如请求被截获，第三方无法在有效时间之外重放请求。
+//   有效时间之内的重放，需要在请求中加入随机数x-bce-nonce，由Server记录并拒绝重复的nonce。
 //
 // 最佳实践：
 // 1)临时授权
@@ -47,86 +66,117 @@ import (
 //   最佳实践 https://cloud.baidu.com/doc/BOS/index.html
 //
 type BceSigner struct {
-	AccessKey string
-	SecretKey string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string       // STS临时授权的SessionToken，使用长期AK/SK时为空
+	HeaderPolicy HeaderPolicy // 签名Header的选择策略，为空时使用DefaultHeaderPolicy
+	Nonce        bool         // 是否在每个请求中加入随机数x-bce-nonce，用于防重放
 }
 
 func NewBceSigner(accessKey string, secretKey string) *BceSigner {
 	return &BceSigner{
-		accessKey,
-		secretKey,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	}
+}
+
+// 使用STS临时AK/SK和SessionToken
+func NewSessionBceSigner(accessKey string, secretKey string, sessionToken string) *BceSigner {
+	return &BceSigner{
+		AccessKey:    accessKey,
+		SecretKey:    secretKey,
+		SessionToken: sessionToken,
+	}
+}
+
+// 对请求签名，把认证字符串放入Authorization Header
+// 没有设置x-bce-date时使用当前时间
+// 使用STS临时授权时，SessionToken放在x-bce-security-token中，和其他x-bce-开头的Header一起参与签名
+// Host必须参与签名，没有设置时取request.Host
+// 开启Nonce时，每次签名都生成新的x-bce-nonce
+func (signer *BceSigner) Sign(request *http.Request, expirationPeriodInSeconds int) {
+	if request.Header.Get("Host") == "" {
+		host := request.Host
+		if host == "" {
+			host = request.URL.Host
+		}
+		request.Header.Set("Host", host)
+	}
+	if request.Header.Get("x-bce-date") == "" {
+		signer.SetDate(request, time.Now())
+	}
+	if signer.SessionToken != "" {
+		request.Header.Set(SecurityTokenHeader, signer.SessionToken)
 	}
+	if signer.Nonce {
+		request.Header.Set(NonceHeader, randomHex(16))
+	}
+	request.Header.Set("Authorization", signer.buildAuthString(request, expirationPeriodInSeconds))
+}
+
+// 设置x-bce-date
+func (signer *BceSigner) SetDate(request *http.Request, timestamp time.Time) {
+	request.Header.Set("x-bce-date", timestamp.UTC().Format(BceDateFormat))
 }
 
 // 生成签名摘要
 func (signer *BceSigner) buildAuthString(request *http.Request, expirationPeriodInSeconds int) string {
-	authStringPrefix, signingKey := signer.buildSigningKey(request, expirationPeriodInSeconds)
-	canonicalRequest, signedHeaders := signer.buildCanonicalRequest(request)
-	signature := hmacSha256Hex(signingKey, canonicalRequest)
-	return fmt.Sprintf("%s/%s/%s", authStringPrefix, signedHeaders, signature)
+	return signer.Explain(request, expirationPeriodInSeconds).AuthString
 }
 
 // 生成认证字符串前缀和派生密钥
-func (signer *BceSigner) buildSigningKey(request *http.Request, expirationPeriodInSeconds int) (authStringPrefix string, signingKey string) {
-	authStringPrefix = fmt.Sprintf("bce-signer-v1/%s/%s/%d", signer.AccessKey, request.Header.Get("x-bce-date"), expirationPeriodInSeconds)
+func (signer *BceSigner) buildSigningKey(timestamp string, expirationPeriodInSeconds int) (authStringPrefix string, signingKey string) {
+	authStringPrefix = fmt.Sprintf("bce-signer-v1/%s/%s/%d", signer.AccessKey, timestamp, expirationPeriodInSeconds)
 	signingKey = hmacSha256Hex(signer.SecretKey, authStringPrefix)
 	return
 }
 
+// 用派生密钥对规范请求生成签名摘要
+func (signer *BceSigner) buildSignature(signingKey string, canonicalRequest string) string {
+	return hmacSha256Hex(signingKey, canonicalRequest)
+}
+
 // 生成规范Request，确定signedHeaders
 func (signer *BceSigner) buildCanonicalRequest(request *http.Request) (canonicalRequest string, signedHeaders string) {
 	canonicalMethod := strings.ToUpper(request.Method)
-	canonicalURI := signer.buildCanonicalURI(request.URL.Path)
+	canonicalURI := signer.buildCanonicalURI(request.URL)
 	canonicalQuery := signer.buildCanonicalQueryString(request.URL.Query())
 	canonicalHeaders, signedHeaders := signer.buildCanonicalHeaders(request.Header)
 	canonicalRequest = fmt.Sprintf("%s\n%s\n%s\n%s", canonicalMethod, canonicalURI, canonicalQuery, canonicalHeaders)
 	return
 }
 
-// 生成规范URI
-func (signer *BceSigner) buildCanonicalURI(path string) string {
-	if path == "" {
-		path = "/"
-	}
-	path = url.QueryEscape(path)
-	return strings.Replace(path, "%2F", "/", -1) // 按百度云API要求，斜杠（/）不做编码
+// 生成规范URI，按RFC 3986编码
+func (signer *BceSigner) buildCanonicalURI(u *url.URL) string {
+	return canonicalURI(u, uriEscape) // 按百度云API要求，斜杠（/）不做编码
 }
 
-// 生成规范QueryString
+// 生成规范QueryString，key、value按RFC 3986编码(空格编码为%20)，同一个key的多个value都参与签名
+// 编码后的key=value按字典序排序
 func (signer *BceSigner) buildCanonicalQueryString(query url.Values) string {
 	kvs := make(sort.StringSlice, 0)
-	for k, v := range query {
-		if k == "authorization" {
-			continue
-		}
-		kv := url.QueryEscape(k) + "=" + url.QueryEscape(v[0])
-		kvs = append(kvs, kv)
+	for _, pair := range encodeQuery(query, uriEscape, "authorization") {
+		kvs = append(kvs, pair.key+"="+pair.value)
 	}
 	kvs.Sort()
 	return strings.Join(kvs, "&")
 }
 
-// 生成规范Headers，确定signedHeaders
+// 生成规范Headers，确定signedHeaders，key、value按RFC 3986编码
 func (signer *BceSigner) buildCanonicalHeaders(header http.Header) (canonicalHeaders string, signedHeaders string) {
 	ks := make(sort.StringSlice, 0)
 	kvs := make(sort.StringSlice, 0)
-	for k, v := range header {
-		keyStr := strings.ToLower(k)
-		if keyStr == "host" ||
-			keyStr == "content-length" ||
-			keyStr == "content-type" ||
-			keyStr == "content-md5" ||
-			strings.Index(keyStr, "x-bce-") == 0 {
-			var valStr string
-			if len(v) != 0 {
-				valStr = strings.Trim(v[0], "\t ")
-			}
-			if len(valStr) == 0 {
-				continue
-			}
-			ks = append(ks, keyStr)
-			kvs = append(kvs, fmt.Sprintf("%s:%s", keyStr, url.QueryEscape(valStr)))
+	policy := signer.HeaderPolicy
+	if policy == nil {
+		policy = DefaultHeaderPolicy
+	}
+	for k, v := range selectHeaders(header, policy) {
+		valStr := joinHeaderValues(v)
+		if len(valStr) == 0 {
+			continue
 		}
+		ks = append(ks, k)
+		kvs = append(kvs, fmt.Sprintf("%s:%s", uriEscape(k), uriEscape(valStr)))
 	}
 	ks.Sort()
 	signedHeaders = strings.Join(ks, ";")
@@ -141,33 +191,3 @@ func hmacSha256Hex(key string, message string) string {
 	h.Write([]byte(message))
 	return hex.EncodeToString(h.Sum(nil))
 }
-
-func main() {
-	// 准备 url 和 request
-	urlStr := "https://jowin-dev.bj.bcebos.com/meiyou"
-	req, _ := http.NewRequest("GET", urlStr, nil)
-	req.Header.Set("Host", "jowin-dev.bj.bcebos.com")
-	req.Header.Set("x-bce-date", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
-
-	// 添加鉴权信息
-	authBuilder := NewBceSigner("00862f7e445143478fa2b1483874d365", "31dab24594ca410d9ecd3d65874938cb")
-	authString := authBuilder.buildAuthString(req, 1800)
-	req.Header.Set("Authorization", authString)
-
-	// 请求Object
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	if resp.StatusCode != 200 {
-		fmt.Printf("get object failed, resp_code:%d\n", resp.StatusCode)
-		return
-	}
-	defer resp.Body.Close()
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Printf("resp:\n%s\n", string(body))
-
-	return
-}
\ No newline at end of file
@@ -0,0 +1,242 @@
+package aksk
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// AWS Signature Version 4
+//
+// S3兼容的存储(AWS S3、MinIO等)使用SigV4签名，原理和bce-signer-v1相同，区别在于：
+// 1)派生密钥：SigV4使用SK依次对日期、Region、Service、"aws4_request"做HMAC，得到派生密钥，日期/Region/Service/aws4_request称为Credential Scope
+// 2)待签名串：SigV4先对规范请求做SHA256，再和算法、时间、Credential Scope拼接成待签名串(StringToSign)
+// 3)规范请求：包含signedHeaders和请求体摘要(x-amz-content-sha256)，请求体不签名时使用UNSIGNED-PAYLOAD
+// 4)编码：URI、QueryString按RFC 3986编码，Header的值不编码，只去掉首尾空格、合并连续空格
+//
+// 这里按S3的要求实现，URI只编码一次。
+//
+// 相关参考:
+//   Signature Version 4 https://docs.aws.amazon.com/general/latest/gr/signature-version-4.html
+//   S3 Authorization Header https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+//   S3 预签名URL https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html
+//
+
+const (
+	SigV4Algorithm         = "AWS4-HMAC-SHA256"
+	AmzDateFormat          = "20060102T150405Z"
+	AmzDateHeader          = "x-amz-date"
+	AmzContentSha256Header = "x-amz-content-sha256"
+	AmzSecurityTokenHeader = "x-amz-security-token"
+	UnsignedPayload        = "UNSIGNED-PAYLOAD"
+
+	emptyPayloadSha256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+type SigV4Signer struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string       // STS临时凭证的SessionToken，使用长期AK/SK时为空
+	Region       string       // 例如us-east-1，MinIO默认为us-east-1
+	Service      string       // 例如s3
+	HeaderPolicy HeaderPolicy // 签名Header的选择策略，为空时使用SigV4HeaderPolicy
+}
+
+func NewSigV4Signer(accessKey string, secretKey string, region string, service string) *SigV4Signer {
+	return &SigV4Signer{
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Region:    region,
+		Service:   service,
+	}
+}
+
+// SigV4的默认策略：Host、Content-Type、Content-MD5、Range、所有以x-amz-开头的Header
+func SigV4HeaderPolicy(key string) bool {
+	return key == "host" ||
+		key == "content-type" ||
+		key == "content-md5" ||
+		key == "range" ||
+		strings.HasPrefix(key, "x-amz-")
+}
+
+// 对请求签名，把认证信息放入Authorization Header
+// SigV4的有效期由Server决定(S3为15分钟)，expirationPeriodInSeconds不起作用
+// 没有设置x-amz-date时使用当前时间；没有设置x-amz-content-sha256时，空请求体使用空串的摘要，否则使用UNSIGNED-PAYLOAD，
+// 需要对请求体签名时，先调用SetAmzContentSha256
+func (signer *SigV4Signer) Sign(request *http.Request, expirationPeriodInSeconds int) {
+	if request.Header.Get("Host") == "" {
+		host := request.Host
+		if host == "" {
+			host = request.URL.Host
+		}
+		request.Header.Set("Host", host)
+	}
+	if request.Header.Get(AmzDateHeader) == "" {
+		signer.SetDate(request, time.Now())
+	}
+	if request.Header.Get(AmzContentSha256Header) == "" {
+		if request.Body == nil || request.Body == http.NoBody {
+			request.Header.Set(AmzContentSha256Header, emptyPayloadSha256)
+		} else {
+			request.Header.Set(AmzContentSha256Header, UnsignedPayload)
+		}
+	}
+	if signer.SessionToken != "" {
+		request.Header.Set(AmzSecurityTokenHeader, signer.SessionToken)
+	}
+	request.Header.Set("Authorization", signer.buildAuthString(request))
+}
+
+// 设置x-amz-date
+func (signer *SigV4Signer) SetDate(request *http.Request, timestamp time.Time) {
+	request.Header.Set(AmzDateHeader, timestamp.UTC().Format(AmzDateFormat))
+}
+
+// 计算请求体摘要，设置x-amz-content-sha256，需要在Sign之前调用
+func SetAmzContentSha256(request *http.Request) error {
+	digest, err := payloadSha256(request)
+	if err != nil {
+		return err
+	}
+	request.Header.Set(AmzContentSha256Header, digest)
+	return nil
+}
+
+// 生成Authorization
+func (signer *SigV4Signer) buildAuthString(request *http.Request) string {
+	amzDate := request.Header.Get(AmzDateHeader)
+	canonicalRequest, signedHeaders := signer.buildCanonicalRequest(request, request.Header.Get(AmzContentSha256Header))
+	scope, signature := signer.buildSignature(amzDate, canonicalRequest)
+	return fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", SigV4Algorithm, signer.AccessKey, scope, signedHeaders, signature)
+}
+
+// 生成预签名URL，expirationPeriodInSeconds为URL的有效时长，S3最长为7天
+func (signer *SigV4Signer) PresignURL(method string, rawURL string, expirationPeriodInSeconds int) (string, error) {
+	return signer.presignURL(method, rawURL, time.Now(), expirationPeriodInSeconds)
+}
+
+func (signer *SigV4Signer) presignURL(method string, rawURL string, timestamp time.Time, expirationPeriodInSeconds int) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("aksk: url %q has no host", rawURL)
+	}
+	amzDate := timestamp.UTC().Format(AmzDateFormat)
+	query := u.Query()
+	query.Del("X-Amz-Signature")
+	query.Set("X-Amz-Algorithm", SigV4Algorithm)
+	query.Set("X-Amz-Credential", signer.AccessKey+"/"+signer.credentialScope(amzDate))
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(expirationPeriodInSeconds))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if signer.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", signer.SessionToken)
+	}
+	u.RawQuery = query.Encode()
+
+	request := &http.Request{
+		Method: method,
+		URL:    u,
+		Header: http.Header{"Host": {u.Host}},
+	}
+	canonicalRequest, _ := signer.buildCanonicalRequest(request, UnsignedPayload)
+	_, signature := signer.buildSignature(amzDate, canonicalRequest)
+
+	query.Set("X-Amz-Signature", signature)
+	u.RawQuery = strings.Replace(query.Encode(), "+", "%20", -1)
+	return u.String(), nil
+}
+
+// 生成Credential Scope：日期/Region/Service/aws4_request
+func (signer *SigV4Signer) credentialScope(amzDate string) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", amzDate[:8], signer.Region, signer.Service)
+}
+
+// 生成待签名串，使用派生密钥签名
+func (signer *SigV4Signer) buildSignature(amzDate string, canonicalRequest string) (scope string, signature string) {
+	scope = signer.credentialScope(amzDate)
+	digest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{SigV4Algorithm, amzDate, scope, hex.EncodeToString(digest[:])}, "\n")
+	signature = hex.EncodeToString(hmacSha256(signer.buildSigningKey(amzDate), stringToSign))
+	return
+}
+
+// 生成派生密钥
+func (signer *SigV4Signer) buildSigningKey(amzDate string) []byte {
+	kDate := hmacSha256([]byte("AWS4"+signer.SecretKey), amzDate[:8])
+	kRegion := hmacSha256(kDate, signer.Region)
+	kService := hmacSha256(kRegion, signer.Service)
+	return hmacSha256(kService, "aws4_request")
+}
+
+// 生成规范Request，确定signedHeaders
+func (signer *SigV4Signer) buildCanonicalRequest(request *http.Request, payloadHash string) (canonicalRequest string, signedHeaders string) {
+	canonicalHeaders, signedHeaders := signer.buildCanonicalHeaders(request.Header)
+	canonicalRequest = strings.Join([]string{
+		strings.ToUpper(request.Method),
+		canonicalURI(request.URL, uriEscape),
+		signer.buildCanonicalQueryString(request.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	return
+}
+
+// 生成规范QueryString，按key排序，key相同时按value排序
+func (signer *SigV4Signer) buildCanonicalQueryString(query url.Values) string {
+	pairs := encodeQuery(query, uriEscape, "X-Amz-Signature")
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].key != pairs[j].key {
+			return pairs[i].key < pairs[j].key
+		}
+		return pairs[i].value < pairs[j].value
+	})
+	kvs := make([]string, len(pairs))
+	for i, pair := range pairs {
+		kvs[i] = pair.key + "=" + pair.value
+	}
+	return strings.Join(kvs, "&")
+}
+
+// 生成规范Headers，每个Header一行，以换行结尾；同名Header的多个值用逗号连接
+func (signer *SigV4Signer) buildCanonicalHeaders(header http.Header) (canonicalHeaders string, signedHeaders string) {
+	policy := signer.HeaderPolicy
+	if policy == nil {
+		policy = SigV4HeaderPolicy
+	}
+	selected := selectHeaders(header, policy)
+	ks := make(sort.StringSlice, 0, len(selected))
+	for k := range selected {
+		ks = append(ks, k)
+	}
+	ks.Sort()
+
+	var b strings.Builder
+	for _, k := range ks {
+		vs := make([]string, len(selected[k]))
+		for i, v := range selected[k] {
+			vs[i] = strings.Join(strings.Fields(v), " ")
+		}
+		b.WriteString(k + ":" + strings.Join(vs, ",") + "\n")
+	}
+	return b.String(), strings.Join(ks, ";")
+}
+
+// HMAC-SHA256
+func hmacSha256(key []byte, message string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(message))
+	return h.Sum(nil)
+}
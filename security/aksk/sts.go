@@ -0,0 +1,303 @@
+package aksk
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// STS临时授权
+//
+// 移动端等不可信的环境不能保存长期AK/SK，需要由业务Server使用长期AK/SK向STS服务申请临时授权：
+// 1)业务Server使用长期AK/SK签名，调用STS服务，请求体中携带权限策略(Policy)，指定允许访问的资源和操作
+// 2)STS服务生成临时AK/SK和SessionToken，把权限策略、过期时间等簿记在Session中
+// 3)App使用临时AK/SK签名，同时在x-bce-security-token中携带SessionToken，SessionToken参与签名
+// 4)Server校验签名后，检查Session是否过期、申请Session的长期AK是否仍然有效，请求的资源和操作是否在Policy允许的范围内
+//
+// 参考 https://cloud.baidu.com/doc/BOS/s/Tjwvysda9
+//
+
+var (
+	ErrInvalidSessionToken = errors.New("aksk: invalid session token")
+	ErrSessionExpired      = errors.New("aksk: session expired")
+	ErrAccessDenied        = errors.New("aksk: access denied by policy")
+)
+
+const (
+	DefaultSessionDuration = time.Hour
+	MaxSessionDuration     = 12 * time.Hour
+)
+
+// 权限
+const (
+	PermissionRead        = "READ"         // GET、HEAD
+	PermissionWrite       = "WRITE"        // PUT、POST、DELETE
+	PermissionFullControl = "FULL_CONTROL" // 所有操作
+)
+
+// 权限策略，参考百度云BOS的ACL格式
+//
+//	{"accessControlList": [{"effect": "Allow", "resource": ["/bucket/*"], "permission": ["READ"]}]}
+type Policy struct {
+	AccessControlList []Grant `json:"accessControlList"`
+}
+
+type Grant struct {
+	Effect     string   `json:"effect"`     // Allow或Deny，Deny优先
+	Resource   []string `json:"resource"`   // 请求的Path，以*结尾时按前缀匹配
+	Permission []string `json:"permission"` // READ、WRITE、FULL_CONTROL
+}
+
+// 检查请求是否被允许，没有匹配的Allow时拒绝
+// path必须是规范的形式，包含.、..或空的段时拒绝，防止/bucket/../other绕过前缀匹配
+func (policy *Policy) Allow(method string, path string) bool {
+	if !isCleanPath(path) {
+		return false
+	}
+	allowed := false
+	for _, grant := range policy.AccessControlList {
+		if !grant.match(method, path) {
+			continue
+		}
+		if strings.EqualFold(grant.Effect, "Deny") {
+			return false
+		}
+		if strings.EqualFold(grant.Effect, "Allow") {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+func (grant *Grant) match(method string, path string) bool {
+	matchResource := false
+	for _, resource := range grant.Resource {
+		if resource == "*" || resource == path ||
+			strings.HasSuffix(resource, "*") && strings.HasPrefix(path, strings.TrimSuffix(resource, "*")) {
+			matchResource = true
+			break
+		}
+	}
+	if !matchResource {
+		return false
+	}
+	for _, permission := range grant.Permission {
+		switch strings.ToUpper(permission) {
+		case PermissionFullControl:
+			return true
+		case PermissionRead:
+			if method == http.MethodGet || method == http.MethodHead {
+				return true
+			}
+		case PermissionWrite:
+			if method == http.MethodPut || method == http.MethodPost || method == http.MethodDelete {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 和path.Clean的结果一致，允许以/结尾
+func isCleanPath(p string) bool {
+	if !strings.HasPrefix(p, "/") {
+		return false
+	}
+	clean := path.Clean(p)
+	return p == clean || p == clean+"/"
+}
+
+// 校验Policy格式
+func (policy *Policy) validate() error {
+	if len(policy.AccessControlList) == 0 {
+		return errors.New("aksk: empty access control list")
+	}
+	for _, grant := range policy.AccessControlList {
+		if !strings.EqualFold(grant.Effect, "Allow") && !strings.EqualFold(grant.Effect, "Deny") {
+			return errors.New("aksk: invalid effect " + grant.Effect)
+		}
+		if len(grant.Resource) == 0 || len(grant.Permission) == 0 {
+			return errors.New("aksk: grant without resource or permission")
+		}
+	}
+	return nil
+}
+
+// 临时授权的Session
+type Session struct {
+	AccessKey       string // 临时AK
+	SecretKey       string // 临时SK
+	SessionToken    string
+	ParentAccessKey string // 申请临时授权的长期AK
+	Policy          Policy
+	CreateTime      time.Time
+	Expiration      time.Time
+}
+
+// 返回给App的临时凭证
+type Credential struct {
+	AccessKeyId     string    `json:"accessKeyId"`
+	SecretAccessKey string    `json:"secretAccessKey"`
+	SessionToken    string    `json:"sessionToken"`
+	CreateTime      time.Time `json:"createTime"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+// 使用临时凭证签名
+func (credential *Credential) Signer() *BceSigner {
+	return NewSessionBceSigner(credential.AccessKeyId, credential.SecretAccessKey, credential.SessionToken)
+}
+
+// Session存储，根据SessionToken查找Session，不存在时返回ErrInvalidSessionToken
+type SessionStore interface {
+	Save(session *Session) error
+	Get(sessionToken string) (*Session, error)
+}
+
+// 基于内存的SessionStore，过期的Session在Save时顺带清理
+type MemorySessionStore struct {
+	sync.RWMutex
+	sessions map[string]*Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*Session),
+	}
+}
+
+func (store *MemorySessionStore) Save(session *Session) error {
+	store.Lock()
+	defer store.Unlock()
+	now := time.Now()
+	for token, s := range store.sessions {
+		if now.After(s.Expiration) {
+			delete(store.sessions, token)
+		}
+	}
+	store.sessions[session.SessionToken] = session
+	return nil
+}
+
+func (store *MemorySessionStore) Get(sessionToken string) (*Session, error) {
+	store.RLock()
+	defer store.RUnlock()
+	session, ok := store.sessions[sessionToken]
+	if !ok {
+		return nil, ErrInvalidSessionToken
+	}
+	return session, nil
+}
+
+// STS服务，需要挂在Verifier.Middleware之后，使用长期AK/SK调用
+//
+//	POST /sts/sessionToken?durationSeconds=3600
+//	Body: Policy
+type STSService struct {
+	Sessions SessionStore
+	Now      func() time.Time
+}
+
+func NewSTSService(sessions SessionStore) *STSService {
+	return &STSService{
+		Sessions: sessions,
+		Now:      time.Now,
+	}
+}
+
+// 生成临时凭证
+func (sts *STSService) CreateSession(parentAccessKey string, policy Policy, duration time.Duration) (*Credential, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		duration = DefaultSessionDuration
+	}
+	if duration > MaxSessionDuration {
+		duration = MaxSessionDuration
+	}
+
+	session := &Session{
+		AccessKey:       randomHex(16),
+		SecretKey:       randomHex(16),
+		SessionToken:    randomHex(32),
+		ParentAccessKey: parentAccessKey,
+		Policy:          policy,
+		CreateTime:      sts.Now().UTC(),
+	}
+	session.Expiration = session.CreateTime.Add(duration)
+	if err := sts.Sessions.Save(session); err != nil {
+		return nil, err
+	}
+	return &Credential{
+		AccessKeyId:     session.AccessKey,
+		SecretAccessKey: session.SecretKey,
+		SessionToken:    session.SessionToken,
+		CreateTime:      session.CreateTime,
+		Expiration:      session.Expiration,
+	}, nil
+}
+
+func (sts *STSService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	auth, ok := AuthStringFromContext(r.Context())
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	// 临时凭证不能再申请临时凭证
+	if auth.Session != nil {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	var duration time.Duration
+	if v := r.URL.Query().Get("durationSeconds"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			http.Error(w, "invalid durationSeconds", http.StatusBadRequest)
+			return
+		}
+		if seconds > int(MaxSessionDuration/time.Second) {
+			seconds = int(MaxSessionDuration / time.Second)
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+	var policy Policy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "invalid policy", http.StatusBadRequest)
+		return
+	}
+	if err := policy.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	credential, err := sts.CreateSession(auth.AccessKey, policy, duration)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(credential)
+}
+
+// 生成随机字符串
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,132 @@
+package aksk
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolicyAllow(t *testing.T) {
+	policy := Policy{AccessControlList: []Grant{
+		{Effect: "Allow", Resource: []string{"/bucket/*"}, Permission: []string{PermissionRead}},
+		{Effect: "Allow", Resource: []string{"/bucket/upload/*"}, Permission: []string{PermissionWrite}},
+		{Effect: "Deny", Resource: []string{"/bucket/secret"}, Permission: []string{PermissionFullControl}},
+	}}
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{"GET", "/bucket/object", true},
+		{"HEAD", "/bucket/object", true},
+		{"PUT", "/bucket/object", false},
+		{"PUT", "/bucket/upload/a.jpg", true},
+		{"GET", "/bucket/secret", false},
+		{"GET", "/other/object", false},
+		{"GET", "/bucket/", true},
+		{"GET", "/bucket/../other/secret", false},
+		{"GET", "/bucket/./secret", false},
+		{"GET", "/bucket//secret", false},
+		{"GET", "bucket/object", false},
+	}
+	for _, tt := range tests {
+		if got := policy.Allow(tt.method, tt.path); got != tt.want {
+			t.Errorf("Allow(%s, %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSTS(t *testing.T) {
+	sessions := NewMemorySessionStore()
+	verifier := newTestVerifier()
+	verifier.Sessions = sessions
+	sts := NewSTSService(sessions)
+	sts.Now = verifier.Now
+
+	mux := http.NewServeMux()
+	mux.Handle("/sts/sessionToken", sts)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	server := httptest.NewServer(verifier.Middleware(mux))
+	defer server.Close()
+
+	do := func(signer *BceSigner, method string, path string, body []byte) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+		req.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+		signer.Sign(req, 1800)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// 使用长期AK/SK申请临时凭证
+	policy, _ := json.Marshal(Policy{AccessControlList: []Grant{
+		{Effect: "Allow", Resource: []string{"/bucket/*"}, Permission: []string{PermissionRead}},
+	}})
+	resp := do(NewBceSigner(testAccessKey, testSecretKey), "POST", "/sts/sessionToken?durationSeconds=600", policy)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create session: code = %d", resp.StatusCode)
+	}
+	var credential Credential
+	if err := json.NewDecoder(resp.Body).Decode(&credential); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !credential.Expiration.Equal(testNow.Add(600 * time.Second)) {
+		t.Errorf("expiration = %v", credential.Expiration)
+	}
+
+	tests := []struct {
+		name   string
+		signer *BceSigner
+		method string
+		path   string
+		want   int
+	}{
+		{"allowed", credential.Signer(), "GET", "/bucket/object", http.StatusOK},
+		{"wrong resource", credential.Signer(), "GET", "/other/object", http.StatusForbidden},
+		{"wrong permission", credential.Signer(), "PUT", "/bucket/object", http.StatusForbidden},
+		{"unknown token", NewSessionBceSigner(credential.AccessKeyId, credential.SecretAccessKey, "bad"), "GET", "/bucket/object", http.StatusUnauthorized},
+		{"token without session ak", NewSessionBceSigner(testAccessKey, testSecretKey, credential.SessionToken), "GET", "/bucket/object", http.StatusUnauthorized},
+		{"temporary ak without token", NewBceSigner(credential.AccessKeyId, credential.SecretAccessKey), "GET", "/bucket/object", http.StatusUnauthorized},
+		{"nested sts", credential.Signer(), "POST", "/sts/sessionToken", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		resp := do(tt.signer, tt.method, tt.path, policy)
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: code = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+
+	// Session过期
+	verifier.Now = func() time.Time { return testNow.Add(601 * time.Second) }
+	req, _ := http.NewRequest("GET", server.URL+"/bucket/object", nil)
+	req.Header.Set("x-bce-date", testNow.Add(601*time.Second).Format(BceDateFormat))
+	credential.Signer().Sign(req, 1800)
+	if _, err := verifier.Verify(req); err != ErrSessionExpired {
+		t.Errorf("err = %v, want %v", err, ErrSessionExpired)
+	}
+}
+
+func TestSTSInvalidPolicy(t *testing.T) {
+	sts := NewSTSService(NewMemorySessionStore())
+	if _, err := sts.CreateSession(testAccessKey, Policy{}, time.Hour); err == nil {
+		t.Fatal("empty policy accepted")
+	}
+	credential, err := sts.CreateSession(testAccessKey, Policy{AccessControlList: []Grant{
+		{Effect: "Allow", Resource: []string{"*"}, Permission: []string{PermissionRead}},
+	}}, 100*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := credential.Expiration.Sub(credential.CreateTime); d != MaxSessionDuration {
+		t.Errorf("duration = %v, want %v", d, MaxSessionDuration)
+	}
+}
@@ -0,0 +1,105 @@
+package aksk
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//
+// 自动签名的http.RoundTripper
+//
+// 把SigningTransport设置为http.Client.Transport，所有请求在发送前自动设置签名时间并签名，业务代码不需要关心AK/SK。
+// Client和Server的时钟偏差太大时，签名会被Server判定为过期或者时间超前。此时Server返回的认证失败响应中，
+// Date Header就是Server的当前时间，SigningTransport据此修正本地时钟偏差，用新的时间重新签名，重试一次。
+//
+
+// Client和Server的时钟偏差超过这个值时，认为认证失败是时钟偏差引起的
+const DefaultClockSkewThreshold = time.Minute
+
+type SigningTransport struct {
+	Signer                    Signer
+	ExpirationPeriodInSeconds int
+	Base                      http.RoundTripper // 实际发送请求的Transport，为空时使用http.DefaultTransport
+	ClockSkewThreshold        time.Duration
+	Now                       func() time.Time
+
+	mu     sync.Mutex
+	offset time.Duration // Server时间 - 本地时间
+}
+
+func NewSigningTransport(signer Signer, expirationPeriodInSeconds int) *SigningTransport {
+	return &SigningTransport{
+		Signer:                    signer,
+		ExpirationPeriodInSeconds: expirationPeriodInSeconds,
+		ClockSkewThreshold:        DefaultClockSkewThreshold,
+		Now:                       time.Now,
+	}
+}
+
+func (transport *SigningTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	resp, err := transport.roundTrip(request, request.Body)
+	if err != nil || !transport.adjustClockSkew(resp) {
+		return resp, err
+	}
+
+	// 请求体无法重新读取时不重试
+	body := request.Body
+	if body != nil && body != http.NoBody {
+		if request.GetBody == nil {
+			return resp, nil
+		}
+		if body, err = request.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return transport.roundTrip(request, body)
+}
+
+// 复制请求，设置签名时间并签名，RoundTripper不能修改原始请求
+func (transport *SigningTransport) roundTrip(request *http.Request, body io.ReadCloser) (*http.Response, error) {
+	signed := request.Clone(request.Context())
+	signed.Body = body
+	signed.Header.Del("Authorization")
+	transport.mu.Lock()
+	now := transport.Now().Add(transport.offset)
+	transport.mu.Unlock()
+	transport.Signer.SetDate(signed, now)
+	transport.Signer.Sign(signed, transport.ExpirationPeriodInSeconds)
+
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(signed)
+}
+
+// 认证失败时，根据Server返回的Date修正时钟偏差，偏差超过阈值时返回true，需要重试
+func (transport *SigningTransport) adjustClockSkew(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusBadRequest &&
+		resp.StatusCode != http.StatusUnauthorized &&
+		resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return false
+	}
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	offset := serverTime.Sub(transport.Now())
+	skew := offset - transport.offset
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew <= transport.ClockSkewThreshold {
+		return false
+	}
+	transport.offset = offset
+	return true
+}
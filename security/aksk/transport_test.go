@@ -0,0 +1,96 @@
+package aksk
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Server时钟比Client快offset，返回的Date使用Server时间
+func newSkewedServer(t *testing.T, offset time.Duration, requests *int32) *httptest.Server {
+	verifier := newTestVerifier()
+	verifier.Now = func() time.Time { return time.Now().Add(offset) }
+	verifier.RequirePayloadDigest = false
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Header().Set("Date", verifier.Now().UTC().Format(http.TimeFormat))
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+func TestSigningTransport(t *testing.T) {
+	var requests int32
+	server := newSkewedServer(t, 0, &requests)
+	defer server.Close()
+
+	transport := NewSigningTransport(NewBceSigner(testAccessKey, testSecretKey), 1800)
+	client := &http.Client{Transport: transport}
+	req, _ := http.NewRequest("GET", server.URL+"/bucket/object?x=1", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || requests != 1 {
+		t.Fatalf("code = %d, requests = %d", resp.StatusCode, requests)
+	}
+	// 原始请求没有被修改
+	if req.Header.Get("Authorization") != "" || req.Header.Get("x-bce-date") != "" {
+		t.Errorf("original request modified: %v", req.Header)
+	}
+}
+
+func TestSigningTransportClockSkew(t *testing.T) {
+	for _, offset := range []time.Duration{time.Hour, -time.Hour} {
+		var requests int32
+		server := newSkewedServer(t, offset, &requests)
+
+		client := &http.Client{Transport: NewSigningTransport(NewBceSigner(testAccessKey, testSecretKey), 1800)}
+		resp, err := client.Post(server.URL+"/bucket/object", "text/plain", strings.NewReader(testPayload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != testPayload || requests != 2 {
+			t.Errorf("offset %v: code = %d, body = %q, requests = %d", offset, resp.StatusCode, body, requests)
+		}
+
+		// 修正后的时钟偏差继续生效，不再重试
+		requests = 0
+		resp, err = client.Get(server.URL + "/bucket/object")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || requests != 1 {
+			t.Errorf("offset %v: code = %d, requests = %d", offset, resp.StatusCode, requests)
+		}
+		server.Close()
+	}
+}
+
+func TestSigningTransportNoRetry(t *testing.T) {
+	var requests int32
+	server := newSkewedServer(t, 0, &requests)
+	defer server.Close()
+
+	// 时钟没有偏差，认证失败不重试
+	client := &http.Client{Transport: NewSigningTransport(NewBceSigner(testAccessKey, "wrong"), 1800)}
+	resp, err := client.Get(server.URL + "/bucket/object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || requests != 1 {
+		t.Fatalf("code = %d, requests = %d", resp.StatusCode, requests)
+	}
+}
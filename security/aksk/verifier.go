@@ -0,0 +1,368 @@
+package aksk
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Server端校验认证字符串
+//
+// 认证字符串的格式为：bce-signer-v1/{accessKeyId}/{timestamp}/{expirationPeriodInSeconds}/{signedHeaders}/{signature}
+// Server收到请求后，按以下步骤校验：
+// 1)解析认证字符串，根据AK查找对应的SK
+// 2)只保留signedHeaders中列出的Header，按与Client相同的规则重建规范请求，生成签名
+// 3)使用常量时间比较两个签名，防止时序攻击
+// 4)检查x-bce-date + expirationPeriodInSeconds是否已经过期，x-bce-date超前Server时间太多的请求也要拒绝
+//
+// 注意：校验失败时，不要把具体原因返回给调用方，否则可以借此枚举有效的AK。
+//
+
+var (
+	ErrMissingAuthorization = errors.New("aksk: missing authorization")
+	ErrMalformedAuthString  = errors.New("aksk: malformed authorization string")
+	ErrMissingDate          = errors.New("aksk: missing x-bce-date")
+	ErrInvalidAccessKey     = errors.New("aksk: invalid access key")
+	ErrSignatureMismatch    = errors.New("aksk: signature does not match")
+	ErrRequestExpired       = errors.New("aksk: request expired")
+	ErrRequestNotYetValid   = errors.New("aksk: request timestamp is in the future")
+	ErrExpirationTooLong    = errors.New("aksk: expiration period too long")
+	ErrHeaderNotSigned      = errors.New("aksk: required header not signed")
+	ErrMissingPayloadDigest = errors.New("aksk: missing payload digest")
+)
+
+const (
+	DefaultClockSkew                    = 5 * time.Minute
+	DefaultMaxExpirationPeriodInSeconds = 7 * 24 * 3600
+)
+
+// 根据AK查找SK，AK不存在时返回ErrInvalidAccessKey
+type CredentialStore interface {
+	GetSecretKey(accessKey string) (secretKey string, err error)
+}
+
+// 基于内存的CredentialStore
+type MemoryCredentialStore struct {
+	sync.RWMutex
+	keys map[string]string
+}
+
+func NewMemoryCredentialStore() *MemoryCredentialStore {
+	return &MemoryCredentialStore{
+		keys: make(map[string]string),
+	}
+}
+
+func (store *MemoryCredentialStore) Set(accessKey string, secretKey string) {
+	store.Lock()
+	defer store.Unlock()
+	store.keys[accessKey] = secretKey
+}
+
+func (store *MemoryCredentialStore) GetSecretKey(accessKey string) (string, error) {
+	store.RLock()
+	defer store.RUnlock()
+	secretKey, ok := store.keys[accessKey]
+	if !ok {
+		return "", ErrInvalidAccessKey
+	}
+	return secretKey, nil
+}
+
+// 解析后的认证字符串
+type AuthString struct {
+	AccessKey                 string
+	Timestamp                 time.Time
+	ExpirationPeriodInSeconds int
+	SignedHeaders             []string
+	Signature                 string
+	Session                   *Session // 使用STS临时凭证时不为空
+
+	authStringPrefix string
+}
+
+// 解析认证字符串
+func ParseAuthString(authString string) (*AuthString, error) {
+	parts := strings.Split(authString, "/")
+	if len(parts) != 6 || parts[0] != "bce-signer-v1" {
+		return nil, ErrMalformedAuthString
+	}
+	timestamp, err := time.Parse(BceDateFormat, parts[2])
+	if err != nil {
+		return nil, ErrMalformedAuthString
+	}
+	expiration, err := strconv.Atoi(parts[3])
+	if err != nil || expiration <= 0 {
+		return nil, ErrMalformedAuthString
+	}
+	if parts[1] == "" || parts[4] == "" || parts[5] == "" {
+		return nil, ErrMalformedAuthString
+	}
+	return &AuthString{
+		AccessKey:                 parts[1],
+		Timestamp:                 timestamp,
+		ExpirationPeriodInSeconds: expiration,
+		SignedHeaders:             strings.Split(parts[4], ";"),
+		Signature:                 parts[5],
+		authStringPrefix:          strings.Join(parts[:4], "/"),
+	}, nil
+}
+
+// 签名校验器
+type Verifier struct {
+	Store                        CredentialStore
+	Sessions                     SessionStore     // STS临时授权的Session，为空时不接受临时凭证
+	Now                          func() time.Time // 获取当前时间，便于测试时替换
+	ClockSkew                    time.Duration    // 允许Client时间超前Server的最大偏差
+	MaxExpirationPeriodInSeconds int              // 允许的最长有效期
+	RequiredSignedHeaders        []string         // 必须参与签名的Header，小写
+	RequirePayloadDigest         bool             // 有请求体时必须携带x-bce-content-sha256
+	Nonces                       NonceStore       // 防重放，为空时不检查x-bce-nonce
+	RequireNonce                 bool             // 必须携带x-bce-nonce，需要设置Nonces
+
+	// 签名不一致时调用，参数为Server端生成的规范请求，用于和Client对比，为空时不调用
+	OnSignatureMismatch func(request *http.Request, auth *AuthString, canonicalRequest string)
+}
+
+func NewVerifier(store CredentialStore) *Verifier {
+	return &Verifier{
+		Store:                        store,
+		Now:                          time.Now,
+		ClockSkew:                    DefaultClockSkew,
+		MaxExpirationPeriodInSeconds: DefaultMaxExpirationPeriodInSeconds,
+		RequiredSignedHeaders:        []string{"host"},
+	}
+}
+
+// 校验请求的认证字符串，成功时返回解析后的认证字符串
+// 认证字符串可以放在Authorization Header中，也可以放在URL的authorization参数中(预签名URL)
+func (verifier *Verifier) Verify(request *http.Request) (*AuthString, error) {
+	var timestamp string
+	authorization := request.Header.Get("Authorization")
+	if authorization != "" {
+		// 有效期从x-bce-date开始计算，它必须参与签名
+		timestamp = request.Header.Get("x-bce-date")
+		if timestamp == "" {
+			return nil, ErrMissingDate
+		}
+	} else {
+		// 预签名URL没有x-bce-date，有效期从认证字符串中的时间开始计算
+		authorization = request.URL.Query().Get("authorization")
+		if authorization == "" {
+			return nil, ErrMissingAuthorization
+		}
+	}
+	auth, err := ParseAuthString(authorization)
+	if err != nil {
+		return nil, err
+	}
+	if timestamp == "" {
+		timestamp = auth.Timestamp.Format(BceDateFormat)
+	}
+	if auth.ExpirationPeriodInSeconds > verifier.MaxExpirationPeriodInSeconds {
+		return nil, ErrExpirationTooLong
+	}
+	for _, k := range verifier.RequiredSignedHeaders {
+		if !auth.signed(k) {
+			return nil, ErrHeaderNotSigned
+		}
+	}
+	// 携带请求体摘要时，摘要必须参与签名
+	payloadDigest := request.Header.Get(ContentSha256Header)
+	if payloadDigest != "" && !auth.signed(ContentSha256Header) {
+		return nil, ErrHeaderNotSigned
+	}
+	if payloadDigest == "" && verifier.RequirePayloadDigest && request.ContentLength != 0 {
+		return nil, ErrMissingPayloadDigest
+	}
+	// 携带nonce时，nonce必须参与签名
+	nonce := request.Header.Get(NonceHeader)
+	if nonce != "" && !auth.signed(NonceHeader) {
+		return nil, ErrHeaderNotSigned
+	}
+	if nonce == "" && verifier.RequireNonce {
+		return nil, ErrMissingNonce
+	}
+
+	// 携带SessionToken时使用STS临时凭证
+	sessionToken := request.Header.Get(SecurityTokenHeader)
+	if sessionToken == "" {
+		sessionToken = request.URL.Query().Get(SecurityTokenHeader)
+	}
+	var secretKey string
+	if sessionToken != "" {
+		if verifier.Sessions == nil {
+			return nil, ErrInvalidSessionToken
+		}
+		auth.Session, err = verifier.Sessions.Get(sessionToken)
+		if err != nil {
+			return nil, err
+		}
+		if auth.Session.AccessKey != auth.AccessKey {
+			return nil, ErrInvalidSessionToken
+		}
+		// 申请临时凭证的长期AK被禁用或删除后，临时凭证随之失效
+		if _, err := verifier.Store.GetSecretKey(auth.Session.ParentAccessKey); err != nil {
+			if err == ErrInvalidAccessKey {
+				return nil, ErrInvalidSessionToken
+			}
+			return nil, err
+		}
+		secretKey = auth.Session.SecretKey
+	} else {
+		secretKey, err = verifier.Store.GetSecretKey(auth.AccessKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	signature, canonicalRequest, err := verifier.buildSignature(request, auth, timestamp, secretKey)
+	if err == nil && subtle.ConstantTimeCompare([]byte(signature), []byte(auth.Signature)) != 1 {
+		err = ErrSignatureMismatch
+	}
+	if err == ErrSignatureMismatch && verifier.OnSignatureMismatch != nil {
+		verifier.OnSignatureMismatch(request, auth, canonicalRequest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 签名正确后再检查有效期，避免泄露过期信息给伪造的请求
+	expireAt := auth.Timestamp.Add(time.Duration(auth.ExpirationPeriodInSeconds) * time.Second)
+	now := verifier.Now()
+	if auth.Timestamp.After(now.Add(verifier.ClockSkew)) {
+		return nil, ErrRequestNotYetValid
+	}
+	if now.After(expireAt) {
+		return nil, ErrRequestExpired
+	}
+	if nonce != "" && verifier.Nonces != nil {
+		if err := verifier.checkNonce(auth, nonce, now); err != nil {
+			return nil, err
+		}
+	}
+
+	// 临时凭证需要检查Session有效期和权限策略
+	if auth.Session != nil {
+		if now.After(auth.Session.Expiration) {
+			return nil, ErrSessionExpired
+		}
+		if !auth.Session.Policy.Allow(request.Method, request.URL.Path) {
+			return nil, ErrAccessDenied
+		}
+	}
+
+	// 记录长期AK的最后使用时间
+	if recorder, ok := verifier.Store.(UsageRecorder); ok && auth.Session == nil {
+		recorder.RecordUsage(auth.AccessKey, now)
+	}
+
+	// 请求体在后续读取时校验，不一致时Read返回ErrPayloadMismatch
+	if payloadDigest != "" {
+		verifyPayload(request, payloadDigest)
+	}
+	return auth, nil
+}
+
+// 检查nonce是否重复，开启防重放时x-bce-date与Server时间的偏差必须在ClockSkew之内
+func (verifier *Verifier) checkNonce(auth *AuthString, nonce string, now time.Time) error {
+	if auth.Timestamp.Before(now.Add(-verifier.ClockSkew)) {
+		return ErrRequestExpired
+	}
+	ttl := auth.Timestamp.Add(verifier.ClockSkew).Sub(now)
+	ok, err := verifier.Nonces.Add(auth.AccessKey+"/"+nonce, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNonceReused
+	}
+	return nil
+}
+
+// 按Client相同的规则生成签名
+func (verifier *Verifier) buildSignature(request *http.Request, auth *AuthString, timestamp string, secretKey string) (signature string, canonicalRequest string, err error) {
+	// 只保留签名的Header，Server端的Host不在request.Header中，需要补回
+	signed := &http.Request{
+		Method: request.Method,
+		URL:    request.URL,
+		Header: make(http.Header),
+	}
+	for _, k := range auth.SignedHeaders {
+		if k == "host" && request.Header.Get("Host") == "" {
+			signed.Header.Set("Host", request.Host)
+			continue
+		}
+		if v, ok := request.Header[http.CanonicalHeaderKey(k)]; ok {
+			signed.Header[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	// Server端不关心Client的选择策略，按signedHeaders重建
+	signer := NewBceSigner(auth.AccessKey, secretKey)
+	signer.HeaderPolicy = HeaderList(auth.SignedHeaders...)
+	authStringPrefix, signingKey := signer.buildSigningKey(timestamp, auth.ExpirationPeriodInSeconds)
+	canonicalRequest, signedHeaders := signer.buildCanonicalRequest(signed)
+	// x-bce-date与认证字符串中的时间不一致，或者Client声明签名的Header在请求中缺失
+	if authStringPrefix != auth.authStringPrefix ||
+		signedHeaders != strings.Join(auth.SignedHeaders, ";") {
+		return "", canonicalRequest, ErrSignatureMismatch
+	}
+	return signer.buildSignature(signingKey, canonicalRequest), canonicalRequest, nil
+}
+
+// 检查Header是否参与了签名
+func (auth *AuthString) signed(key string) bool {
+	for _, k := range auth.SignedHeaders {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+type authStringKey struct{}
+
+// 取出中间件校验通过的认证字符串
+func AuthStringFromContext(ctx context.Context) (*AuthString, bool) {
+	auth, ok := ctx.Value(authStringKey{}).(*AuthString)
+	return auth, ok
+}
+
+// 校验签名的中间件
+// 校验失败统一返回401，不暴露具体原因；临时凭证超出权限返回403；CredentialStore自身出错时返回500
+// 请求体摘要在next读取请求体时校验，不一致时读取返回ErrPayloadMismatch，由next处理；没有读完请求体时检查Close的返回值
+func (verifier *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, err := verifier.Verify(r)
+		if err != nil {
+			if err == ErrAccessDenied {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			} else if isAuthError(err) {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			} else {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authStringKey{}, auth)))
+	})
+}
+
+// 是否为认证失败，其余错误来自CredentialStore
+func isAuthError(err error) bool {
+	switch err {
+	case ErrMissingAuthorization, ErrMalformedAuthString, ErrMissingDate, ErrInvalidAccessKey,
+		ErrSignatureMismatch, ErrRequestExpired, ErrRequestNotYetValid, ErrExpirationTooLong,
+		ErrInvalidSessionToken, ErrSessionExpired, ErrHeaderNotSigned, ErrMissingPayloadDigest,
+		ErrMissingNonce, ErrNonceReused:
+		return true
+	}
+	return false
+}
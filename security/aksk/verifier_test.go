@@ -0,0 +1,215 @@
+package aksk
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "00862f7e445143478fa2b1483874d365"
+	testSecretKey = "31dab24594ca410d9ecd3d65874938cb"
+)
+
+var testNow = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestVerifier() *Verifier {
+	store := NewMemoryCredentialStore()
+	store.Set(testAccessKey, testSecretKey)
+	verifier := NewVerifier(store)
+	verifier.Now = func() time.Time { return testNow }
+	return verifier
+}
+
+func newSignedRequest(t *testing.T, date time.Time, expirationPeriodInSeconds int) *http.Request {
+	req, err := http.NewRequest("GET", "http://bj.bcebos.com/bucket/object?acl&max=10", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Host", "bj.bcebos.com")
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("x-bce-date", date.UTC().Format(BceDateFormat))
+	NewBceSigner(testAccessKey, testSecretKey).Sign(req, expirationPeriodInSeconds)
+	return req
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	req := newSignedRequest(t, testNow, 1800)
+	auth, err := newTestVerifier().Verify(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.AccessKey != testAccessKey {
+		t.Errorf("access key = %q", auth.AccessKey)
+	}
+	if got := strings.Join(auth.SignedHeaders, ";"); got != "content-type;host;x-bce-date" {
+		t.Errorf("signed headers = %q", got)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(req *http.Request)
+	}{
+		{"path", func(req *http.Request) { req.URL.Path = "/bucket/other" }},
+		{"query", func(req *http.Request) { req.URL.RawQuery = "acl&max=100" }},
+		{"signed header", func(req *http.Request) { req.Header.Set("Content-Type", "text/html") }},
+		{"method", func(req *http.Request) { req.Method = "DELETE" }},
+	}
+	for _, tt := range tests {
+		req := newSignedRequest(t, testNow, 1800)
+		tt.tamper(req)
+		if _, err := newTestVerifier().Verify(req); err != ErrSignatureMismatch {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, ErrSignatureMismatch)
+		}
+	}
+}
+
+func TestVerifyUnsignedHeaderAdded(t *testing.T) {
+	req := newSignedRequest(t, testNow, 1800)
+	req.Header.Set("User-Agent", "proxy")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	if _, err := newTestVerifier().Verify(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyMissingSignedHeader(t *testing.T) {
+	req := newSignedRequest(t, testNow, 1800)
+	req.Header.Del("Content-Type")
+	if _, err := newTestVerifier().Verify(req); err != ErrSignatureMismatch {
+		t.Fatalf("err = %v, want %v", err, ErrSignatureMismatch)
+	}
+}
+
+func TestVerifyMissingDate(t *testing.T) {
+	req := newSignedRequest(t, testNow, 1800)
+	req.Header.Del("x-bce-date")
+	if _, err := newTestVerifier().Verify(req); err != ErrMissingDate {
+		t.Fatalf("err = %v, want %v", err, ErrMissingDate)
+	}
+}
+
+func TestVerifyUnknownAccessKey(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://bj.bcebos.com/bucket/object", nil)
+	req.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+	NewBceSigner("unknown", testSecretKey).Sign(req, 1800)
+	if _, err := newTestVerifier().Verify(req); err != ErrInvalidAccessKey {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidAccessKey)
+	}
+}
+
+func TestVerifyMalformedAuthString(t *testing.T) {
+	for _, authorization := range []string{
+		"",
+		"bce-signer-v1/ak",
+		"bce-signer-v2/ak/2020-05-01T12:00:00Z/1800/host/abc",
+		"bce-signer-v1/ak/2020-05-01 12:00:00/1800/host/abc",
+		"bce-signer-v1/ak/2020-05-01T12:00:00Z/-1/host/abc",
+		"bce-signer-v1/ak/2020-05-01T12:00:00Z/1800//abc",
+	} {
+		req := newSignedRequest(t, testNow, 1800)
+		req.Header.Set("Authorization", authorization)
+		_, err := newTestVerifier().Verify(req)
+		if err != ErrMalformedAuthString && err != ErrMissingAuthorization {
+			t.Errorf("%q: err = %v", authorization, err)
+		}
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	req := newSignedRequest(t, testNow.Add(-time.Hour), 1800)
+	if _, err := newTestVerifier().Verify(req); err != ErrRequestExpired {
+		t.Fatalf("err = %v, want %v", err, ErrRequestExpired)
+	}
+}
+
+func TestVerifyFutureTimestamp(t *testing.T) {
+	req := newSignedRequest(t, testNow.AddDate(50, 0, 0), 1)
+	if _, err := newTestVerifier().Verify(req); err != ErrRequestNotYetValid {
+		t.Fatalf("err = %v, want %v", err, ErrRequestNotYetValid)
+	}
+
+	// 允许范围内的时钟偏差
+	req = newSignedRequest(t, testNow.Add(time.Minute), 1800)
+	if _, err := newTestVerifier().Verify(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyExpirationTooLong(t *testing.T) {
+	req := newSignedRequest(t, testNow, DefaultMaxExpirationPeriodInSeconds+1)
+	if _, err := newTestVerifier().Verify(req); err != ErrExpirationTooLong {
+		t.Fatalf("err = %v, want %v", err, ErrExpirationTooLong)
+	}
+}
+
+func TestVerifyHostFromRequest(t *testing.T) {
+	// Server端收到的请求中，Host不在Header里
+	req := newSignedRequest(t, testNow, 1800)
+	req.Header.Del("Host")
+	req.Host = "bj.bcebos.com"
+	if _, err := newTestVerifier().Verify(req); err != nil {
+		t.Fatal(err)
+	}
+
+	req.Host = "gz.bcebos.com"
+	if _, err := newTestVerifier().Verify(req); err != ErrSignatureMismatch {
+		t.Fatalf("err = %v, want %v", err, ErrSignatureMismatch)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) GetSecretKey(accessKey string) (string, error) {
+	return "", errors.New("db connection refused")
+}
+
+func TestMiddleware(t *testing.T) {
+	verifier := newTestVerifier()
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, ok := AuthStringFromContext(r.Context())
+		if !ok {
+			t.Error("auth string not in context")
+			return
+		}
+		w.Write([]byte(auth.AccessKey))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(t, testNow, 1800))
+	if rec.Code != http.StatusOK || rec.Body.String() != testAccessKey {
+		t.Fatalf("code = %d, body = %q", rec.Code, rec.Body.String())
+	}
+
+	// 未知AK和签名错误的响应完全一致
+	unknown, _ := http.NewRequest("GET", "http://bj.bcebos.com/bucket/object", nil)
+	unknown.Header.Set("x-bce-date", testNow.Format(BceDateFormat))
+	NewBceSigner("unknown", testSecretKey).Sign(unknown, 1800)
+	tampered := newSignedRequest(t, testNow, 1800)
+	tampered.URL.Path = "/bucket/other"
+	var bodies []string
+	for _, req := range []*http.Request{unknown, tampered} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("code = %d, want 401", rec.Code)
+		}
+		bodies = append(bodies, rec.Body.String())
+	}
+	if bodies[0] != bodies[1] {
+		t.Errorf("responses differ: %q vs %q", bodies[0], bodies[1])
+	}
+
+	// CredentialStore出错返回500，且不暴露内部信息
+	verifier.Store = failingStore{}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(t, testNow, 1800))
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "db") {
+		t.Fatalf("code = %d, body = %q", rec.Code, rec.Body.String())
+	}
+}
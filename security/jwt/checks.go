@@ -0,0 +1,105 @@
+package jwt
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+//
+// 自定义声明的校验
+//
+// 业务的声明定义为结构体，嵌入RegisteredClaims，签发和校验都直接使用结构体，不需要从MapClaims中取值再做类型断言：
+//
+//	type UserClaims struct {
+//		jwt.RegisteredClaims
+//		TenantID string   `json:"tid"`
+//		Roles    []string `json:"roles"`
+//	}
+//
+// 校验规则有两种，签发前和校验签名后都会执行，不满足规则的Token签发不出来，也不会通过校验：
+// 1)结构体自己的Valid方法，覆盖RegisteredClaims.Valid，适合和结构体绑定的规则(字段格式、字段之间的关系)
+// 2)ClaimsCheck，配置在TokenIssuer.Checks和TokenValidator.Checks中，适合按服务配置的规则(必须的角色、最长有效期)
+//
+// Middleware.Checks按接口配置，不满足时返回403 insufficient_scope，而不是401。
+//
+
+var (
+	ErrMissingRole     = errors.New("jwt: missing required role")
+	ErrInvalidTenant   = errors.New("jwt: invalid tenant id")
+	ErrLifetimeTooLong = errors.New("jwt: token lifetime exceeds the maximum")
+)
+
+// 校验声明，返回的错误原样返回给调用方
+type ClaimsCheck func(claims Claims) error
+
+// 包含角色的声明
+type RoleClaims interface {
+	Claims
+	GetRoles() []string
+}
+
+// 包含租户的声明
+type TenantClaims interface {
+	Claims
+	GetTenantID() string
+}
+
+// 执行结构体的Valid和checks
+func checkClaims(claims Claims, checks []ClaimsCheck) error {
+	if err := claims.Valid(); err != nil {
+		return err
+	}
+	for _, check := range checks {
+		if err := check(claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 必须包含所有的角色，声明没有实现RoleClaims时返回ErrMissingRole
+func RequireRoles(roles ...string) ClaimsCheck {
+	return func(claims Claims) error {
+		roleClaims, ok := claims.(RoleClaims)
+		if !ok {
+			return ErrMissingRole
+		}
+		granted := make(map[string]bool)
+		for _, role := range roleClaims.GetRoles() {
+			granted[role] = true
+		}
+		for _, role := range roles {
+			if !granted[role] {
+				return ErrMissingRole
+			}
+		}
+		return nil
+	}
+}
+
+// 租户ID必须完整匹配pattern，声明没有实现TenantClaims时返回ErrInvalidTenant
+//
+//	jwt.TenantIDPattern(`[a-z0-9]{8}`)
+func TenantIDPattern(pattern string) ClaimsCheck {
+	re := regexp.MustCompile(`^(?:` + pattern + `)$`)
+	return func(claims Claims) error {
+		tenantClaims, ok := claims.(TenantClaims)
+		if !ok || !re.MatchString(tenantClaims.GetTenantID()) {
+			return ErrInvalidTenant
+		}
+		return nil
+	}
+}
+
+// exp - iat不能超过maxLifetime，防止签发方配置错误签发出长期有效的Token；缺少exp或iat时无法判断，同样返回错误
+func MaxLifetime(maxLifetime time.Duration) ClaimsCheck {
+	return func(claims Claims) error {
+		registered := claims.Registered()
+		if registered.ExpiresAt == 0 || registered.IssuedAt == 0 ||
+			registered.ExpiresAt-registered.IssuedAt > int64(maxLifetime/time.Second) {
+			return ErrLifetimeTooLong
+		}
+		return nil
+	}
+}
@@ -0,0 +1,134 @@
+package jwt
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var errMissingTenant = errors.New("tenant required")
+
+type tenantClaims struct {
+	RegisteredClaims
+	TenantID string   `json:"tid"`
+	Roles    []string `json:"roles"`
+}
+
+func (claims *tenantClaims) GetRoles() []string {
+	return claims.Roles
+}
+
+func (claims *tenantClaims) GetTenantID() string {
+	return claims.TenantID
+}
+
+// 结构体自己的校验规则
+func (claims *tenantClaims) Valid() error {
+	if claims.TenantID == "" {
+		return errMissingTenant
+	}
+	return nil
+}
+
+func TestClaimsChecks(t *testing.T) {
+	registered := RegisteredClaims{IssuedAt: testNow.Unix(), ExpiresAt: testNow.Add(time.Hour).Unix()}
+	claims := &tenantClaims{RegisteredClaims: registered, TenantID: "t0000001", Roles: []string{"reader", "writer"}}
+	cases := []struct {
+		name   string
+		check  ClaimsCheck
+		claims Claims
+		err    error
+	}{
+		{"roles", RequireRoles("reader", "writer"), claims, nil},
+		{"no roles required", RequireRoles(), claims, nil},
+		{"missing role", RequireRoles("reader", "admin"), claims, ErrMissingRole},
+		{"no role claims", RequireRoles("reader"), &registered, ErrMissingRole},
+		{"tenant", TenantIDPattern(`t[0-9]{7}`), claims, nil},
+		{"tenant anchored", TenantIDPattern(`t[0-9]{3}`), claims, ErrInvalidTenant},
+		{"tenant alternation anchored", TenantIDPattern(`x|t0`), claims, ErrInvalidTenant},
+		{"no tenant claims", TenantIDPattern(`.*`), &registered, ErrInvalidTenant},
+		{"lifetime", MaxLifetime(time.Hour), claims, nil},
+		{"lifetime too long", MaxLifetime(time.Hour - time.Second), claims, ErrLifetimeTooLong},
+		{"no exp", MaxLifetime(time.Hour), &RegisteredClaims{IssuedAt: testNow.Unix()}, ErrLifetimeTooLong},
+	}
+	for _, c := range cases {
+		if err := c.check(c.claims); err != c.err {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.err)
+		}
+	}
+}
+
+func TestIssueAndValidateTypedClaims(t *testing.T) {
+	issuer := newTestIssuer()
+	issuer.Checks = []ClaimsCheck{TenantIDPattern(`t[0-9]{7}`), MaxLifetime(time.Hour)}
+	validator := newTestValidator()
+	validator.Checks = []ClaimsCheck{TenantIDPattern(`t[0-9]{7}`), MaxLifetime(time.Hour)}
+
+	tokenString, err := issuer.Issue(&tenantClaims{TenantID: "t0000001", Roles: []string{"reader"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &tenantClaims{}
+	if _, err := validator.ValidateWithClaims(tokenString, claims); err != nil || claims.TenantID != "t0000001" || claims.Roles[0] != "reader" {
+		t.Errorf("claims = %+v, err = %v", claims, err)
+	}
+
+	// 签发前校验
+	if _, err := issuer.Issue(&tenantClaims{}); err != errMissingTenant {
+		t.Errorf("Valid: err = %v", err)
+	}
+	if _, err := issuer.Issue(&tenantClaims{TenantID: "bad"}); err != ErrInvalidTenant {
+		t.Errorf("tenant: err = %v", err)
+	}
+	issuer.TTL = 2 * time.Hour
+	if _, err := issuer.Issue(&tenantClaims{TenantID: "t0000001"}); err != ErrLifetimeTooLong {
+		t.Errorf("lifetime: err = %v", err)
+	}
+
+	// 签发方没有配置规则时，校验方同样拒绝
+	issuer.Checks = nil
+	long, _ := issuer.Issue(&tenantClaims{TenantID: "t0000001"})
+	if _, err := validator.ValidateWithClaims(long, &tenantClaims{}); err != ErrLifetimeTooLong {
+		t.Errorf("validate lifetime: err = %v", err)
+	}
+	plain, _ := newTestIssuer().IssueSubject("alice")
+	if _, err := validator.ValidateWithClaims(plain, &tenantClaims{}); err != errMissingTenant {
+		t.Errorf("validate Valid: err = %v", err)
+	}
+}
+
+func TestMiddlewareChecks(t *testing.T) {
+	issuer := newTestIssuer()
+	reader, _ := issuer.Issue(&tenantClaims{TenantID: "t0000001", Roles: []string{"reader"}})
+	admin, _ := issuer.Issue(&tenantClaims{TenantID: "t0000001", Roles: []string{"reader", "admin"}})
+
+	m := NewMiddleware(newTestValidator())
+	m.NewClaims = func() Claims { return &tenantClaims{} }
+	m.Checks = []ClaimsCheck{RequireRoles("admin")}
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		w.Write([]byte(claims.(*tenantClaims).TenantID))
+	}))
+
+	for _, c := range []struct {
+		token  string
+		status int
+	}{
+		{admin, http.StatusOK},
+		{reader, http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+c.token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Errorf("status = %d, want %d", w.Code, c.status)
+		}
+		if c.status == http.StatusForbidden &&
+			w.Header().Get("WWW-Authenticate") != `Bearer error="insufficient_scope", error_description="the access token has insufficient privileges"` {
+			t.Errorf("challenge = %q", w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+//
+// JWT(JSON Web Token)
+//
+// JWT由三部分组成，用点(.)连接：Header.Payload.Signature，每部分都是base64url编码：
+// 1)Header：签名算法(alg)、类型(typ)、密钥标识(kid)
+// 2)Payload：声明(claims)，包括标准中注册的声明和业务自定义的声明
+// 3)Signature：对Header.Payload的签名
+//
+// 标准中注册的声明(建议但不强制使用)：
+//   iss: jwt签发者
+//   sub: jwt所面向的用户
+//   aud: 接收jwt的一方
+//   exp: jwt的过期时间，这个过期时间必须要大于签发时间
+//   nbf: 定义在什么时间之前，该jwt都是不可用的.
+//   iat: jwt的签发时间
+//   jti: jwt的唯一身份标识，主要用来作为一次性token,从而回避重放攻击。
+//
+// 注意：Payload只是base64编码，任何人都可以解码，不要放入敏感信息。
+//
+// 参考 RFC 7519 https://tools.ietf.org/html/rfc7519
+//
+
+// 签名和解析使用github.com/dgrijalva/jwt-go，这里导出常用的类型，调用方不需要再引入jwt-go
+type (
+	Token         = jwtgo.Token
+	Keyfunc       = jwtgo.Keyfunc
+	SigningMethod = jwtgo.SigningMethod
+)
+
+var (
+	SigningMethodHS256 = jwtgo.SigningMethodHS256
+	SigningMethodHS384 = jwtgo.SigningMethodHS384
+	SigningMethodHS512 = jwtgo.SigningMethodHS512
+)
+
+// 声明，自定义的声明结构体嵌入RegisteredClaims即可实现该接口
+//
+//	type UserClaims struct {
+//		jwt.RegisteredClaims
+//		Roles []string `json:"roles"`
+//	}
+type Claims interface {
+	jwtgo.Claims
+	Registered() *RegisteredClaims
+}
+
+// 标准中注册的声明，时间为Unix时间戳(秒)，为0时不出现在Payload中
+type RegisteredClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+func (claims *RegisteredClaims) Registered() *RegisteredClaims {
+	return claims
+}
+
+// 实现jwtgo.Claims，时间相关的校验由TokenValidator完成，这里不做校验
+func (claims RegisteredClaims) Valid() error {
+	return nil
+}
+
+// aud可以是字符串，也可以是字符串数组，只有一个接收方时编码为字符串
+type Audience []string
+
+func (aud Audience) MarshalJSON() ([]byte, error) {
+	if len(aud) == 1 {
+		return json.Marshal(aud[0])
+	}
+	return json.Marshal([]string(aud))
+}
+
+func (aud *Audience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*aud = Audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return errors.New("jwt: aud must be a string or an array of strings")
+	}
+	*aud = ss
+	return nil
+}
+
+// 是否包含指定的接收方
+func (aud Audience) Contains(audience string) bool {
+	for _, a := range aud {
+		if a == audience {
+			return true
+		}
+	}
+	return false
+}
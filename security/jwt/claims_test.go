@@ -0,0 +1,36 @@
+package jwt
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAudienceJSON(t *testing.T) {
+	tests := []struct {
+		aud  Audience
+		json string
+	}{
+		{Audience{"api"}, `"api"`},
+		{Audience{"api", "web"}, `["api","web"]`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.aud)
+		if err != nil || string(data) != tt.json {
+			t.Errorf("marshal %v = %s, %v", tt.aud, data, err)
+		}
+		var aud Audience
+		if err := json.Unmarshal([]byte(tt.json), &aud); err != nil || !reflect.DeepEqual(aud, tt.aud) {
+			t.Errorf("unmarshal %s = %v, %v", tt.json, aud, err)
+		}
+	}
+	var aud Audience
+	if err := json.Unmarshal([]byte(`123`), &aud); err == nil {
+		t.Error("number accepted as aud")
+	}
+
+	data, _ := json.Marshal(&RegisteredClaims{Subject: "u"})
+	if string(data) != `{"sub":"u"}` {
+		t.Errorf("empty claims omitted: %s", data)
+	}
+}
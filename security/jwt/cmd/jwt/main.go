@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"paradigm/security/jwt"
+)
+
+//
+// JWT调试工具，离线解析和校验Token，不需要把生产环境的Token粘贴到jwt.io
+//
+// 解析：输出Header、声明和exp/nbf/iat的时间，不校验签名
+//   jwt decode TOKEN
+// 校验：使用HMAC密钥、PEM公钥或本地的JWKS文件校验签名和声明，无效时退出码为1
+//   jwt verify -secret @secret.txt -iss paradigm -aud api TOKEN
+//   jwt verify -key public.pem TOKEN
+//   jwt verify -jwks jwks.json TOKEN
+// 签发：从JSON文件读取声明，签发测试用的Token
+//   jwt mint -secret @secret.txt -claims claims.json -ttl 1h
+//   jwt mint -key private.pem -kid k1 -claims claims.json
+//
+// TOKEN为"-"时从标准输入读取；加密的Token(JWE)使用-decrypt指定私钥解密。
+//
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "decode":
+		err = decode(os.Args[2:], os.Stdout)
+	case "verify":
+		var valid bool
+		valid, err = verify(os.Args[2:], os.Stdout)
+		if err == nil && !valid {
+			os.Exit(1)
+		}
+	case "mint":
+		err = mint(os.Args[2:], os.Stdout)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  jwt decode [-decrypt private.pem] TOKEN
+  jwt verify (-secret SECRET|@file | -key public.pem | -jwks jwks.json) [-alg HS256,...] [-iss ISS] [-aud AUD] [-leeway 1m] [-decrypt private.pem] TOKEN
+  jwt mint -claims claims.json (-secret SECRET|@file [-alg HS256] | -key private.pem [-kid KID]) [-ttl 15m] [-iss ISS] [-aud a,b] [-encrypt public.pem]`)
+}
+
+// 测试时替换
+var now = time.Now
+
+var hmacMethods = map[string]jwt.SigningMethod{
+	"HS256": jwt.SigningMethodHS256,
+	"HS384": jwt.SigningMethodHS384,
+	"HS512": jwt.SigningMethodHS512,
+}
+
+func decode(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	decrypt := fs.String("decrypt", "", "private key PEM for encrypted tokens")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("decode: need exactly one token")
+	}
+	tokenString, err := readToken(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if tokenString, err = decryptToken(w, tokenString, *decrypt); err != nil {
+		return err
+	}
+	claims, err := writeToken(w, tokenString)
+	if err != nil {
+		return err
+	}
+	writeStatus(w, claims)
+	fmt.Fprintln(w, "signature:  not verified")
+	return nil
+}
+
+func verify(args []string, w io.Writer) (bool, error) {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	secret := fs.String("secret", os.Getenv("JWT_SECRET"), "HMAC secret, @file reads from file, defaults to $JWT_SECRET")
+	key := fs.String("key", "", "public key or certificate PEM")
+	jwks := fs.String("jwks", "", "local JWKS file")
+	algs := fs.String("alg", "", "comma separated allowed algorithms, defaults to the key type")
+	iss := fs.String("iss", "", "required issuer")
+	aud := fs.String("aud", "", "required audience")
+	leeway := fs.Duration("leeway", jwt.DefaultLeeway, "allowed clock skew")
+	requireExp := fs.Bool("require-exp", true, "reject tokens without exp")
+	decrypt := fs.String("decrypt", "", "private key PEM for encrypted tokens")
+	if err := fs.Parse(args); err != nil {
+		return false, err
+	}
+	if fs.NArg() != 1 {
+		return false, errors.New("verify: need exactly one token")
+	}
+
+	var validator *jwt.TokenValidator
+	switch {
+	case *key != "" && *jwks != "":
+		return false, errors.New("verify: -key and -jwks are mutually exclusive")
+	case *key != "":
+		verificationKey, err := jwt.LoadVerificationKey("", *key)
+		if err != nil {
+			return false, err
+		}
+		validator = jwt.NewTokenValidator(jwt.StaticKey(verificationKey.Key), verificationKey.Algorithm)
+	case *jwks != "":
+		data, err := ioutil.ReadFile(*jwks)
+		if err != nil {
+			return false, err
+		}
+		var set jwt.JSONWebKeySet
+		if err := json.Unmarshal(data, &set); err != nil {
+			return false, fmt.Errorf("invalid jwks %s: %v", *jwks, err)
+		}
+		keyring := jwt.NewKeyring()
+		for i := range set.Keys {
+			verificationKey, err := set.Keys[i].VerificationKey()
+			if err != nil {
+				return false, fmt.Errorf("invalid jwk %q: %v", set.Keys[i].Kid, err)
+			}
+			keyring.Add(verificationKey)
+		}
+		validator = jwt.NewKeyringValidator(keyring, jwt.AsymmetricAlgorithms...)
+	case *secret != "":
+		b, err := readArg(*secret)
+		if err != nil {
+			return false, err
+		}
+		validator = jwt.NewTokenValidator(jwt.StaticKey(b), "HS256", "HS384", "HS512")
+	default:
+		return false, errors.New("verify: need -secret, -key or -jwks")
+	}
+	if *algs != "" {
+		validator.Algorithms = strings.Split(*algs, ",")
+	}
+	validator.Issuer = *iss
+	validator.Audience = *aud
+	validator.Leeway = *leeway
+	validator.RequireExpiration = *requireExp
+	validator.Now = now
+	if *decrypt != "" {
+		decryptionKey, err := loadDecryptionKey(*decrypt)
+		if err != nil {
+			return false, err
+		}
+		validator.DecryptionKeys = []*jwt.DecryptionKey{decryptionKey}
+	}
+
+	tokenString, err := readToken(fs.Arg(0))
+	if err != nil {
+		return false, err
+	}
+	// 先输出内容，即使校验失败也可以看到Token里有什么
+	plaintext, err := decryptToken(w, tokenString, *decrypt)
+	if err != nil {
+		return false, err
+	}
+	claims, err := writeToken(w, plaintext)
+	if err != nil {
+		return false, err
+	}
+	writeStatus(w, claims)
+	if _, err := validator.ValidateWithClaims(tokenString, &mapClaims{}); err != nil {
+		fmt.Fprintf(w, "verdict:    INVALID (%v)\n", err)
+		return false, nil
+	}
+	fmt.Fprintln(w, "verdict:    valid")
+	return true, nil
+}
+
+func mint(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("mint", flag.ContinueOnError)
+	claimsFile := fs.String("claims", "", "JSON claims file, - reads from stdin")
+	secret := fs.String("secret", os.Getenv("JWT_SECRET"), "HMAC secret, @file reads from file, defaults to $JWT_SECRET")
+	alg := fs.String("alg", "HS256", "HMAC algorithm: HS256, HS384 or HS512")
+	key := fs.String("key", "", "private key PEM, the algorithm follows the key type")
+	kid := fs.String("kid", "", "key id in the header")
+	ttl := fs.Duration("ttl", jwt.DefaultTokenTTL, "lifetime when the claims have no exp")
+	iss := fs.String("iss", "", "issuer when the claims have no iss")
+	aud := fs.String("aud", "", "comma separated audience when the claims have no aud")
+	encrypt := fs.String("encrypt", "", "recipient public key PEM, encrypts the signed token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *claimsFile == "" || fs.NArg() != 0 {
+		return errors.New("mint: need -claims and no other arguments")
+	}
+
+	var issuer *jwt.TokenIssuer
+	if *key != "" {
+		signingKey, err := jwt.LoadSigningKey(*kid, *key)
+		if err != nil {
+			return err
+		}
+		issuer = signingKey.Issuer()
+	} else {
+		method, ok := hmacMethods[*alg]
+		if !ok {
+			return fmt.Errorf("mint: unsupported -alg %q", *alg)
+		}
+		if *secret == "" {
+			return errors.New("mint: need -secret or -key")
+		}
+		b, err := readArg(*secret)
+		if err != nil {
+			return err
+		}
+		issuer = jwt.NewTokenIssuer(method, b)
+		issuer.KeyID = *kid
+	}
+	issuer.TTL = *ttl
+	issuer.Issuer = *iss
+	if *aud != "" {
+		issuer.Audience = strings.Split(*aud, ",")
+	}
+	issuer.Now = now
+	if *encrypt != "" {
+		publicKey, err := jwt.LoadVerificationKey("", *encrypt)
+		if err != nil {
+			return err
+		}
+		if issuer.Encryption, err = jwt.NewEncryptionKey("", publicKey.Key); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	var err error
+	if *claimsFile == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(*claimsFile)
+	}
+	if err != nil {
+		return err
+	}
+	claims := &mapClaims{}
+	if err := json.Unmarshal(data, claims); err != nil {
+		return fmt.Errorf("invalid claims %s: %v", *claimsFile, err)
+	}
+	tokenString, err := issuer.Issue(claims)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, tokenString)
+	return nil
+}
+
+// 任意的声明，标准声明解析到RegisteredClaims中，其余的原样保留
+type mapClaims struct {
+	jwt.RegisteredClaims
+	Extra map[string]json.RawMessage
+}
+
+var registeredNames = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+
+func (claims *mapClaims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &claims.RegisteredClaims); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &claims.Extra); err != nil {
+		return err
+	}
+	for _, name := range registeredNames {
+		delete(claims.Extra, name)
+	}
+	return nil
+}
+
+func (claims *mapClaims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(claims.RegisteredClaims)
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for name, value := range claims.Extra {
+		all[name] = value
+	}
+	return json.Marshal(all)
+}
+
+// "@file"从文件读取，否则为参数本身
+func readArg(value string) ([]byte, error) {
+	if strings.HasPrefix(value, "@") {
+		return ioutil.ReadFile(value[1:])
+	}
+	return []byte(value), nil
+}
+
+func readToken(arg string) (string, error) {
+	if arg != "-" {
+		return strings.TrimSpace(arg), nil
+	}
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func loadDecryptionKey(path string) (*jwt.DecryptionKey, error) {
+	signingKey, err := jwt.LoadSigningKey("", path)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.NewDecryptionKey("", signingKey.PrivateKey)
+}
+
+// 加密的Token输出JWE Header后解密，返回内层的JWT；没有指定私钥时只输出Header
+func decryptToken(w io.Writer, tokenString string, keyPath string) (string, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 5 {
+		return tokenString, nil
+	}
+	header, err := segmentJSON(parts[0])
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(w, "== jwe header ==\n%s\n\n", header)
+	if keyPath == "" {
+		return "", errors.New("token is encrypted, use -decrypt private.pem")
+	}
+	key, err := loadDecryptionKey(keyPath)
+	if err != nil {
+		return "", err
+	}
+	plaintext, _, err := jwt.Decrypt(tokenString, key)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// 输出Header和声明，返回声明
+func writeToken(w io.Writer, tokenString string) (map[string]interface{}, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, jwt.ErrTokenMalformed
+	}
+	header, err := segmentJSON(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	payload, err := segmentJSON(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(w, "== header ==\n%s\n\n", header)
+	fmt.Fprintf(w, "== claims ==\n%s\n\n", payload)
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var claims map[string]interface{}
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, jwt.ErrTokenMalformed
+	}
+	return claims, nil
+}
+
+// base64url解码后格式化JSON
+func segmentJSON(segment string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return nil, jwt.ErrTokenMalformed
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return nil, jwt.ErrTokenMalformed
+	}
+	return out.Bytes(), nil
+}
+
+// 输出iat、nbf、exp的时间和相对当前时间的状态，只比较时间，不考虑时钟偏差
+func writeStatus(w io.Writer, claims map[string]interface{}) {
+	t := now()
+	times := make(map[string]time.Time)
+	var names []string
+	for _, name := range []string{"iat", "nbf", "exp"} {
+		number, ok := claims[name].(json.Number)
+		if !ok {
+			continue
+		}
+		seconds, err := number.Float64()
+		if err != nil {
+			continue
+		}
+		times[name] = time.Unix(int64(seconds), 0).UTC()
+		names = append(names, name)
+	}
+	sort.SliceStable(names, func(i, j int) bool { return times[names[i]].Before(times[names[j]]) })
+	for _, name := range names {
+		fmt.Fprintf(w, "%-11s %s (%s)\n", name+":", times[name].Format(time.RFC3339), relative(times[name], t))
+	}
+
+	exp, hasExp := times["exp"]
+	nbf, hasNbf := times["nbf"]
+	switch {
+	case hasExp && t.After(exp):
+		fmt.Fprintf(w, "status:     expired %s ago\n", t.Sub(exp).Round(time.Second))
+	case hasNbf && nbf.After(t):
+		fmt.Fprintf(w, "status:     not valid for another %s\n", nbf.Sub(t).Round(time.Second))
+	case hasExp:
+		fmt.Fprintf(w, "status:     valid for %s\n", exp.Sub(t).Round(time.Second))
+	default:
+		fmt.Fprintln(w, "status:     never expires (no exp)")
+	}
+}
+
+func relative(at time.Time, t time.Time) string {
+	if at.After(t) {
+		return "in " + at.Sub(t).Round(time.Second).String()
+	}
+	return t.Sub(at).Round(time.Second).String() + " ago"
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"paradigm/security/jwt"
+)
+
+var testNow = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "jwt-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func writeFile(t *testing.T, dir string, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 生成EC密钥，返回私钥和公钥PEM文件
+func writeKeys(t *testing.T, dir string) (string, string, *ecdsa.PrivateKey) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	privatePath := writeFile(t, dir, "private.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	der, _ = x509.MarshalPKIXPublicKey(privateKey.Public())
+	publicPath := writeFile(t, dir, "public.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	return privatePath, publicPath, privateKey
+}
+
+func setNow(t *testing.T, at time.Time) {
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func run(t *testing.T, f func([]string, *bytes.Buffer) error, args ...string) string {
+	var out bytes.Buffer
+	if err := f(args, &out); err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+	return out.String()
+}
+
+func mintToken(t *testing.T, args ...string) string {
+	return strings.TrimSpace(run(t, func(args []string, out *bytes.Buffer) error { return mint(args, out) }, args...))
+}
+
+func verifyToken(t *testing.T, args ...string) (bool, string) {
+	var out bytes.Buffer
+	valid, err := verify(args, &out)
+	if err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+	return valid, out.String()
+}
+
+func assertContains(t *testing.T, out string, wants ...string) {
+	for _, want := range wants {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q not found in:\n%s", want, out)
+		}
+	}
+}
+
+func TestMintDecodeVerifySecret(t *testing.T) {
+	setNow(t, testNow)
+	dir := tempDir(t)
+	claims := writeFile(t, dir, "claims.json", []byte(`{"sub": "alice", "roles": ["admin"], "tid": "t0000001"}`))
+	tokenString := mintToken(t, "-secret", "s3cret", "-claims", claims, "-iss", "paradigm", "-aud", "api", "-ttl", "1h", "-kid", "k1")
+
+	out := run(t, func(args []string, out *bytes.Buffer) error { return decode(args, out) }, tokenString)
+	assertContains(t, out,
+		`"kid": "k1"`, `"sub": "alice"`, `"roles": [`, `"tid": "t0000001"`, `"iss": "paradigm"`,
+		"iat:        2020-05-01T12:00:00Z (0s ago)",
+		"exp:        2020-05-01T13:00:00Z (in 1h0m0s)",
+		"status:     valid for 1h0m0s",
+		"signature:  not verified")
+
+	valid, out := verifyToken(t, "-secret", "s3cret", "-iss", "paradigm", "-aud", "api", tokenString)
+	if !valid {
+		t.Errorf("not valid:\n%s", out)
+	}
+	assertContains(t, out, "verdict:    valid")
+
+	secretFile := writeFile(t, dir, "secret.txt", []byte("wrong"))
+	valid, out = verifyToken(t, "-secret", "@"+secretFile, tokenString)
+	if valid {
+		t.Error("wrong secret accepted")
+	}
+	assertContains(t, out, "verdict:    INVALID (jwt: signature is invalid)")
+
+	valid, out = verifyToken(t, "-secret", "s3cret", "-aud", "other", tokenString)
+	if valid {
+		t.Error("wrong audience accepted")
+	}
+	assertContains(t, out, "INVALID (jwt: invalid audience)")
+
+	setNow(t, testNow.Add(2*time.Hour))
+	valid, out = verifyToken(t, "-secret", "s3cret", tokenString)
+	if valid {
+		t.Error("expired token accepted")
+	}
+	assertContains(t, out, "status:     expired 1h0m0s ago", "INVALID (jwt: token is expired)")
+}
+
+func TestVerifyKeyAndJWKS(t *testing.T) {
+	setNow(t, testNow)
+	dir := tempDir(t)
+	privatePath, publicPath, privateKey := writeKeys(t, dir)
+	claims := writeFile(t, dir, "claims.json", []byte(`{"sub": "alice", "exp": 1588338000}`))
+	tokenString := mintToken(t, "-key", privatePath, "-kid", "k1", "-claims", claims)
+
+	out := run(t, func(args []string, out *bytes.Buffer) error { return decode(args, out) }, tokenString)
+	assertContains(t, out, `"alg": "ES256"`, "exp:        2020-05-01T13:00:00Z (in 1h0m0s)")
+
+	if valid, out := verifyToken(t, "-key", publicPath, tokenString); !valid {
+		t.Errorf("key: not valid:\n%s", out)
+	}
+	// 公钥不能作为HMAC密钥
+	if valid, _ := verifyToken(t, "-key", publicPath, "-alg", "HS256", tokenString); valid {
+		t.Error("alg override accepted")
+	}
+
+	signingKey, _ := jwt.NewSigningKey("k1", privateKey)
+	set, _ := jwt.NewJSONWebKeySet([]*jwt.VerificationKey{signingKey.Public()})
+	data, _ := json.Marshal(set)
+	jwksPath := writeFile(t, dir, "jwks.json", data)
+	if valid, out := verifyToken(t, "-jwks", jwksPath, tokenString); !valid {
+		t.Errorf("jwks: not valid:\n%s", out)
+	}
+	other := mintToken(t, "-key", privatePath, "-kid", "k2", "-claims", claims)
+	if valid, out := verifyToken(t, "-jwks", jwksPath, other); valid || !strings.Contains(out, "unknown") {
+		t.Errorf("unknown kid:\n%s", out)
+	}
+
+	if _, err := verify([]string{"-key", publicPath, "-jwks", jwksPath, tokenString}, &bytes.Buffer{}); err == nil {
+		t.Error("both -key and -jwks accepted")
+	}
+}
+
+func TestEncryptedToken(t *testing.T) {
+	setNow(t, testNow)
+	dir := tempDir(t)
+	privatePath, publicPath, _ := writeKeys(t, dir)
+	claims := writeFile(t, dir, "claims.json", []byte(`{"sub": "alice", "ssn": "123"}`))
+	tokenString := mintToken(t, "-secret", "s3cret", "-claims", claims, "-encrypt", publicPath)
+	if strings.Count(tokenString, ".") != 4 {
+		t.Fatalf("token = %s", tokenString)
+	}
+
+	if err := decode([]string{tokenString}, &bytes.Buffer{}); err == nil {
+		t.Error("encrypted token decoded without key")
+	}
+	out := run(t, func(args []string, out *bytes.Buffer) error { return decode(args, out) }, "-decrypt", privatePath, tokenString)
+	assertContains(t, out, "== jwe header ==", `"enc": "A256GCM"`, `"cty": "JWT"`, `"ssn": "123"`)
+
+	if valid, out := verifyToken(t, "-secret", "s3cret", "-decrypt", privatePath, tokenString); !valid {
+		t.Errorf("not valid:\n%s", out)
+	}
+}
+
+func TestMapClaims(t *testing.T) {
+	claims := &mapClaims{}
+	if err := json.Unmarshal([]byte(`{"sub": "alice", "aud": ["a", "b"], "exp": 100, "n": 1, "o": {"k": "v"}}`), claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice" || len(claims.Audience) != 2 || claims.ExpiresAt != 100 || len(claims.Extra) != 2 {
+		t.Errorf("claims = %+v", claims)
+	}
+	claims.ID = "id"
+	data, _ := json.Marshal(claims)
+	if string(data) != `{"aud":["a","b"],"exp":100,"jti":"id","n":1,"o":{"k":"v"},"sub":"alice"}` {
+		t.Errorf("json = %s", data)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	for _, token := range []string{"abc", "a.b.c", "eyJhbGciOiJIUzI1NiJ9.bm90IGpzb24.sig"} {
+		if err := decode([]string{token}, &bytes.Buffer{}); err != jwt.ErrTokenMalformed {
+			t.Errorf("%s: err = %v", token, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+// EdDSA(Ed25519)签名，RFC 8037
+// jwt-go v3没有实现EdDSA，这里补上并注册，签名使用ed25519.PrivateKey，校验使用ed25519.PublicKey
+type SigningMethodEd25519 struct{}
+
+var SigningMethodEdDSA = &SigningMethodEd25519{}
+
+func init() {
+	jwtgo.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwtgo.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (method *SigningMethodEd25519) Alg() string {
+	return "EdDSA"
+}
+
+func (method *SigningMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok || len(privateKey) != ed25519.PrivateKeySize {
+		return "", jwtgo.ErrInvalidKeyType
+	}
+	return jwtgo.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+func (method *SigningMethodEd25519) Verify(signingString string, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok || len(publicKey) != ed25519.PublicKeySize {
+		return jwtgo.ErrInvalidKeyType
+	}
+	sig, err := jwtgo.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwtgo.ErrSignatureInvalid
+	}
+	return nil
+}
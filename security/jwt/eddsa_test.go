@@ -0,0 +1,39 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+// RFC 8037 附录A.4
+func TestEdDSAVector(t *testing.T) {
+	seed, _ := jwtgo.DecodeSegment("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	x, _ := jwtgo.DecodeSegment("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	if !bytes.Equal(privateKey.Public().(ed25519.PublicKey), x) {
+		t.Fatal("public key mismatch")
+	}
+
+	const jws = "eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc.hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg"
+	i := strings.LastIndex(jws, ".")
+	signature, err := SigningMethodEdDSA.Sign(jws[:i], privateKey)
+	if err != nil || signature != jws[i+1:] {
+		t.Errorf("signature = %s, err = %v", signature, err)
+	}
+	if err := SigningMethodEdDSA.Verify(jws[:i], jws[i+1:], ed25519.PublicKey(x)); err != nil {
+		t.Error(err)
+	}
+	if err := SigningMethodEdDSA.Verify(jws[:i]+"x", jws[i+1:], ed25519.PublicKey(x)); err != jwtgo.ErrSignatureInvalid {
+		t.Errorf("tampered: err = %v", err)
+	}
+	if _, err := SigningMethodEdDSA.Sign(jws[:i], []byte("secret")); err != jwtgo.ErrInvalidKeyType {
+		t.Errorf("wrong key type: err = %v", err)
+	}
+	if jwtgo.GetSigningMethod("EdDSA") != SigningMethodEdDSA {
+		t.Error("EdDSA not registered")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"paradigm/security/jwt"
+)
+
+// 业务自定义的声明
+type UserClaims struct {
+	jwt.RegisteredClaims
+	TenantID string   `json:"tid"`
+	Roles    []string `json:"roles"`
+}
+
+func (claims *UserClaims) GetRoles() []string {
+	return claims.Roles
+}
+
+func (claims *UserClaims) GetTenantID() string {
+	return claims.TenantID
+}
+
+// 签发和校验时都会执行
+func (claims *UserClaims) Valid() error {
+	if len(claims.Roles) == 0 {
+		return errors.New("roles required")
+	}
+	return nil
+}
+
+func main() {
+	// 密钥从环境变量读取，没有配置时随机生成，同一个密钥用于签发和校验
+	secret := []byte(os.Getenv("JWT_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+
+	issuer := jwt.NewHMACIssuer(secret)
+	issuer.Issuer = "paradigm"
+	issuer.Audience = []string{"api"}
+	issuer.Checks = []jwt.ClaimsCheck{jwt.TenantIDPattern(`t[0-9]{7}`)}
+	tokenString, err := issuer.Issue(&UserClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"},
+		TenantID:         "t0000001",
+		Roles:            []string{"reader"},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(tokenString)
+
+	validator := jwt.NewHMACValidator(secret)
+	validator.Issuer = "paradigm"
+	validator.Audience = "api"
+	validator.Checks = []jwt.ClaimsCheck{jwt.TenantIDPattern(`t[0-9]{7}`), jwt.MaxLifetime(time.Hour)}
+	claims := &UserClaims{}
+	if _, err := validator.ValidateWithClaims(tokenString, claims); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(claims.Subject, claims.TenantID, claims.Roles, claims.ExpiresAt)
+}
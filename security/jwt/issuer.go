@@ -0,0 +1,104 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+const DefaultTokenTTL = 15 * time.Minute
+
+var ErrMissingSigningKey = errors.New("jwt: missing signing key")
+
+// 签发JWT
+//
+// 签发时补齐标准声明：iss、aud使用TokenIssuer的配置，iat、nbf为当前时间，exp为当前时间加TTL，jti为随机的UUID；
+// 调用方已经设置的声明不会被覆盖，只需要设置sub和业务自定义的声明。
+// HMAC算法(HS256等)的密钥可以是任意的[]byte，建议使用crypto/rand生成，长度不少于32字节。
+type TokenIssuer struct {
+	Method      SigningMethod
+	Key         interface{}      // 签名密钥，HMAC算法为[]byte
+	KeyID       string           // 放入Header的kid，校验方据此选择密钥，为空时不设置
+	SigningKeys SigningKeySource // 不为空时每次签发都从这里获取签名密钥，忽略Method、Key和KeyID，用于密钥轮换
+	Encryption  *EncryptionKey   // 不为空时签名后再加密(Nested JWT)，用于包含敏感声明的Token
+	Checks      []ClaimsCheck    // 补齐标准声明后执行，之前先执行声明的Valid方法，不通过时不签发
+	Issuer      string           // iss
+	Audience    []string         // aud
+	TTL         time.Duration    // 有效期，为0时使用DefaultTokenTTL
+	Now         func() time.Time
+}
+
+func NewTokenIssuer(method SigningMethod, key interface{}) *TokenIssuer {
+	return &TokenIssuer{
+		Method: method,
+		Key:    key,
+		TTL:    DefaultTokenTTL,
+		Now:    time.Now,
+	}
+}
+
+// 使用HS256签名
+func NewHMACIssuer(secret []byte) *TokenIssuer {
+	return NewTokenIssuer(SigningMethodHS256, secret)
+}
+
+// 补齐标准声明，签名后返回JWT
+func (issuer *TokenIssuer) Issue(claims Claims) (string, error) {
+	method, key, keyID := issuer.Method, issuer.Key, issuer.KeyID
+	if issuer.SigningKeys != nil {
+		signingKey, err := issuer.SigningKeys.SigningKey()
+		if err != nil {
+			return "", err
+		}
+		method, key, keyID = signingKey.Method, signingKey.PrivateKey, signingKey.KeyID
+	}
+	if key == nil {
+		return "", ErrMissingSigningKey
+	}
+	issuer.fill(claims.Registered())
+	if err := checkClaims(claims, issuer.Checks); err != nil {
+		return "", err
+	}
+	token := jwtgo.NewWithClaims(method, claims)
+	if keyID != "" {
+		token.Header["kid"] = keyID
+	}
+	signed, err := token.SignedString(key)
+	if err != nil || issuer.Encryption == nil {
+		return signed, err
+	}
+	return Encrypt([]byte(signed), issuer.Encryption, "JWT")
+}
+
+// 只包含标准声明的JWT
+func (issuer *TokenIssuer) IssueSubject(subject string) (string, error) {
+	return issuer.Issue(&RegisteredClaims{Subject: subject})
+}
+
+func (issuer *TokenIssuer) fill(registered *RegisteredClaims) {
+	now := issuer.Now()
+	ttl := issuer.TTL
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	if registered.Issuer == "" {
+		registered.Issuer = issuer.Issuer
+	}
+	if len(registered.Audience) == 0 && len(issuer.Audience) > 0 {
+		registered.Audience = append(Audience(nil), issuer.Audience...)
+	}
+	if registered.IssuedAt == 0 {
+		registered.IssuedAt = now.Unix()
+	}
+	if registered.NotBefore == 0 {
+		registered.NotBefore = now.Unix()
+	}
+	if registered.ExpiresAt == 0 {
+		registered.ExpiresAt = now.Add(ttl).Unix()
+	}
+	if registered.ID == "" {
+		registered.ID = uuid.New().String()
+	}
+}
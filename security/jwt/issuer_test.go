@@ -0,0 +1,70 @@
+package jwt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+	testNow    = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+type testClaims struct {
+	RegisteredClaims
+	Foo string `json:"foo"`
+}
+
+func newTestIssuer() *TokenIssuer {
+	issuer := NewHMACIssuer(testSecret)
+	issuer.Issuer = "paradigm"
+	issuer.Audience = []string{"api"}
+	issuer.Now = func() time.Time { return testNow }
+	return issuer
+}
+
+func TestIssueFillsRegisteredClaims(t *testing.T) {
+	issuer := newTestIssuer()
+	issuer.KeyID = "k1"
+	claims := &testClaims{RegisteredClaims: RegisteredClaims{Subject: "user-1"}, Foo: "bar"}
+	tokenString, err := issuer.Issue(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(tokenString, ".") != 2 {
+		t.Fatalf("token = %s", tokenString)
+	}
+	if claims.Issuer != "paradigm" || !claims.Audience.Contains("api") || claims.Subject != "user-1" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if claims.IssuedAt != testNow.Unix() || claims.NotBefore != testNow.Unix() ||
+		claims.ExpiresAt != testNow.Add(DefaultTokenTTL).Unix() {
+		t.Errorf("times = %d %d %d", claims.IssuedAt, claims.NotBefore, claims.ExpiresAt)
+	}
+	if len(claims.ID) != 36 {
+		t.Errorf("jti = %q", claims.ID)
+	}
+
+	validator := newTestValidator()
+	got := &testClaims{}
+	token, err := validator.ValidateWithClaims(tokenString, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Foo != "bar" || got.ID != claims.ID || token.Header["kid"] != "k1" {
+		t.Errorf("parsed = %+v, header = %v", got, token.Header)
+	}
+
+	// 已经设置的声明不覆盖，每个Token的jti不同
+	expiresAt := testNow.Add(time.Hour).Unix()
+	explicit := &RegisteredClaims{Issuer: "other", ExpiresAt: expiresAt}
+	issuer.Issue(explicit)
+	if explicit.Issuer != "other" || explicit.ExpiresAt != expiresAt || explicit.ID == claims.ID {
+		t.Errorf("explicit = %+v", explicit)
+	}
+
+	if _, err := NewTokenIssuer(SigningMethodHS256, nil).IssueSubject("u"); err != ErrMissingSigningKey {
+		t.Errorf("err = %v", err)
+	}
+}
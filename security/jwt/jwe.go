@@ -0,0 +1,305 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash"
+	"strings"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+//
+// JWE(JSON Web Encryption)
+//
+// JWS只保证Payload不被篡改，任何人都可以解码；需要对客户端隐藏的声明(租户、个人信息等)要加密。
+// JWE Compact格式由五部分组成：Header.EncryptedKey.IV.Ciphertext.Tag
+// 1)内容加密(enc)：随机生成内容密钥(CEK)，使用A256GCM加密，Header作为附加数据，Header被篡改时解密失败
+// 2)密钥管理(alg)：
+//   RSA-OAEP-256/RSA-OAEP: 使用接收方的RSA公钥加密CEK，放在EncryptedKey中
+//   ECDH-ES: 发送方生成临时EC密钥(epk放在Header中)，和接收方的公钥协商出CEK，EncryptedKey为空
+//
+// 签名后再加密(Nested JWT)：先按JWS签名，再把整个JWS作为明文加密，Header中cty为JWT。
+// 接收方先解密，再按原来的方式校验签名和声明，所以TokenIssuer、TokenValidator的用法不变，只是多了加密和解密的密钥。
+//
+// 参考 RFC 7516 https://tools.ietf.org/html/rfc7516
+//      RFC 7518 https://tools.ietf.org/html/rfc7518 (4.3 RSA-OAEP、4.6 ECDH-ES、5.3 A256GCM)
+//
+
+var (
+	ErrDecryptionFailed      = errors.New("jwt: decryption failed")
+	ErrUnsupportedEncryption = errors.New("jwt: unsupported encryption algorithm")
+	ErrEncryptionRequired    = errors.New("jwt: token must be encrypted")
+)
+
+const (
+	KeyAlgorithmRSAOAEP    = "RSA-OAEP"
+	KeyAlgorithmRSAOAEP256 = "RSA-OAEP-256"
+	KeyAlgorithmECDHES     = "ECDH-ES"
+	ContentEncryptionA256  = "A256GCM"
+)
+
+// 加密使用的接收方公钥
+type EncryptionKey struct {
+	KeyID     string
+	Algorithm string           // RSA-OAEP-256、RSA-OAEP或ECDH-ES
+	Key       crypto.PublicKey // *rsa.PublicKey或*ecdsa.PublicKey
+}
+
+// 根据公钥类型选择算法：RSA使用RSA-OAEP-256，EC使用ECDH-ES
+func NewEncryptionKey(keyID string, publicKey crypto.PublicKey) (*EncryptionKey, error) {
+	algorithm, err := keyAlgorithmFor(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptionKey{KeyID: keyID, Algorithm: algorithm, Key: publicKey}, nil
+}
+
+// 解密使用的接收方私钥
+type DecryptionKey struct {
+	KeyID      string
+	Algorithm  string
+	PrivateKey crypto.Signer // *rsa.PrivateKey或*ecdsa.PrivateKey
+}
+
+func NewDecryptionKey(keyID string, privateKey crypto.Signer) (*DecryptionKey, error) {
+	algorithm, err := keyAlgorithmFor(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptionKey{KeyID: keyID, Algorithm: algorithm, PrivateKey: privateKey}, nil
+}
+
+// 对应的公钥
+func (key *DecryptionKey) Public() *EncryptionKey {
+	return &EncryptionKey{KeyID: key.KeyID, Algorithm: key.Algorithm, Key: key.PrivateKey.Public()}
+}
+
+func keyAlgorithmFor(publicKey crypto.PublicKey) (string, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return "", errors.New("jwt: RSA key must be at least 2048 bits")
+		}
+		return KeyAlgorithmRSAOAEP256, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+			return KeyAlgorithmECDHES, nil
+		}
+	}
+	return "", ErrUnsupportedKey
+}
+
+type jweHeader struct {
+	Alg string      `json:"alg"`
+	Enc string      `json:"enc"`
+	Kid string      `json:"kid,omitempty"`
+	Cty string      `json:"cty,omitempty"`
+	Epk *JSONWebKey `json:"epk,omitempty"`
+	Apu string      `json:"apu,omitempty"`
+	Apv string      `json:"apv,omitempty"`
+}
+
+// 加密，contentType为Header中的cty，Nested JWT为"JWT"
+func Encrypt(plaintext []byte, key *EncryptionKey, contentType string) (string, error) {
+	header := jweHeader{Alg: key.Algorithm, Enc: ContentEncryptionA256, Kid: key.KeyID, Cty: contentType}
+	var cek, encryptedKey []byte
+	switch key.Algorithm {
+	case KeyAlgorithmRSAOAEP, KeyAlgorithmRSAOAEP256:
+		publicKey, ok := key.Key.(*rsa.PublicKey)
+		if !ok {
+			return "", ErrUnsupportedKey
+		}
+		cek = make([]byte, 32)
+		if _, err := rand.Read(cek); err != nil {
+			return "", err
+		}
+		var err error
+		if encryptedKey, err = rsa.EncryptOAEP(oaepHash(key.Algorithm), rand.Reader, publicKey, cek, nil); err != nil {
+			return "", err
+		}
+	case KeyAlgorithmECDHES:
+		publicKey, ok := key.Key.(*ecdsa.PublicKey)
+		if !ok {
+			return "", ErrUnsupportedKey
+		}
+		ephemeral, err := ecdsa.GenerateKey(publicKey.Curve, rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		if header.Epk, err = NewJSONWebKey(&VerificationKey{Key: &ephemeral.PublicKey}); err != nil {
+			return "", err
+		}
+		header.Epk.Use, header.Epk.Alg = "", ""
+		cek = deriveECDHES(ephemeral, publicKey, ContentEncryptionA256, nil, nil, 256)
+	default:
+		return "", ErrUnsupportedEncryption
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := jwtgo.EncodeSegment(headerJSON)
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	return strings.Join([]string{
+		protected,
+		jwtgo.EncodeSegment(encryptedKey),
+		jwtgo.EncodeSegment(iv),
+		jwtgo.EncodeSegment(ciphertext),
+		jwtgo.EncodeSegment(tag),
+	}, "."), nil
+}
+
+// 解密，根据Header中的kid选择私钥，没有kid时依次尝试算法一致的私钥
+// 返回明文和Header中的cty；失败时统一返回ErrDecryptionFailed，不区分原因
+func Decrypt(token string, keys ...*DecryptionKey) ([]byte, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, "", ErrTokenMalformed
+	}
+	headerJSON, err := jwtgo.DecodeSegment(parts[0])
+	if err != nil {
+		return nil, "", ErrTokenMalformed
+	}
+	var header jweHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, "", ErrTokenMalformed
+	}
+	if header.Enc != ContentEncryptionA256 {
+		return nil, "", ErrUnsupportedEncryption
+	}
+	segments := make([][]byte, 4)
+	for i := range segments {
+		if segments[i], err = jwtgo.DecodeSegment(parts[i+1]); err != nil {
+			return nil, "", ErrTokenMalformed
+		}
+	}
+	encryptedKey, iv, ciphertext, tag := segments[0], segments[1], segments[2], segments[3]
+
+	for _, key := range keys {
+		if key.Algorithm != header.Alg || header.Kid != "" && key.KeyID != header.Kid {
+			continue
+		}
+		cek, err := unwrapKey(&header, encryptedKey, key)
+		if err != nil {
+			continue
+		}
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			continue
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil || len(iv) != gcm.NonceSize() || len(tag) != gcm.Overhead() {
+			continue
+		}
+		plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+		if err != nil {
+			continue
+		}
+		return plaintext, header.Cty, nil
+	}
+	return nil, "", ErrDecryptionFailed
+}
+
+// 取出内容密钥
+func unwrapKey(header *jweHeader, encryptedKey []byte, key *DecryptionKey) ([]byte, error) {
+	switch header.Alg {
+	case KeyAlgorithmRSAOAEP, KeyAlgorithmRSAOAEP256:
+		privateKey, ok := key.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrUnsupportedKey
+		}
+		return rsa.DecryptOAEP(oaepHash(header.Alg), nil, privateKey, encryptedKey, nil)
+	case KeyAlgorithmECDHES:
+		privateKey, ok := key.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok || header.Epk == nil || len(encryptedKey) != 0 {
+			return nil, ErrDecryptionFailed
+		}
+		epk, err := header.Epk.VerificationKey()
+		if err != nil {
+			return nil, err
+		}
+		publicKey, ok := epk.Key.(*ecdsa.PublicKey)
+		if !ok || publicKey.Curve != privateKey.Curve {
+			return nil, ErrDecryptionFailed
+		}
+		apu, err := jwtgo.DecodeSegment(header.Apu)
+		if err != nil {
+			return nil, err
+		}
+		apv, err := jwtgo.DecodeSegment(header.Apv)
+		if err != nil {
+			return nil, err
+		}
+		return deriveECDHES(privateKey, publicKey, header.Enc, apu, apv, 256), nil
+	}
+	return nil, ErrUnsupportedEncryption
+}
+
+// RSA-OAEP使用SHA-1，RSA-OAEP-256使用SHA-256
+func oaepHash(algorithm string) hash.Hash {
+	if algorithm == KeyAlgorithmRSAOAEP {
+		return sha1.New()
+	}
+	return sha256.New()
+}
+
+// ECDH-ES密钥协商：共享密钥Z为ECDH结果的x坐标，再用Concat KDF(NIST SP 800-56A)派生出keyBits位的密钥
+// ECDH-ES直接协商内容密钥时，AlgorithmID为enc
+func deriveECDHES(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, algorithmID string, apu []byte, apv []byte, keyBits int) []byte {
+	x, _ := privateKey.Curve.ScalarMult(publicKey.X, publicKey.Y, privateKey.D.Bytes())
+	z := padBytes(x.Bytes(), (privateKey.Curve.Params().BitSize+7)/8)
+
+	var otherInfo []byte
+	for _, field := range [][]byte{[]byte(algorithmID), apu, apv} {
+		otherInfo = appendUint32(otherInfo, uint32(len(field)))
+		otherInfo = append(otherInfo, field...)
+	}
+	otherInfo = appendUint32(otherInfo, uint32(keyBits))
+
+	var key []byte
+	for counter := uint32(1); len(key) < keyBits/8; counter++ {
+		h := sha256.New()
+		h.Write(appendUint32(nil, counter))
+		h.Write(z)
+		h.Write(otherInfo)
+		key = h.Sum(key)
+	}
+	return key[:keyBits/8]
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// 是否为JWE Compact格式
+func isJWE(token string) bool {
+	return strings.Count(token, ".") == 4
+}
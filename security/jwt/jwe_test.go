@@ -0,0 +1,210 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+func newTestDecryptionKey(t *testing.T, keyID string, curve elliptic.Curve) *DecryptionKey {
+	if curve == nil {
+		key, err := NewDecryptionKey(keyID, testRSAKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewDecryptionKey(keyID, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	rsaOAEP := newTestDecryptionKey(t, "rsa", nil)
+	rsaOAEP.Algorithm = KeyAlgorithmRSAOAEP
+	cases := []struct {
+		name string
+		key  *DecryptionKey
+		alg  string
+	}{
+		{"RSA-OAEP-256", newTestDecryptionKey(t, "rsa", nil), KeyAlgorithmRSAOAEP256},
+		{"RSA-OAEP", rsaOAEP, KeyAlgorithmRSAOAEP},
+		{"ECDH-ES P-256", newTestDecryptionKey(t, "ec", elliptic.P256()), KeyAlgorithmECDHES},
+		{"ECDH-ES P-384", newTestDecryptionKey(t, "ec", elliptic.P384()), KeyAlgorithmECDHES},
+	}
+	for _, c := range cases {
+		plaintext := []byte("secret claims")
+		token, err := Encrypt(plaintext, c.key.Public(), "JWT")
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		parts := strings.Split(token, ".")
+		if len(parts) != 5 {
+			t.Fatalf("%s: token = %s", c.name, token)
+		}
+		headerJSON, _ := jwtgo.DecodeSegment(parts[0])
+		var header jweHeader
+		json.Unmarshal(headerJSON, &header)
+		if header.Alg != c.alg || header.Enc != "A256GCM" || header.Cty != "JWT" || header.Kid != c.key.KeyID {
+			t.Errorf("%s: header = %s", c.name, headerJSON)
+		}
+		if c.alg == KeyAlgorithmECDHES && (header.Epk == nil || parts[1] != "") {
+			t.Errorf("%s: epk = %v, encrypted key = %q", c.name, header.Epk, parts[1])
+		}
+
+		got, contentType, err := Decrypt(token, c.key)
+		if err != nil || string(got) != string(plaintext) || contentType != "JWT" {
+			t.Errorf("%s: decrypt = %q %q %v", c.name, got, contentType, err)
+		}
+		// 每次加密的结果不同
+		if other, _ := Encrypt(plaintext, c.key.Public(), "JWT"); other == token {
+			t.Errorf("%s: ciphertext reused", c.name)
+		}
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	key := newTestDecryptionKey(t, "ec", elliptic.P256())
+	token, err := Encrypt([]byte("secret claims"), key.Public(), "JWT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	// Header是附加数据，修改后解密失败
+	headerJSON, _ := jwtgo.DecodeSegment(parts[0])
+	tampered := strings.Replace(string(headerJSON), `"cty":"JWT"`, `"cty":"jwt"`, 1)
+	flip := func(segment string) string {
+		b, _ := jwtgo.DecodeSegment(segment)
+		b[0] ^= 1
+		return jwtgo.EncodeSegment(b)
+	}
+	cases := []struct {
+		name  string
+		token string
+		keys  []*DecryptionKey
+		err   error
+	}{
+		{"wrong key", token, []*DecryptionKey{newTestDecryptionKey(t, "ec", elliptic.P256())}, ErrDecryptionFailed},
+		{"no key", token, nil, ErrDecryptionFailed},
+		{"rsa key", token, []*DecryptionKey{newTestDecryptionKey(t, "ec", nil)}, ErrDecryptionFailed},
+		{"header", jwtgo.EncodeSegment([]byte(tampered)) + "." + strings.Join(parts[1:], "."), []*DecryptionKey{key}, ErrDecryptionFailed},
+		{"ciphertext", strings.Join([]string{parts[0], parts[1], parts[2], flip(parts[3]), parts[4]}, "."), []*DecryptionKey{key}, ErrDecryptionFailed},
+		{"tag", strings.Join([]string{parts[0], parts[1], parts[2], parts[3], flip(parts[4])}, "."), []*DecryptionKey{key}, ErrDecryptionFailed},
+		{"parts", strings.Join(parts[:4], "."), []*DecryptionKey{key}, ErrTokenMalformed},
+	}
+	for _, c := range cases {
+		if _, _, err := Decrypt(c.token, c.keys...); err != c.err {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.err)
+		}
+	}
+
+	// 不支持的enc
+	header := jwtgo.EncodeSegment([]byte(`{"alg":"ECDH-ES","enc":"A128CBC-HS256"}`))
+	if _, _, err := Decrypt(header+"."+strings.Join(parts[1:], "."), key); err != ErrUnsupportedEncryption {
+		t.Errorf("enc: err = %v", err)
+	}
+}
+
+// RFC 7518 附录C的ECDH-ES例子，派生128位的A128GCM密钥
+func TestDeriveECDHES(t *testing.T) {
+	decode := func(s string) *big.Int {
+		b, err := jwtgo.DecodeSegment(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return new(big.Int).SetBytes(b)
+	}
+	alice := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     decode("gI0GAILBdu7T53akrFmMyGcsF3n5dO7MmwNBHKW5SV0"),
+			Y:     decode("SLW_xSffzlPWrHEVI30DHM_4egVwt3NQqeUD7nMFpps"),
+		},
+		D: decode("0_NxaRPUMQoAJt50Gz8YiTr8gRTwyEaCumd-MToTmIo"),
+	}
+	bob := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     decode("weNJy2HscCSM6AEDTDg04biOvhFhyyWvOHQfeF_PxMQ"),
+			Y:     decode("e8lnCO-AlStT-NJVX-crhB7QRYhiix03illJOVAOyck"),
+		},
+		D: decode("VEmDZpDXXK8p8N0Cndsxs924q6nS1RXFASRl6BfUqdw"),
+	}
+	const want = "VqqN6vgjbSBcIijNcacQGg"
+	if got := jwtgo.EncodeSegment(deriveECDHES(alice, &bob.PublicKey, "A128GCM", []byte("Alice"), []byte("Bob"), 128)); got != want {
+		t.Errorf("sender key = %s, want %s", got, want)
+	}
+	if got := jwtgo.EncodeSegment(deriveECDHES(bob, &alice.PublicKey, "A128GCM", []byte("Alice"), []byte("Bob"), 128)); got != want {
+		t.Errorf("recipient key = %s, want %s", got, want)
+	}
+}
+
+func TestNestedToken(t *testing.T) {
+	key := newTestDecryptionKey(t, "enc", elliptic.P256())
+	issuer := newTestIssuer()
+	issuer.Encryption = key.Public()
+	tokenString, err := issuer.Issue(&testClaims{RegisteredClaims: RegisteredClaims{Subject: "user-1"}, Foo: "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isJWE(tokenString) {
+		t.Fatalf("token = %s", tokenString)
+	}
+
+	validator := newTestValidator()
+	if _, err := validator.Validate(tokenString); err != ErrDecryptionFailed {
+		t.Errorf("without key: err = %v", err)
+	}
+	validator.DecryptionKeys = []*DecryptionKey{key}
+	got := &testClaims{}
+	if _, err := validator.ValidateWithClaims(tokenString, got); err != nil || got.Foo != "bar" || got.Subject != "user-1" {
+		t.Errorf("claims = %+v, err = %v", got, err)
+	}
+
+	// 解密后仍然校验签名
+	validator.Keyfunc = StaticKey([]byte("another secret"))
+	if _, err := validator.Validate(tokenString); err != ErrSignatureInvalid {
+		t.Errorf("wrong signing key: err = %v", err)
+	}
+	validator.Keyfunc = StaticKey(testSecret)
+
+	// 未签名的内容即使加密了也不接受
+	encrypted, _ := Encrypt([]byte(`{"sub":"user-1"}`), key.Public(), "")
+	if _, err := validator.Validate(encrypted); err != ErrTokenMalformed {
+		t.Errorf("plain payload: err = %v", err)
+	}
+
+	validator.RequireEncryption = true
+	signed, _ := newTestIssuer().IssueSubject("user-1")
+	if _, err := validator.Validate(signed); err != ErrEncryptionRequired {
+		t.Errorf("unencrypted: err = %v", err)
+	}
+	if _, err := validator.Validate(tokenString); err != nil {
+		t.Errorf("encrypted: err = %v", err)
+	}
+}
+
+func TestEncryptionKeyAlgorithm(t *testing.T) {
+	if key, err := NewEncryptionKey("k", testRSAKey.Public()); err != nil || key.Algorithm != KeyAlgorithmRSAOAEP256 {
+		t.Errorf("rsa: %v %v", key, err)
+	}
+	if key, err := NewEncryptionKey("k", testECKey.Public()); err != nil || key.Algorithm != KeyAlgorithmECDHES {
+		t.Errorf("ec: %v %v", key, err)
+	}
+	if _, err := NewEncryptionKey("k", testEd25519Key.Public()); err != ErrUnsupportedKey {
+		t.Errorf("ed25519: err = %v", err)
+	}
+}
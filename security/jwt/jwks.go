@@ -0,0 +1,348 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+//
+// JWKS(JSON Web Key Set)
+//
+// 签发方把公钥以JSON格式发布在固定的URL上(例如/.well-known/jwks.json)，校验方按需下载，不需要手工分发PEM文件：
+//   {"keys": [{"kty": "RSA", "kid": "k1", "use": "sig", "alg": "RS256", "n": "...", "e": "AQAB"}]}
+//
+// 校验方的RemoteKeySet按HTTP缓存头(Cache-Control: max-age、Expires)缓存公钥，缓存过期后重新下载；
+// 遇到未知的kid时也会重新下载，这样签发方轮换密钥后，校验方不需要重启，为了防止伪造kid的请求打爆签发方，两次下载之间至少间隔MinRefreshInterval。
+// 下载时不持有锁，同一时间只有一个下载：kid已缓存的请求继续使用旧的公钥，未知kid的请求等待这次下载的结果；HTTP Client默认超时DefaultJWKSTimeout。
+//
+// 参考 RFC 7517 https://tools.ietf.org/html/rfc7517
+//      RFC 8037 https://tools.ietf.org/html/rfc8037 (Ed25519)
+//
+
+var ErrJWKSUnavailable = errors.New("jwt: jwks unavailable")
+
+const (
+	DefaultJWKSMaxAge             = 5 * time.Minute
+	DefaultJWKSMinRefreshInterval = time.Minute
+	DefaultJWKSTimeout            = 10 * time.Second
+)
+
+// JWK，只包含公钥需要的字段
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // P-256、Ed25519等
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// 公钥的来源，Keyring等实现该接口
+type KeySource interface {
+	Keys() []*VerificationKey
+}
+
+// 公钥转换为JWK
+func NewJSONWebKey(key *VerificationKey) (*JSONWebKey, error) {
+	jwk := &JSONWebKey{Kid: key.KeyID, Use: "sig", Alg: key.Algorithm}
+	switch k := key.Key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = jwtgo.EncodeSegment(k.N.Bytes())
+		jwk.E = jwtgo.EncodeSegment(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = jwtgo.EncodeSegment(padBytes(k.X.Bytes(), size))
+		jwk.Y = jwtgo.EncodeSegment(padBytes(k.Y.Bytes(), size))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = jwtgo.EncodeSegment(k)
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return jwk, nil
+}
+
+// EC坐标按曲线长度左侧补零
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// JWK转换为公钥，没有alg时按密钥类型选择算法
+func (jwk *JSONWebKey) VerificationKey() (*VerificationKey, error) {
+	var publicKey interface{}
+	switch jwk.Kty {
+	case "RSA":
+		n, err := jwtgo.DecodeSegment(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := jwtgo.DecodeSegment(jwk.E)
+		if err != nil || len(e) > 4 {
+			return nil, fmt.Errorf("jwt: invalid RSA exponent in jwk %q", jwk.Kid)
+		}
+		publicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrUnsupportedKey
+		}
+		x, err := jwtgo.DecodeSegment(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := jwtgo.DecodeSegment(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("jwt: invalid EC point in jwk %q", jwk.Kid)
+		}
+		publicKey = key
+	case "OKP":
+		x, err := jwtgo.DecodeSegment(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		publicKey = ed25519.PublicKey(x)
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	method, err := methodForKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if jwk.Alg != "" && jwk.Alg != method.Alg() {
+		return nil, ErrKeyAlgorithmMismatch
+	}
+	return &VerificationKey{
+		KeyID:     jwk.Kid,
+		Algorithm: method.Alg(),
+		Key:       publicKey,
+	}, nil
+}
+
+// 生成JWKS
+func NewJSONWebKeySet(keys []*VerificationKey) (*JSONWebKeySet, error) {
+	set := &JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(keys))}
+	for _, key := range keys {
+		jwk, err := NewJSONWebKey(key)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, *jwk)
+	}
+	return set, nil
+}
+
+// 发布JWKS的Handler
+//
+//	http.Handle("/.well-known/jwks.json", jwt.NewJWKSHandler(keyring))
+type JWKSHandler struct {
+	Keys   KeySource
+	MaxAge time.Duration // Cache-Control: max-age，密钥轮换时新公钥需要提前MaxAge发布
+}
+
+func NewJWKSHandler(keys KeySource) *JWKSHandler {
+	return &JWKSHandler{
+		Keys:   keys,
+		MaxAge: DefaultJWKSMaxAge,
+	}
+}
+
+func (handler *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	set, err := NewJSONWebKeySet(handler.Keys.Keys())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(handler.MaxAge/time.Second)))
+	json.NewEncoder(w).Encode(set)
+}
+
+// 远程JWKS，实现Keyfunc
+type RemoteKeySet struct {
+	URL                string
+	Client             *http.Client
+	MaxAge             time.Duration // 响应中没有缓存头时的缓存时间
+	MinRefreshInterval time.Duration // 两次下载的最小间隔
+	Now                func() time.Time
+
+	mu          sync.Mutex
+	keyring     *Keyring
+	expireAt    time.Time
+	lastAttempt time.Time
+	fetched     bool
+	refreshing  chan struct{} // 正在下载时不为空，下载结束时关闭
+}
+
+func NewRemoteKeySet(url string) *RemoteKeySet {
+	return &RemoteKeySet{
+		URL:                url,
+		Client:             &http.Client{Timeout: DefaultJWKSTimeout},
+		MaxAge:             DefaultJWKSMaxAge,
+		MinRefreshInterval: DefaultJWKSMinRefreshInterval,
+		Now:                time.Now,
+		keyring:            NewKeyring(),
+	}
+}
+
+// 实现Keyfunc，缓存过期或者kid未知时重新下载
+func (set *RemoteKeySet) Keyfunc(token *Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	if keyID == "" {
+		return nil, ErrMissingKeyID
+	}
+
+	set.mu.Lock()
+	now := set.Now()
+	_, known := set.keyring.Get(keyID)
+	var refreshed bool
+	if !known || now.After(set.expireAt) {
+		if set.refreshing == nil && now.Sub(set.lastAttempt) >= set.MinRefreshInterval {
+			set.lastAttempt = now
+			set.refreshing = make(chan struct{})
+			set.mu.Unlock()
+			set.refresh(now)
+			set.mu.Lock()
+			refreshed = true
+		} else if !known && set.refreshing != nil {
+			// 其他请求正在下载，等待它的结果
+			refreshing := set.refreshing
+			set.mu.Unlock()
+			<-refreshing
+			set.mu.Lock()
+			refreshed = true
+		}
+	}
+	// 下载失败时继续使用缓存中的公钥
+	if refreshed && !set.fetched {
+		set.mu.Unlock()
+		return nil, ErrJWKSUnavailable
+	}
+	keyring := set.keyring
+	set.mu.Unlock()
+	return keyring.Keyfunc(token)
+}
+
+// 所有公钥，实现KeySource
+func (set *RemoteKeySet) Keys() []*VerificationKey {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	return set.keyring.Keys()
+}
+
+// 下载时不持有锁，成功后替换缓存，结束时通知等待的请求
+func (set *RemoteKeySet) refresh(now time.Time) {
+	keyring, maxAge, err := set.fetch(now)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	close(set.refreshing)
+	set.refreshing = nil
+	if err != nil {
+		return
+	}
+	set.keyring = keyring
+	set.fetched = true
+	set.expireAt = now.Add(maxAge)
+}
+
+func (set *RemoteKeySet) fetch(now time.Time) (*Keyring, time.Duration, error) {
+	resp, err := set.Client.Get(set.URL)
+	if err != nil {
+		return nil, 0, ErrJWKSUnavailable
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, ErrJWKSUnavailable
+	}
+	var jwks JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, 0, ErrJWKSUnavailable
+	}
+
+	// 不支持的公钥跳过，不影响其他公钥
+	keyring := NewKeyring()
+	for i := range jwks.Keys {
+		if jwks.Keys[i].Use != "" && jwks.Keys[i].Use != "sig" {
+			continue
+		}
+		if key, err := jwks.Keys[i].VerificationKey(); err == nil {
+			keyring.Add(key)
+		}
+	}
+	return keyring, cacheMaxAge(resp.Header, now, set.MaxAge), nil
+}
+
+// 根据Cache-Control和Expires计算缓存时间，no-cache、no-store时每次都重新下载(受MinRefreshInterval限制)
+func cacheMaxAge(header http.Header, now time.Time, defaultMaxAge time.Duration) time.Duration {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if directive == "no-cache" || directive == "no-store" {
+			return 0
+		}
+		if strings.HasPrefix(directive, "max-age=") {
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			if t.After(now) {
+				return t.Sub(now)
+			}
+			return 0
+		}
+	}
+	return defaultMaxAge
+}
+
+var (
+	_ KeySource = (*Keyring)(nil)
+	_ KeySource = (*RemoteKeySet)(nil)
+)
@@ -0,0 +1,261 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+//
+// 非对称签名
+//
+// HS256的签发方和校验方使用同一个密钥，任何一个校验服务泄露密钥，都可以伪造Token。
+// 非对称算法由签发方持有私钥，校验方只持有公钥：
+//   RS256: RSA PKCS#1 v1.5 + SHA-256，RSA密钥不少于2048位
+//   ES256: ECDSA P-256 + SHA-256，签名短，性能好
+//   EdDSA: Ed25519，签名确定，不依赖随机数
+//
+// 签发方在Header中设置kid，校验方的Keyring根据kid找到公钥。同一个kid只对应一种算法，
+// Token声明的alg和公钥的算法不一致时拒绝，防止算法混淆攻击。
+//
+
+var (
+	ErrMissingKeyID         = errors.New("jwt: missing kid in token header")
+	ErrUnknownKeyID         = errors.New("jwt: unknown kid")
+	ErrKeyAlgorithmMismatch = errors.New("jwt: token alg does not match key")
+	ErrUnsupportedKey       = errors.New("jwt: unsupported key type")
+	ErrInvalidPEM           = errors.New("jwt: invalid PEM data")
+)
+
+// 默认允许的非对称算法
+var AsymmetricAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// 签名密钥，只在签发方使用
+type SigningKey struct {
+	KeyID      string
+	Method     SigningMethod
+	PrivateKey crypto.Signer // *rsa.PrivateKey、*ecdsa.PrivateKey或ed25519.PrivateKey
+}
+
+// 根据私钥类型选择算法
+func NewSigningKey(keyID string, privateKey crypto.Signer) (*SigningKey, error) {
+	method, err := methodForKey(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{
+		KeyID:      keyID,
+		Method:     method,
+		PrivateKey: privateKey,
+	}, nil
+}
+
+// 对应的公钥
+func (key *SigningKey) Public() *VerificationKey {
+	return &VerificationKey{
+		KeyID:     key.KeyID,
+		Algorithm: key.Method.Alg(),
+		Key:       key.PrivateKey.Public(),
+	}
+}
+
+// 使用该密钥签发
+func (key *SigningKey) Issuer() *TokenIssuer {
+	issuer := NewTokenIssuer(key.Method, key.PrivateKey)
+	issuer.KeyID = key.KeyID
+	return issuer
+}
+
+// 从PEM文件加载私钥，支持PKCS#8(PRIVATE KEY)、PKCS#1(RSA PRIVATE KEY)和SEC 1(EC PRIVATE KEY)
+func LoadSigningKey(keyID string, path string) (*SigningKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSigningKeyPEM(keyID, data)
+}
+
+func ParseSigningKeyPEM(keyID string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	var privateKey interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("jwt: unsupported PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	return NewSigningKey(keyID, signer)
+}
+
+// 校验密钥
+type VerificationKey struct {
+	KeyID     string
+	Algorithm string
+	Key       crypto.PublicKey // *rsa.PublicKey、*ecdsa.PublicKey或ed25519.PublicKey
+}
+
+// 从PEM文件加载公钥，支持PKIX(PUBLIC KEY)、PKCS#1(RSA PUBLIC KEY)和证书(CERTIFICATE)
+func LoadVerificationKey(keyID string, path string) (*VerificationKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseVerificationKeyPEM(keyID, data)
+}
+
+func ParseVerificationKeyPEM(keyID string, data []byte) (*VerificationKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	var publicKey interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			publicKey = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("jwt: unsupported PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	method, err := methodForKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &VerificationKey{
+		KeyID:     keyID,
+		Algorithm: method.Alg(),
+		Key:       publicKey,
+	}, nil
+}
+
+// 根据公钥类型选择算法，ECDSA按曲线选择
+func methodForKey(publicKey crypto.PublicKey) (SigningMethod, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("jwt: RSA key must be at least 2048 bits")
+		}
+		return jwtgo.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwtgo.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwtgo.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwtgo.SigningMethodES512, nil
+		}
+	case ed25519.PublicKey:
+		return SigningMethodEdDSA, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// 校验方的公钥集合，根据Token Header中的kid查找公钥
+type Keyring struct {
+	sync.RWMutex
+	keys map[string]*VerificationKey
+}
+
+func NewKeyring(keys ...*VerificationKey) *Keyring {
+	keyring := &Keyring{
+		keys: make(map[string]*VerificationKey),
+	}
+	for _, key := range keys {
+		keyring.Add(key)
+	}
+	return keyring
+}
+
+// 添加公钥，kid相同时替换
+func (keyring *Keyring) Add(key *VerificationKey) {
+	keyring.Lock()
+	defer keyring.Unlock()
+	keyring.keys[key.KeyID] = key
+}
+
+func (keyring *Keyring) Remove(keyID string) {
+	keyring.Lock()
+	defer keyring.Unlock()
+	delete(keyring.keys, keyID)
+}
+
+func (keyring *Keyring) Get(keyID string) (*VerificationKey, bool) {
+	keyring.RLock()
+	defer keyring.RUnlock()
+	key, ok := keyring.keys[keyID]
+	return key, ok
+}
+
+// 所有公钥，按kid排序
+func (keyring *Keyring) Keys() []*VerificationKey {
+	keyring.RLock()
+	defer keyring.RUnlock()
+	keys := make([]*VerificationKey, 0, len(keyring.keys))
+	for _, key := range keyring.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].KeyID < keys[j].KeyID
+	})
+	return keys
+}
+
+// 实现Keyfunc
+func (keyring *Keyring) Keyfunc(token *Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	if keyID == "" {
+		return nil, ErrMissingKeyID
+	}
+	key, ok := keyring.Get(keyID)
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, ErrKeyAlgorithmMismatch
+	}
+	return key.Key, nil
+}
+
+// 使用Keyring校验，algorithms为空时允许AsymmetricAlgorithms
+func NewKeyringValidator(keyring *Keyring, algorithms ...string) *TokenValidator {
+	if len(algorithms) == 0 {
+		algorithms = AsymmetricAlgorithms
+	}
+	return NewTokenValidator(keyring.Keyfunc, algorithms...)
+}
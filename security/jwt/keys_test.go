@@ -0,0 +1,191 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	testRSAKey     *rsa.PrivateKey
+	testECKey      *ecdsa.PrivateKey
+	testEd25519Key ed25519.PrivateKey
+)
+
+func init() {
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, testEd25519Key, _ = ed25519.GenerateKey(rand.Reader)
+}
+
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestAsymmetricSignAndVerify(t *testing.T) {
+	dir := tempDir(t)
+	tests := []struct {
+		kid  string
+		key  crypto.Signer
+		want string
+	}{
+		{"rsa", testRSAKey, "RS256"},
+		{"ec", testECKey, "ES256"},
+		{"ed", testEd25519Key, "EdDSA"},
+	}
+	keyring := NewKeyring()
+	issuers := make(map[string]*TokenIssuer)
+	for _, tt := range tests {
+		der, _ := x509.MarshalPKCS8PrivateKey(tt.key)
+		signingKey, err := LoadSigningKey(tt.kid, writePEM(t, dir, tt.kid+".key", "PRIVATE KEY", der))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.kid, err)
+		}
+		if signingKey.Method.Alg() != tt.want {
+			t.Errorf("%s: alg = %s", tt.kid, signingKey.Method.Alg())
+		}
+		pub, _ := x509.MarshalPKIXPublicKey(tt.key.Public())
+		verificationKey, err := LoadVerificationKey(tt.kid, writePEM(t, dir, tt.kid+".pub", "PUBLIC KEY", pub))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.kid, err)
+		}
+		keyring.Add(verificationKey)
+		issuers[tt.kid] = signingKey.Issuer()
+	}
+
+	validator := NewKeyringValidator(keyring)
+	validator.Now = func() time.Time { return testNow }
+	for kid, issuer := range issuers {
+		issuer.Now = func() time.Time { return testNow }
+		tokenString, err := issuer.IssueSubject("user-" + kid)
+		if err != nil {
+			t.Fatalf("%s: %v", kid, err)
+		}
+		claims, err := validator.Validate(tokenString)
+		if err != nil || claims.Subject != "user-"+kid {
+			t.Errorf("%s: claims = %+v, err = %v", kid, claims, err)
+		}
+	}
+
+	// 其他私钥签名，kid相同
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged, _ := NewSigningKey("ec", otherKey)
+	tokenString, _ := forged.Issuer().IssueSubject("u")
+	if _, err := validator.Validate(tokenString); err != ErrSignatureInvalid {
+		t.Errorf("forged: err = %v", err)
+	}
+}
+
+func TestKeyringRejects(t *testing.T) {
+	rsaKey, _ := NewSigningKey("rsa", testRSAKey)
+	ecKey, _ := NewSigningKey("ec", testECKey)
+	keyring := NewKeyring(rsaKey.Public(), ecKey.Public())
+	validator := NewKeyringValidator(keyring, "RS256", "ES256", "HS256")
+
+	issue := func(issuer *TokenIssuer) string {
+		tokenString, err := issuer.IssueSubject("u")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokenString
+	}
+	noKid := rsaKey.Issuer()
+	noKid.KeyID = ""
+	unknown := rsaKey.Issuer()
+	unknown.KeyID = "other"
+	// RSA私钥签名，却使用EC公钥的kid
+	mismatch := rsaKey.Issuer()
+	mismatch.KeyID = "ec"
+	// 用公开的RSA公钥作为HMAC密钥伪造Token
+	pub, _ := x509.MarshalPKIXPublicKey(testRSAKey.Public())
+	confusion := NewHMACIssuer(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+	confusion.KeyID = "rsa"
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"missing kid", issue(noKid), ErrMissingKeyID},
+		{"unknown kid", issue(unknown), ErrUnknownKeyID},
+		{"alg mismatch", issue(mismatch), ErrKeyAlgorithmMismatch},
+		{"hmac confusion", issue(confusion), ErrKeyAlgorithmMismatch},
+	}
+	for _, tt := range tests {
+		if _, err := validator.Validate(tt.token); err != tt.want {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	keyring.Remove("rsa")
+	if _, err := validator.Validate(issue(rsaKey.Issuer())); err != ErrUnknownKeyID {
+		t.Errorf("removed key: err = %v", err)
+	}
+	if keys := keyring.Keys(); len(keys) != 1 || keys[0].KeyID != "ec" {
+		t.Errorf("keys = %v", keys)
+	}
+}
+
+func TestParseKeyFormats(t *testing.T) {
+	if key, err := ParseSigningKeyPEM("k", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testRSAKey)})); err != nil || key.Method.Alg() != "RS256" {
+		t.Errorf("PKCS#1: key = %v, err = %v", key, err)
+	}
+	ecDER, _ := x509.MarshalECPrivateKey(testECKey)
+	if key, err := ParseSigningKeyPEM("k", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER})); err != nil || key.Method.Alg() != "ES256" {
+		t.Errorf("SEC 1: key = %v, err = %v", key, err)
+	}
+	if key, err := ParseVerificationKeyPEM("k", pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&testRSAKey.PublicKey)})); err != nil || key.Algorithm != "RS256" {
+		t.Errorf("PKCS#1 public: key = %v, err = %v", key, err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "jwt"},
+		NotBefore:    testNow,
+		NotAfter:     testNow.Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, testEd25519Key.Public(), testEd25519Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := ParseVerificationKeyPEM("k", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})); err != nil || key.Algorithm != "EdDSA" {
+		t.Errorf("certificate: key = %v, err = %v", key, err)
+	}
+
+	if _, err := ParseSigningKeyPEM("k", []byte("not pem")); err != ErrInvalidPEM {
+		t.Errorf("invalid PEM: err = %v", err)
+	}
+	smallKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	if _, err := NewSigningKey("k", smallKey); err == nil {
+		t.Error("1024-bit RSA key accepted")
+	}
+	p224, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if _, err := NewSigningKey("k", p224); err != ErrUnsupportedKey {
+		t.Errorf("P-224: err = %v", err)
+	}
+}
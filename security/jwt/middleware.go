@@ -0,0 +1,172 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//
+// Bearer Token认证中间件
+//
+// 从请求中取出Access Token，使用TokenValidator校验，通过后把声明放入请求的Context，处理函数通过ClaimsFromContext获取。
+// Token的位置(RFC 6750 第2节)：
+// 1)Authorization: Bearer <token>，默认开启
+// 2)Cookie，浏览器直接访问的页面使用，需要配置Cookie名称，注意防范CSRF
+// 3)查询参数access_token，会出现在访问日志和Referer中，只在无法设置请求头的场景(例如WebSocket)开启
+// 同一个请求只能使用一种方式，同时出现时按invalid_request拒绝。
+//
+// 认证失败时返回401和WWW-Authenticate头：
+//   WWW-Authenticate: Bearer realm="api"                                   没有Token，包括Authorization使用其他认证方案(例如Basic)
+//   WWW-Authenticate: Bearer realm="api", error="invalid_token", ...       Token无效、过期或被吊销
+//   WWW-Authenticate: Bearer realm="api", error="invalid_request", ...     请求格式错误，返回400
+//   WWW-Authenticate: Bearer realm="api", error="insufficient_scope", ...  不满足Checks，返回403
+// JWKS下载失败返回503，吊销列表出错返回500，不返回invalid_token，以免客户端在故障期间丢弃有效的Token。
+//
+// 参考 RFC 6750 https://tools.ietf.org/html/rfc6750
+//
+
+type Middleware struct {
+	Validator  *TokenValidator
+	Realm      string
+	Cookie     string        // 从Cookie中读取Token，为空时不读取
+	QueryParam string        // 从查询参数中读取Token，通常为access_token，为空时不读取
+	NewClaims  func() Claims // 创建解析声明的对象，为空时使用RegisteredClaims
+	Checks     []ClaimsCheck // 接口的权限要求(例如RequireRoles)，不满足时返回403
+}
+
+func NewMiddleware(validator *TokenValidator) *Middleware {
+	return &Middleware{Validator: validator}
+}
+
+type contextKey int
+
+const (
+	claimsKey contextKey = iota
+	tokenKey
+)
+
+// 包装http.Handler，认证通过后才调用next
+//
+//	http.Handle("/api/", jwt.NewMiddleware(validator).Handler(api))
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, err := m.extract(r)
+		if err != nil {
+			m.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if tokenString == "" {
+			m.writeError(w, http.StatusUnauthorized, "", "")
+			return
+		}
+		claims := m.newClaims()
+		token, err := m.Validator.ValidateWithClaims(tokenString, claims)
+		if err == ErrJWKSUnavailable {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		var storeErr *RevocationStoreError
+		if errors.As(err, &storeErr) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			// 不区分具体原因，客户端收到invalid_token时刷新Token或重新登录
+			m.writeError(w, http.StatusUnauthorized, "invalid_token", "the access token is invalid")
+			return
+		}
+		for _, check := range m.Checks {
+			if err := check(claims); err != nil {
+				m.writeError(w, http.StatusForbidden, "insufficient_scope", "the access token has insufficient privileges")
+				return
+			}
+		}
+		ctx := context.WithValue(r.Context(), claimsKey, claims)
+		ctx = context.WithValue(ctx, tokenKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (m *Middleware) newClaims() Claims {
+	if m.NewClaims != nil {
+		return m.NewClaims()
+	}
+	return &RegisteredClaims{}
+}
+
+// 取出Token，没有Token时返回空字符串
+func (m *Middleware) extract(r *http.Request) (string, error) {
+	var tokens []string
+	// 认证方案不区分大小写，其他认证方案按没有Token处理
+	if authorization := r.Header.Get("Authorization"); len(authorization) >= 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		tokens = append(tokens, strings.TrimSpace(authorization[7:]))
+	}
+	if m.Cookie != "" {
+		if cookie, err := r.Cookie(m.Cookie); err == nil && cookie.Value != "" {
+			tokens = append(tokens, cookie.Value)
+		}
+	}
+	if m.QueryParam != "" {
+		if values := r.URL.Query()[m.QueryParam]; len(values) > 0 {
+			tokens = append(tokens, values...)
+		}
+	}
+	switch len(tokens) {
+	case 0:
+		return "", nil
+	case 1:
+		if tokens[0] == "" {
+			return "", errors.New("empty bearer token")
+		}
+		return tokens[0], nil
+	}
+	return "", errors.New("multiple access tokens")
+}
+
+func (m *Middleware) writeError(w http.ResponseWriter, status int, code string, description string) {
+	WriteBearerError(w, m.Realm, status, code, description)
+}
+
+// 按RFC 6750 3.1返回错误，code为空时只返回realm；权限不足时status为403，code为insufficient_scope
+func WriteBearerError(w http.ResponseWriter, realm string, status int, code string, description string) {
+	var params []string
+	if realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", realm))
+	}
+	if code != "" {
+		params = append(params, fmt.Sprintf("error=%q", code))
+	}
+	if description != "" {
+		params = append(params, fmt.Sprintf("error_description=%q", description))
+	}
+	challenge := "Bearer"
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// 中间件放入Context的声明，类型为Middleware.NewClaims返回的类型
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(Claims)
+	return claims, ok
+}
+
+// 中间件放入Context的标准声明
+func RegisteredClaimsFromContext(ctx context.Context) (*RegisteredClaims, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return claims.Registered(), true
+}
+
+// 中间件放入Context的Token，可以读取Header
+func TokenFromContext(ctx context.Context) (*Token, bool) {
+	token, ok := ctx.Value(tokenKey).(*Token)
+	return token, ok
+}
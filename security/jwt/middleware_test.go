@@ -0,0 +1,138 @@
+package jwt
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	issuer := newTestIssuer()
+	valid, _ := issuer.Issue(&testClaims{RegisteredClaims: RegisteredClaims{Subject: "alice"}, Foo: "bar"})
+	other := newTestIssuer()
+	other.Key = []byte("another secret")
+	forged, _ := other.IssueSubject("alice")
+
+	m := NewMiddleware(newTestValidator())
+	m.Realm = "api"
+	m.Cookie = "access_token"
+	m.QueryParam = "access_token"
+	m.NewClaims = func() Claims { return &testClaims{} }
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		registered, _ := RegisteredClaimsFromContext(r.Context())
+		token, _ := TokenFromContext(r.Context())
+		if !ok || claims.(*testClaims).Foo != "bar" || registered.Subject != "alice" || token.Header["alg"] != "HS256" {
+			t.Errorf("claims = %+v", claims)
+		}
+		w.Write([]byte(registered.Subject))
+	}))
+
+	cases := []struct {
+		name          string
+		url           string
+		authorization string
+		cookie        string
+		status        int
+		challenge     string
+	}{
+		{"header", "/", "Bearer " + valid, "", http.StatusOK, ""},
+		{"lowercase scheme", "/", "bearer " + valid, "", http.StatusOK, ""},
+		{"cookie", "/", "", valid, http.StatusOK, ""},
+		{"query", "/?access_token=" + valid, "", "", http.StatusOK, ""},
+		{"missing", "/", "", "", http.StatusUnauthorized, `Bearer realm="api"`},
+		{"forged", "/", "Bearer " + forged, "", http.StatusUnauthorized,
+			`Bearer realm="api", error="invalid_token", error_description="the access token is invalid"`},
+		{"garbage", "/", "Bearer abc", "", http.StatusUnauthorized,
+			`Bearer realm="api", error="invalid_token", error_description="the access token is invalid"`},
+		{"basic", "/", "Basic YWxpY2U6c2VjcmV0", "", http.StatusUnauthorized, `Bearer realm="api"`},
+		{"basic and cookie", "/", "Basic YWxpY2U6c2VjcmV0", valid, http.StatusOK, ""},
+		{"empty", "/", "Bearer ", "", http.StatusBadRequest,
+			`Bearer realm="api", error="invalid_request", error_description="empty bearer token"`},
+		{"multiple", "/?access_token=" + valid, "Bearer " + valid, "", http.StatusBadRequest,
+			`Bearer realm="api", error="invalid_request", error_description="multiple access tokens"`},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, c.url, nil)
+		if c.authorization != "" {
+			r.Header.Set("Authorization", c.authorization)
+		}
+		if c.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "access_token", Value: c.cookie})
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.status || w.Header().Get("WWW-Authenticate") != c.challenge {
+			t.Errorf("%s: %d %q", c.name, w.Code, w.Header().Get("WWW-Authenticate"))
+		}
+		if c.status == http.StatusOK && w.Body.String() != "alice" {
+			t.Errorf("%s: body = %q", c.name, w.Body)
+		}
+	}
+}
+
+func TestMiddlewareDefaults(t *testing.T) {
+	token, _ := newTestIssuer().IssueSubject("alice")
+	handler := NewMiddleware(newTestValidator()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		if _, ok := claims.(*RegisteredClaims); !ok {
+			t.Errorf("claims = %T", claims)
+		}
+	}))
+
+	// 默认只从Authorization头读取
+	r := httptest.NewRequest(http.MethodGet, "/?access_token="+token, nil)
+	r.AddCookie(&http.Cookie{Name: "access_token", Value: token})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("%d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("header: %d", w.Code)
+	}
+
+	if _, ok := ClaimsFromContext(r.Context()); ok {
+		t.Error("claims in unauthenticated context")
+	}
+}
+
+// 只有IsRevoked会被调用
+type failingRevocationStore struct {
+	RevocationStore
+}
+
+func (failingRevocationStore) IsRevoked(claims *RegisteredClaims) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+// JWKS、吊销列表不可用时返回5xx，不返回invalid_token
+func TestMiddlewareBackendErrors(t *testing.T) {
+	token, _ := newTestIssuer().IssueSubject("alice")
+	serve := func(validator *TokenValidator) *httptest.ResponseRecorder {
+		handler := NewMiddleware(validator).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	jwks := newTestValidator()
+	jwks.Keyfunc = func(token *Token) (interface{}, error) { return nil, ErrJWKSUnavailable }
+	if w := serve(jwks); w.Code != http.StatusServiceUnavailable || w.Header().Get("WWW-Authenticate") != "" {
+		t.Errorf("jwks: %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+
+	revocations := newTestValidator()
+	revocations.Revocations = failingRevocationStore{}
+	if w := serve(revocations); w.Code != http.StatusInternalServerError || w.Header().Get("WWW-Authenticate") != "" {
+		t.Errorf("revocation store: %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
@@ -0,0 +1,244 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//
+// 吊销
+//
+// JWT是自包含的，签发后在过期之前一直有效，用户注销、修改密码或者Token泄露时，需要校验方记住被吊销的Token：
+// 1)按jti吊销单个Token，记录保存到Token过期为止，之后Token本身就无效了
+// 2)按sub吊销某个时间之前签发的所有Token(强制下线)，iat不晚于该时间的Token都无效，同一个sub只保留最后一次的时间
+//
+// 吊销列表只需要保存未过期的Token，所以Token的有效期越短，吊销列表越小。
+//
+
+var ErrTokenRevoked = errors.New("jwt: token has been revoked")
+
+type RevocationStore interface {
+	// 吊销jti，expiresAt之后可以删除记录
+	Revoke(jti string, expiresAt time.Time) error
+	// 吊销subject在before之前(含)签发的所有Token
+	RevokeSubject(subject string, before time.Time) error
+	// 检查Token是否被吊销
+	IsRevoked(claims *RegisteredClaims) (bool, error)
+}
+
+// 基于内存的RevocationStore，过期的jti在Revoke时定期清理
+type MemoryRevocationStore struct {
+	sync.RWMutex
+	tokens    map[string]time.Time // jti -> exp
+	subjects  map[string]time.Time // sub -> before
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:   make(map[string]time.Time),
+		subjects: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+func (store *MemoryRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	store.Lock()
+	defer store.Unlock()
+	store.revoke(jti, expiresAt)
+	return nil
+}
+
+func (store *MemoryRevocationStore) revoke(jti string, expiresAt time.Time) {
+	now := store.now()
+	if now.Sub(store.lastSweep) > time.Minute {
+		for k, exp := range store.tokens {
+			if now.After(exp) {
+				delete(store.tokens, k)
+			}
+		}
+		store.lastSweep = now
+	}
+	if expiresAt.After(store.tokens[jti]) {
+		store.tokens[jti] = expiresAt
+	}
+}
+
+func (store *MemoryRevocationStore) RevokeSubject(subject string, before time.Time) error {
+	store.Lock()
+	defer store.Unlock()
+	store.revokeSubject(subject, before)
+	return nil
+}
+
+func (store *MemoryRevocationStore) revokeSubject(subject string, before time.Time) {
+	if before.After(store.subjects[subject]) {
+		store.subjects[subject] = before
+	}
+}
+
+func (store *MemoryRevocationStore) IsRevoked(claims *RegisteredClaims) (bool, error) {
+	store.RLock()
+	defer store.RUnlock()
+	if _, ok := store.tokens[claims.ID]; ok && claims.ID != "" {
+		return true, nil
+	}
+	// 没有iat的Token无法判断签发时间，按已吊销处理
+	if before, ok := store.subjects[claims.Subject]; ok && claims.IssuedAt <= before.Unix() {
+		return true, nil
+	}
+	return false, nil
+}
+
+// 基于文件的RevocationStore，每次吊销后把整个列表写入文件，适合吊销不频繁的场景
+type FileRevocationStore struct {
+	*MemoryRevocationStore
+	path string
+}
+
+type revocationFile struct {
+	Tokens   map[string]time.Time `json:"tokens"`
+	Subjects map[string]time.Time `json:"subjects"`
+}
+
+// 加载吊销列表，文件不存在时在第一次吊销时创建
+func NewFileRevocationStore(path string) (*FileRevocationStore, error) {
+	store := &FileRevocationStore{
+		MemoryRevocationStore: NewMemoryRevocationStore(),
+		path:                  path,
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file revocationFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for jti, exp := range file.Tokens {
+		store.tokens[jti] = exp
+	}
+	for subject, before := range file.Subjects {
+		store.subjects[subject] = before
+	}
+	return store, nil
+}
+
+func (store *FileRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	store.Lock()
+	defer store.Unlock()
+	store.revoke(jti, expiresAt)
+	return store.save()
+}
+
+func (store *FileRevocationStore) RevokeSubject(subject string, before time.Time) error {
+	store.Lock()
+	defer store.Unlock()
+	store.revokeSubject(subject, before)
+	return store.save()
+}
+
+// 先写临时文件再rename；调用方需要持有写锁
+func (store *FileRevocationStore) save() error {
+	data, err := json.Marshal(revocationFile{Tokens: store.tokens, Subjects: store.subjects})
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), store.path)
+}
+
+// 吊销接口，参考RFC 7009
+//
+//	POST token=<jwt>                             吊销Token，Token的持有者即可调用
+//	POST subject=<sub>&before=<RFC 3339时间>      吊销sub在before之前签发的所有Token，before默认为当前时间，需要Authorize通过
+//
+// 按RFC 7009，Token无效或已过期时同样返回200，调用方不需要区分。
+type RevocationHandler struct {
+	Validator *TokenValidator
+	Store     RevocationStore
+	Authorize func(r *http.Request) bool // 按sub吊销的权限检查，为空时不允许按sub吊销
+	Now       func() time.Time
+}
+
+func NewRevocationHandler(validator *TokenValidator, store RevocationStore) *RevocationHandler {
+	return &RevocationHandler{
+		Validator: validator,
+		Store:     store,
+		Now:       time.Now,
+	}
+}
+
+func (handler *RevocationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if subject := r.PostForm.Get("subject"); subject != "" {
+		if handler.Authorize == nil || !handler.Authorize(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		before := handler.Now()
+		if v := r.PostForm.Get("before"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "invalid before", http.StatusBadRequest)
+				return
+			}
+			before = t
+		}
+		if err := handler.Store.RevokeSubject(subject, before); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	tokenString := r.PostForm.Get("token")
+	if tokenString == "" {
+		http.Error(w, "missing token", http.StatusBadRequest)
+		return
+	}
+	// 只吊销签名有效的Token，防止任意写入吊销列表
+	claims, err := handler.Validator.Validate(tokenString)
+	if err == nil && claims.ID != "" {
+		// 不过期的Token永久吊销
+		expiresAt := time.Unix(claims.ExpiresAt, 0)
+		if claims.ExpiresAt == 0 {
+			expiresAt = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+		}
+		if err := handler.Store.Revoke(claims.ID, expiresAt); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
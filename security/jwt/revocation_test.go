@@ -0,0 +1,143 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidatorRevocation(t *testing.T) {
+	now := testNow
+	store := NewMemoryRevocationStore()
+	store.now = func() time.Time { return now }
+	validator := newTestValidator()
+	validator.Revocations = store
+	issuer := newTestIssuer()
+
+	a := &RegisteredClaims{Subject: "alice"}
+	tokenA, _ := issuer.Issue(a)
+	tokenB, _ := issuer.IssueSubject("alice")
+	tokenC, _ := issuer.IssueSubject("bob")
+
+	store.Revoke(a.ID, time.Unix(a.ExpiresAt, 0))
+	if _, err := validator.Validate(tokenA); err != ErrTokenRevoked {
+		t.Errorf("revoked jti: err = %v", err)
+	}
+	if _, err := validator.Validate(tokenB); err != nil {
+		t.Errorf("other token: err = %v", err)
+	}
+
+	// 强制下线：之前签发的Token都失效，之后签发的有效
+	store.RevokeSubject("alice", testNow)
+	if _, err := validator.Validate(tokenB); err != ErrTokenRevoked {
+		t.Errorf("revoked subject: err = %v", err)
+	}
+	if _, err := validator.Validate(tokenC); err != nil {
+		t.Errorf("other subject: err = %v", err)
+	}
+	issuer.Now = func() time.Time { return testNow.Add(time.Second) }
+	tokenD, _ := issuer.IssueSubject("alice")
+	if _, err := validator.Validate(tokenD); err != nil {
+		t.Errorf("issued after logout: err = %v", err)
+	}
+	// 较早的时间不会覆盖
+	store.RevokeSubject("alice", testNow.Add(-time.Hour))
+	if _, err := validator.Validate(tokenB); err != ErrTokenRevoked {
+		t.Errorf("earlier cutoff overrides: err = %v", err)
+	}
+
+	// 过期的jti被清理
+	now = testNow.Add(DefaultTokenTTL + 2*time.Minute)
+	store.Revoke("other", now.Add(time.Hour))
+	if _, ok := store.tokens[a.ID]; ok {
+		t.Error("expired jti not swept")
+	}
+}
+
+func TestFileRevocationStore(t *testing.T) {
+	path := filepath.Join(tempDir(t), "revocations.json")
+	store, err := NewFileRevocationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Revoke("jti-1", time.Now().Add(time.Hour))
+	store.RevokeSubject("alice", testNow)
+
+	reloaded, err := NewFileRevocationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := reloaded.IsRevoked(&RegisteredClaims{ID: "jti-1", IssuedAt: testNow.Add(time.Hour).Unix()}); !revoked {
+		t.Error("jti not persisted")
+	}
+	if revoked, _ := reloaded.IsRevoked(&RegisteredClaims{Subject: "alice", IssuedAt: testNow.Unix()}); !revoked {
+		t.Error("subject not persisted")
+	}
+	if revoked, _ := reloaded.IsRevoked(&RegisteredClaims{Subject: "alice", IssuedAt: testNow.Unix() + 1}); revoked {
+		t.Error("token issued after cutoff revoked")
+	}
+}
+
+func TestRevocationHandler(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	validator := newTestValidator()
+	validator.Revocations = store
+	handler := NewRevocationHandler(validator, store)
+	handler.Now = func() time.Time { return testNow }
+	handler.Authorize = func(r *http.Request) bool { return r.Header.Get("X-Admin") == "yes" }
+
+	post := func(form url.Values, admin bool) int {
+		req := httptest.NewRequest("POST", "/revoke", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if admin {
+			req.Header.Set("X-Admin", "yes")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	issuer := newTestIssuer()
+	token, _ := issuer.IssueSubject("alice")
+	if code := post(url.Values{"token": {token}}, false); code != http.StatusOK {
+		t.Fatalf("revoke token: status = %d", code)
+	}
+	if _, err := validator.Validate(token); err != ErrTokenRevoked {
+		t.Errorf("err = %v", err)
+	}
+	// 无效的Token同样返回200，但不写入吊销列表
+	if code := post(url.Values{"token": {"garbage"}}, false); code != http.StatusOK {
+		t.Errorf("invalid token: status = %d", code)
+	}
+	if len(store.tokens) != 1 {
+		t.Errorf("tokens = %v", store.tokens)
+	}
+	if code := post(url.Values{}, false); code != http.StatusBadRequest {
+		t.Errorf("missing token: status = %d", code)
+	}
+
+	other, _ := issuer.IssueSubject("bob")
+	if code := post(url.Values{"subject": {"bob"}}, false); code != http.StatusForbidden {
+		t.Errorf("subject without permission: status = %d", code)
+	}
+	if code := post(url.Values{"subject": {"bob"}, "before": {"yesterday"}}, true); code != http.StatusBadRequest {
+		t.Errorf("invalid before: status = %d", code)
+	}
+	if code := post(url.Values{"subject": {"bob"}}, true); code != http.StatusOK {
+		t.Errorf("revoke subject: status = %d", code)
+	}
+	if _, err := validator.Validate(other); err != ErrTokenRevoked {
+		t.Errorf("subject revoked: err = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/revoke", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,283 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//
+// 签名密钥轮换
+//
+// 固定的签名密钥一旦泄露，攻击者可以一直伪造Token。KeyRotator按计划生成新的签名密钥，每个密钥经历三个阶段：
+// 1)预发布：ActivateAt之前，公钥已经出现在JWKS中，但不用于签名；校验方的JWKS缓存(max-age)在这段时间内刷新，
+//   切换后用新密钥签发的Token不会因为校验方没有公钥而失败，所以PublishAhead要大于JWKS的缓存时间
+// 2)签名：ActivateAt到下一个密钥的ActivateAt之间，用于签发Token
+// 3)退役：不再签名，公钥保留到它签发的最后一个Token过期(下一个密钥的ActivateAt + TokenTTL)，之后删除
+//
+// 密钥历史(包括私钥)保存在文件中，重启后继续使用，文件权限为0600，应当放在只有签发服务可以读取的位置。
+//
+
+var ErrNoSigningKey = errors.New("jwt: no active signing key")
+
+const (
+	DefaultRotationInterval = 24 * time.Hour
+	DefaultPublishAhead     = 2 * DefaultJWKSMaxAge
+)
+
+// 提供当前的签名密钥，KeyRotator实现该接口，TokenIssuer每次签发时获取
+type SigningKeySource interface {
+	SigningKey() (*SigningKey, error)
+}
+
+type rotatingKey struct {
+	signingKey *SigningKey
+	activateAt time.Time
+}
+
+type KeyRotator struct {
+	Path             string        // 密钥历史文件
+	Algorithm        string        // 新密钥的算法：RS256、ES256或EdDSA
+	RotationInterval time.Duration // 每个密钥的签名时长
+	PublishAhead     time.Duration // 新密钥提前发布的时长
+	TokenTTL         time.Duration // Token的最长有效期，退役的密钥保留这么久，不能小于TokenIssuer.TTL
+	Now              func() time.Time
+
+	mu   sync.RWMutex
+	keys []*rotatingKey // 按activateAt排序
+}
+
+// 加载密钥历史，文件不存在时在第一次Rotate时创建
+func NewKeyRotator(path string, algorithm string) (*KeyRotator, error) {
+	rotator := &KeyRotator{
+		Path:             path,
+		Algorithm:        algorithm,
+		RotationInterval: DefaultRotationInterval,
+		PublishAhead:     DefaultPublishAhead,
+		TokenTTL:         DefaultTokenTTL,
+		Now:              time.Now,
+	}
+	if _, err := generateKey(algorithm); err != nil {
+		return nil, err
+	}
+	if err := rotator.load(); err != nil {
+		return nil, err
+	}
+	return rotator, nil
+}
+
+// 按计划生成新密钥、删除过期的密钥，有变化时写文件
+func (rotator *KeyRotator) Rotate() error {
+	rotator.mu.Lock()
+	defer rotator.mu.Unlock()
+	now := rotator.Now()
+	keys := rotator.keys
+	changed := false
+
+	// 还没有可以签名的密钥时立即生成一个
+	if len(keys) == 0 || keys[0].activateAt.After(now) {
+		key, err := rotator.newKey(now)
+		if err != nil {
+			return err
+		}
+		keys = append([]*rotatingKey{key}, keys...)
+		changed = true
+	}
+
+	// 最新的密钥签名满RotationInterval - PublishAhead后，预发布下一个密钥
+	last := keys[len(keys)-1]
+	if !now.Before(last.activateAt.Add(rotator.RotationInterval - rotator.PublishAhead)) {
+		activateAt := last.activateAt.Add(rotator.RotationInterval)
+		// 服务停止过一段时间时，仍然保证新密钥提前发布
+		if earliest := now.Add(rotator.PublishAhead); activateAt.Before(earliest) {
+			activateAt = earliest
+		}
+		key, err := rotator.newKey(activateAt)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		changed = true
+	}
+
+	// 删除退役且签发的Token都已过期的密钥
+	for len(keys) > 1 && now.After(keys[1].activateAt.Add(rotator.TokenTTL+DefaultLeeway)) {
+		keys = keys[1:]
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	old := rotator.keys
+	rotator.keys = keys
+	if err := rotator.save(); err != nil {
+		rotator.keys = old
+		return err
+	}
+	return nil
+}
+
+// 定时调用Rotate，直到ctx结束；Rotate失败时调用onError，为空时忽略
+func (rotator *KeyRotator) Run(ctx context.Context, checkInterval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		if err := rotator.Rotate(); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 当前用于签名的密钥，实现SigningKeySource
+func (rotator *KeyRotator) SigningKey() (*SigningKey, error) {
+	rotator.mu.RLock()
+	defer rotator.mu.RUnlock()
+	now := rotator.Now()
+	for i := len(rotator.keys) - 1; i >= 0; i-- {
+		if !rotator.keys[i].activateAt.After(now) {
+			return rotator.keys[i].signingKey, nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+// 所有发布的公钥，包括预发布和退役的密钥，实现KeySource
+func (rotator *KeyRotator) Keys() []*VerificationKey {
+	rotator.mu.RLock()
+	defer rotator.mu.RUnlock()
+	keys := make([]*VerificationKey, 0, len(rotator.keys))
+	for _, key := range rotator.keys {
+		keys = append(keys, key.signingKey.Public())
+	}
+	return keys
+}
+
+// 本地校验使用的Keyfunc
+func (rotator *KeyRotator) Keyfunc(token *Token) (interface{}, error) {
+	return NewKeyring(rotator.Keys()...).Keyfunc(token)
+}
+
+// 使用当前密钥签发的TokenIssuer
+func NewRotatingIssuer(keys SigningKeySource) *TokenIssuer {
+	issuer := NewTokenIssuer(nil, nil)
+	issuer.SigningKeys = keys
+	return issuer
+}
+
+func (rotator *KeyRotator) newKey(activateAt time.Time) (*rotatingKey, error) {
+	privateKey, err := generateKey(rotator.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	signingKey, err := NewSigningKey(hex.EncodeToString(b), privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &rotatingKey{signingKey: signingKey, activateAt: activateAt.UTC()}, nil
+}
+
+func generateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case "RS256":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	}
+	return nil, fmt.Errorf("jwt: unsupported rotation algorithm %q", algorithm)
+}
+
+// 文件中保存的密钥
+type storedSigningKey struct {
+	KeyID      string    `json:"kid"`
+	PrivateKey string    `json:"privateKey"` // PKCS#8 PEM
+	ActivateAt time.Time `json:"activateAt"`
+}
+
+func (rotator *KeyRotator) load() error {
+	data, err := ioutil.ReadFile(rotator.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var stored []storedSigningKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("jwt: invalid key history %s: %v", rotator.Path, err)
+	}
+	keys := make([]*rotatingKey, 0, len(stored))
+	for _, s := range stored {
+		signingKey, err := ParseSigningKeyPEM(s.KeyID, []byte(s.PrivateKey))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, &rotatingKey{signingKey: signingKey, activateAt: s.ActivateAt})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].activateAt.Before(keys[j].activateAt)
+	})
+	rotator.keys = keys
+	return nil
+}
+
+// 先写临时文件再rename；调用方需要持有写锁
+func (rotator *KeyRotator) save() error {
+	stored := make([]storedSigningKey, 0, len(rotator.keys))
+	for _, key := range rotator.keys {
+		der, err := x509.MarshalPKCS8PrivateKey(key.signingKey.PrivateKey)
+		if err != nil {
+			return err
+		}
+		stored = append(stored, storedSigningKey{
+			KeyID:      key.signingKey.KeyID,
+			PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+			ActivateAt: key.activateAt,
+		})
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(rotator.Path), filepath.Base(rotator.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), rotator.Path)
+}
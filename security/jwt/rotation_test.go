@@ -0,0 +1,140 @@
+package jwt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestRotator(t *testing.T, now *time.Time) *KeyRotator {
+	rotator, err := NewKeyRotator(filepath.Join(tempDir(t), "keys.json"), "EdDSA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotator.Now = func() time.Time { return *now }
+	return rotator
+}
+
+func TestKeyRotatorSchedule(t *testing.T) {
+	now := testNow
+	rotator := newTestRotator(t, &now)
+	if _, err := rotator.SigningKey(); err != ErrNoSigningKey {
+		t.Errorf("before rotate: err = %v", err)
+	}
+	if err := rotator.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	first, err := rotator.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(rotator.Path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file: %v, %v", info, err)
+	}
+
+	issuer := NewRotatingIssuer(rotator)
+	issuer.Now = rotator.Now
+	validator := NewTokenValidator(rotator.Keyfunc, AsymmetricAlgorithms...)
+	validator.Now = rotator.Now
+	oldToken, err := issuer.IssueSubject("u")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 到时间之前不预发布
+	now = testNow.Add(DefaultRotationInterval - DefaultPublishAhead - time.Second)
+	rotator.Rotate()
+	if len(rotator.Keys()) != 1 {
+		t.Fatalf("keys = %d", len(rotator.Keys()))
+	}
+
+	// 预发布：公钥出现在JWKS中，但还不用于签名
+	now = testNow.Add(DefaultRotationInterval - DefaultPublishAhead)
+	rotator.Rotate()
+	keys := rotator.Keys()
+	if len(keys) != 2 {
+		t.Fatalf("keys = %d", len(keys))
+	}
+	if key, _ := rotator.SigningKey(); key.KeyID != first.KeyID {
+		t.Errorf("signing with pending key %s", key.KeyID)
+	}
+	set, err := NewJSONWebKeySet(keys)
+	if err != nil || len(set.Keys) != 2 {
+		t.Errorf("jwks = %+v, err = %v", set, err)
+	}
+
+	// 切换：新密钥签名，旧Token仍然有效
+	now = testNow.Add(DefaultRotationInterval)
+	rotator.Rotate()
+	second, _ := rotator.SigningKey()
+	if second.KeyID == first.KeyID || second.KeyID != keys[1].KeyID {
+		t.Fatalf("second = %s, first = %s", second.KeyID, first.KeyID)
+	}
+	newToken, _ := issuer.IssueSubject("u")
+	if _, err := validator.Validate(newToken); err != nil {
+		t.Error(err)
+	}
+	validator.Now = func() time.Time { return testNow }
+	if _, err := validator.Validate(oldToken); err != nil {
+		t.Errorf("old token after rotation: %v", err)
+	}
+
+	// 旧密钥签发的Token都过期后删除
+	now = testNow.Add(DefaultRotationInterval + DefaultTokenTTL + DefaultLeeway + time.Second)
+	rotator.Rotate()
+	if keys := rotator.Keys(); len(keys) != 1 || keys[0].KeyID != second.KeyID {
+		t.Errorf("keys after retire = %v", keys)
+	}
+	if _, err := validator.Validate(oldToken); err != ErrUnknownKeyID {
+		t.Errorf("retired key: err = %v", err)
+	}
+
+	// 重启后从文件恢复
+	reloaded, err := NewKeyRotator(rotator.Path, "EdDSA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded.Now = rotator.Now
+	if key, err := reloaded.SigningKey(); err != nil || key.KeyID != second.KeyID {
+		t.Errorf("reloaded key = %v, err = %v", key, err)
+	}
+}
+
+// 服务停止超过RotationInterval后，新密钥仍然提前PublishAhead发布
+func TestKeyRotatorAfterDowntime(t *testing.T) {
+	now := testNow
+	rotator := newTestRotator(t, &now)
+	rotator.Rotate()
+	first, _ := rotator.SigningKey()
+
+	now = testNow.Add(3 * DefaultRotationInterval)
+	rotator.Rotate()
+	if key, _ := rotator.SigningKey(); key.KeyID != first.KeyID {
+		t.Error("switched to unpublished key")
+	}
+	now = now.Add(DefaultPublishAhead)
+	if key, _ := rotator.SigningKey(); key.KeyID == first.KeyID {
+		t.Error("not switched after publish ahead")
+	}
+}
+
+func TestKeyRotatorAlgorithms(t *testing.T) {
+	for _, alg := range []string{"RS256", "ES256", "EdDSA"} {
+		now := testNow
+		rotator, err := NewKeyRotator(filepath.Join(tempDir(t), "keys.json"), alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rotator.Now = func() time.Time { return now }
+		if err := rotator.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		if key, _ := rotator.SigningKey(); key.Method.Alg() != alg {
+			t.Errorf("alg = %s, want %s", key.Method.Alg(), alg)
+		}
+	}
+	if _, err := NewKeyRotator("keys.json", "HS256"); err == nil {
+		t.Error("HS256 accepted")
+	}
+}
@@ -0,0 +1,341 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//
+// Access Token + Refresh Token
+//
+// Access Token是短期的JWT，校验方不需要查询签发方；Refresh Token是随机的字符串，只在签发方保存，用来换取新的Access Token。
+// 1)登录：签发一对Token，Refresh Token属于一个新的家族(family)，同一次登录后续刷新得到的Refresh Token都属于这个家族
+// 2)刷新：Refresh Token只能使用一次，每次刷新都签发新的Refresh Token(轮换)，旧的标记为已使用
+// 3)重用检测：已使用的Refresh Token再次出现，说明它被盗用了(攻击者或者合法用户，其中一方先用过)，
+//   无法区分是谁，所以吊销整个家族，双方都需要重新登录
+// 4)注销：吊销Refresh Token所在的家族
+//
+// 服务端只保存Refresh Token的SHA-256，存储泄露时不能直接使用。
+// 配置RevocationStore时，吊销家族的同时吊销该家族最后签发的Access Token，否则Access Token在过期之前仍然有效。
+//
+// 参考 OAuth 2.0 Security Best Current Practice 4.13 Refresh Token Protection
+//
+
+var (
+	ErrRefreshTokenInvalid = errors.New("jwt: refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("jwt: refresh token reused, token family revoked")
+)
+
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+// 服务端保存的Refresh Token
+type RefreshToken struct {
+	ID              string    `json:"id"`     // Refresh Token的SHA-256
+	Family          string    `json:"family"` // 同一次登录的Refresh Token属于同一个家族
+	Subject         string    `json:"sub"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+	AccessTokenID   string    `json:"accessTokenId"` // 同时签发的Access Token的jti，吊销时使用
+	AccessExpiresAt time.Time `json:"accessExpiresAt"`
+	Used            bool      `json:"used"`
+}
+
+type RefreshTokenStore interface {
+	Save(token *RefreshToken) error
+	// 标记为已使用，返回标记之前的记录；不存在或家族已吊销时返回ErrRefreshTokenInvalid
+	// 需要是原子操作，并发刷新时只有一个调用方得到Used为false的记录
+	Use(id string) (*RefreshToken, error)
+	// 吊销家族，返回家族中所有记录
+	RevokeFamily(family string) ([]*RefreshToken, error)
+}
+
+// 基于内存的RefreshTokenStore，过期的记录在Save时定期清理
+type MemoryRefreshTokenStore struct {
+	sync.Mutex
+	tokens    map[string]*RefreshToken
+	families  map[string][]string // family -> id
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		tokens:   make(map[string]*RefreshToken),
+		families: make(map[string][]string),
+		now:      time.Now,
+	}
+}
+
+func (store *MemoryRefreshTokenStore) Save(token *RefreshToken) error {
+	store.Lock()
+	defer store.Unlock()
+	now := store.now()
+	if now.Sub(store.lastSweep) > time.Minute {
+		for id, t := range store.tokens {
+			if now.After(t.ExpiresAt) {
+				store.remove(id)
+			}
+		}
+		store.lastSweep = now
+	}
+	saved := *token
+	store.tokens[token.ID] = &saved
+	store.families[token.Family] = append(store.families[token.Family], token.ID)
+	return nil
+}
+
+func (store *MemoryRefreshTokenStore) remove(id string) {
+	token := store.tokens[id]
+	delete(store.tokens, id)
+	ids := store.families[token.Family]
+	for i := range ids {
+		if ids[i] == id {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(store.families, token.Family)
+	} else {
+		store.families[token.Family] = ids
+	}
+}
+
+func (store *MemoryRefreshTokenStore) Use(id string) (*RefreshToken, error) {
+	store.Lock()
+	defer store.Unlock()
+	token, ok := store.tokens[id]
+	if !ok {
+		return nil, ErrRefreshTokenInvalid
+	}
+	previous := *token
+	token.Used = true
+	return &previous, nil
+}
+
+func (store *MemoryRefreshTokenStore) RevokeFamily(family string) ([]*RefreshToken, error) {
+	store.Lock()
+	defer store.Unlock()
+	var revoked []*RefreshToken
+	for _, id := range append([]string(nil), store.families[family]...) {
+		token := *store.tokens[id]
+		revoked = append(revoked, &token)
+		store.remove(id)
+	}
+	return revoked, nil
+}
+
+// 签发和刷新Token
+type SessionService struct {
+	Issuer      *TokenIssuer
+	Store       RefreshTokenStore
+	RefreshTTL  time.Duration
+	Claims      func(subject string) (Claims, error) // 生成Access Token的声明，刷新时重新调用，为空时只包含标准声明
+	Revocations RevocationStore                      // 吊销家族时同时吊销Access Token，为空时不吊销
+	Now         func() time.Time
+}
+
+func NewSessionService(issuer *TokenIssuer, store RefreshTokenStore) *SessionService {
+	return &SessionService{
+		Issuer:     issuer,
+		Store:      store,
+		RefreshTTL: DefaultRefreshTokenTTL,
+		Now:        time.Now,
+	}
+}
+
+// 返回给客户端的Token，字段名和OAuth2的Token响应一致
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// 登录成功后签发一对Token
+func (service *SessionService) Login(subject string) (*TokenPair, error) {
+	return service.issue(subject, uuid.New().String())
+}
+
+// 使用Refresh Token换取新的一对Token
+func (service *SessionService) Refresh(refreshToken string) (*TokenPair, error) {
+	token, err := service.Store.Use(hashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if token.Used {
+		if err := service.revokeFamily(token.Family); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if service.Now().After(token.ExpiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	return service.issue(token.Subject, token.Family)
+}
+
+// 注销，吊销Refresh Token所在的家族；Refresh Token无效时忽略
+func (service *SessionService) Logout(refreshToken string) error {
+	token, err := service.Store.Use(hashRefreshToken(refreshToken))
+	if err == ErrRefreshTokenInvalid {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return service.revokeFamily(token.Family)
+}
+
+func (service *SessionService) issue(subject string, family string) (*TokenPair, error) {
+	var claims Claims = &RegisteredClaims{Subject: subject}
+	if service.Claims != nil {
+		var err error
+		if claims, err = service.Claims(subject); err != nil {
+			return nil, err
+		}
+		claims.Registered().Subject = subject
+	}
+	accessToken, err := service.Issuer.Issue(claims)
+	if err != nil {
+		return nil, err
+	}
+	registered := claims.Registered()
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	refreshToken := hex.EncodeToString(b)
+	now := service.Now()
+	if err := service.Store.Save(&RefreshToken{
+		ID:              hashRefreshToken(refreshToken),
+		Family:          family,
+		Subject:         subject,
+		ExpiresAt:       now.Add(service.RefreshTTL),
+		AccessTokenID:   registered.ID,
+		AccessExpiresAt: time.Unix(registered.ExpiresAt, 0),
+	}); err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    registered.ExpiresAt - now.Unix(),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func (service *SessionService) revokeFamily(family string) error {
+	tokens, err := service.Store.RevokeFamily(family)
+	if err != nil || service.Revocations == nil {
+		return err
+	}
+	for _, token := range tokens {
+		if token.AccessTokenID == "" {
+			continue
+		}
+		if err := service.Revocations.Revoke(token.AccessTokenID, token.AccessExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// 登录、刷新和注销接口
+//
+//	POST /login                          Authenticate校验登录信息(例如表单中的用户名和密码)，返回TokenPair
+//	POST /refresh   refresh_token=<...>  返回新的TokenPair
+//	POST /logout    refresh_token=<...>  返回204
+//
+// 失败时按OAuth2的格式返回错误：{"error": "invalid_grant"}
+//
+//	http.Handle("/auth/", http.StripPrefix("/auth", jwt.NewSessionHandler(service, authenticate)))
+type SessionHandler struct {
+	Service      *SessionService
+	Authenticate func(r *http.Request) (subject string, err error)
+}
+
+func NewSessionHandler(service *SessionService, authenticate func(r *http.Request) (string, error)) *SessionHandler {
+	return &SessionHandler{Service: service, Authenticate: authenticate}
+}
+
+type sessionError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (handler *SessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeSessionError(w, http.StatusBadRequest, "invalid_request", "")
+		return
+	}
+
+	switch r.URL.Path {
+	case "/login":
+		subject, err := handler.Authenticate(r)
+		if err != nil || subject == "" {
+			writeSessionError(w, http.StatusUnauthorized, "invalid_grant", "authentication failed")
+			return
+		}
+		pair, err := handler.Service.Login(subject)
+		if err != nil {
+			writeSessionError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		writeTokenPair(w, pair)
+	case "/refresh":
+		refreshToken := r.PostForm.Get("refresh_token")
+		if refreshToken == "" {
+			writeSessionError(w, http.StatusBadRequest, "invalid_request", "missing refresh_token")
+			return
+		}
+		pair, err := handler.Service.Refresh(refreshToken)
+		switch err {
+		case nil:
+			writeTokenPair(w, pair)
+		case ErrRefreshTokenInvalid, ErrRefreshTokenReused:
+			writeSessionError(w, http.StatusBadRequest, "invalid_grant", "")
+		default:
+			writeSessionError(w, http.StatusInternalServerError, "server_error", "")
+		}
+	case "/logout":
+		if err := handler.Service.Logout(r.PostForm.Get("refresh_token")); err != nil {
+			writeSessionError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeTokenPair(w http.ResponseWriter, pair *TokenPair) {
+	// Token不能被缓存，RFC 6749 5.1
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pair)
+}
+
+func writeSessionError(w http.ResponseWriter, status int, code string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(sessionError{Error: code, Description: description})
+}
@@ -0,0 +1,209 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSession() (*SessionService, *MemoryRevocationStore) {
+	revocations := NewMemoryRevocationStore()
+	service := NewSessionService(newTestIssuer(), NewMemoryRefreshTokenStore())
+	service.Revocations = revocations
+	service.Now = func() time.Time { return testNow }
+	return service, revocations
+}
+
+func TestSessionRefreshRotation(t *testing.T) {
+	service, revocations := newTestSession()
+	validator := newTestValidator()
+	validator.Revocations = revocations
+
+	pair, err := service.Login("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.TokenType != "Bearer" || pair.ExpiresIn != int64(DefaultTokenTTL/time.Second) || len(pair.RefreshToken) != 64 {
+		t.Errorf("pair = %+v", pair)
+	}
+	if claims, err := validator.Validate(pair.AccessToken); err != nil || claims.Subject != "alice" {
+		t.Fatalf("claims = %+v, err = %v", claims, err)
+	}
+
+	// 刷新后得到新的Refresh Token，旧的不能再用
+	next, err := service.Refresh(pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.RefreshToken == pair.RefreshToken || next.AccessToken == pair.AccessToken {
+		t.Error("tokens not rotated")
+	}
+	third, err := service.Refresh(next.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重用旧的Refresh Token，整个家族被吊销，包括最新的Refresh Token和Access Token
+	if _, err := service.Refresh(pair.RefreshToken); err != ErrRefreshTokenReused {
+		t.Errorf("reuse: err = %v", err)
+	}
+	if _, err := service.Refresh(third.RefreshToken); err != ErrRefreshTokenInvalid {
+		t.Errorf("latest after reuse: err = %v", err)
+	}
+	if _, err := validator.Validate(third.AccessToken); err != ErrTokenRevoked {
+		t.Errorf("access token after reuse: err = %v", err)
+	}
+	if _, err := service.Refresh("unknown"); err != ErrRefreshTokenInvalid {
+		t.Errorf("unknown: err = %v", err)
+	}
+}
+
+func TestSessionFamiliesAreIndependent(t *testing.T) {
+	service, _ := newTestSession()
+	a, _ := service.Login("alice")
+	b, _ := service.Login("alice")
+	if err := service.Logout(a.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Refresh(a.RefreshToken); err != ErrRefreshTokenInvalid {
+		t.Errorf("after logout: err = %v", err)
+	}
+	if _, err := service.Refresh(b.RefreshToken); err != nil {
+		t.Errorf("other session: err = %v", err)
+	}
+	if err := service.Logout("unknown"); err != nil {
+		t.Errorf("logout unknown: err = %v", err)
+	}
+}
+
+func TestSessionRefreshExpired(t *testing.T) {
+	service, _ := newTestSession()
+	pair, _ := service.Login("alice")
+	service.Now = func() time.Time { return testNow.Add(DefaultRefreshTokenTTL + time.Second) }
+	if _, err := service.Refresh(pair.RefreshToken); err != ErrRefreshTokenInvalid {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestSessionConcurrentRefresh(t *testing.T) {
+	service, _ := newTestSession()
+	pair, _ := service.Login("alice")
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.Refresh(pair.RefreshToken); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if succeeded != 1 {
+		t.Errorf("succeeded = %d", succeeded)
+	}
+}
+
+func TestSessionClaims(t *testing.T) {
+	service, _ := newTestSession()
+	service.Claims = func(subject string) (Claims, error) {
+		if subject == "mallory" {
+			return nil, errors.New("disabled")
+		}
+		return &testClaims{Foo: "bar"}, nil
+	}
+	pair, err := service.Login("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &testClaims{}
+	if _, err := newTestValidator().ValidateWithClaims(pair.AccessToken, claims); err != nil || claims.Foo != "bar" || claims.Subject != "alice" {
+		t.Errorf("claims = %+v, err = %v", claims, err)
+	}
+	if _, err := service.Login("mallory"); err == nil {
+		t.Error("claims error ignored")
+	}
+}
+
+func TestMemoryRefreshTokenStoreSweep(t *testing.T) {
+	now := testNow
+	store := NewMemoryRefreshTokenStore()
+	store.now = func() time.Time { return now }
+	store.Save(&RefreshToken{ID: "a", Family: "f", ExpiresAt: now.Add(time.Hour)})
+	now = now.Add(2 * time.Hour)
+	store.Save(&RefreshToken{ID: "b", Family: "f", ExpiresAt: now.Add(time.Hour)})
+	if _, ok := store.tokens["a"]; ok || len(store.families["f"]) != 1 {
+		t.Errorf("tokens = %v, families = %v", store.tokens, store.families)
+	}
+}
+
+func TestSessionHandler(t *testing.T) {
+	service, _ := newTestSession()
+	handler := NewSessionHandler(service, func(r *http.Request) (string, error) {
+		if r.PostForm.Get("username") == "alice" && r.PostForm.Get("password") == "secret" {
+			return "alice", nil
+		}
+		return "", errors.New("bad credentials")
+	})
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) (pair TokenPair, e sessionError) {
+		json.Unmarshal(w.Body.Bytes(), &pair)
+		json.Unmarshal(w.Body.Bytes(), &e)
+		return
+	}
+
+	w := post("/login", url.Values{"username": {"alice"}, "password": {"wrong"}})
+	if _, e := decode(w); w.Code != http.StatusUnauthorized || e.Error != "invalid_grant" {
+		t.Errorf("bad login: %d %s", w.Code, w.Body)
+	}
+	w = post("/login", url.Values{"username": {"alice"}, "password": {"secret"}})
+	pair, _ := decode(w)
+	if w.Code != http.StatusOK || pair.AccessToken == "" || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+
+	w = post("/refresh", url.Values{"refresh_token": {pair.RefreshToken}})
+	next, _ := decode(w)
+	if w.Code != http.StatusOK || next.RefreshToken == "" {
+		t.Fatalf("refresh: %d %s", w.Code, w.Body)
+	}
+	w = post("/refresh", url.Values{"refresh_token": {pair.RefreshToken}})
+	if _, e := decode(w); w.Code != http.StatusBadRequest || e.Error != "invalid_grant" {
+		t.Errorf("reuse: %d %s", w.Code, w.Body)
+	}
+	if w = post("/refresh", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("missing token: %d", w.Code)
+	}
+
+	w = post("/login", url.Values{"username": {"alice"}, "password": {"secret"}})
+	pair, _ = decode(w)
+	if w = post("/logout", url.Values{"refresh_token": {pair.RefreshToken}}); w.Code != http.StatusNoContent {
+		t.Errorf("logout: %d", w.Code)
+	}
+	if w = post("/refresh", url.Values{"refresh_token": {pair.RefreshToken}}); w.Code != http.StatusBadRequest {
+		t.Errorf("refresh after logout: %d", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/login", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: %d", w.Code)
+	}
+}
@@ -0,0 +1,196 @@
+package jwt
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+//
+// 校验JWT
+//
+// 1)算法白名单：alg由Token自己声明，不检查的话，攻击者可以把alg改成none，或者把RS256改成HS256、用公钥作为HMAC密钥伪造签名
+// 2)签名：根据Header(例如kid)选择密钥
+// 3)声明：iss、aud必须和本服务的配置一致；exp、nbf、iat与当前时间比较，允许Leeway的时钟偏差
+//
+// 校验失败返回下面的错误，调用方可以据此决定是否刷新Token；返回给客户端时不要区分具体原因。
+//
+
+var (
+	ErrTokenMalformed      = errors.New("jwt: token is malformed")
+	ErrAlgorithmNotAllowed = errors.New("jwt: signing algorithm not allowed")
+	ErrSignatureInvalid    = errors.New("jwt: signature is invalid")
+	ErrTokenUnverifiable   = errors.New("jwt: token is unverifiable")
+	ErrTokenExpired        = errors.New("jwt: token is expired")
+	ErrTokenNotValidYet    = errors.New("jwt: token is not valid yet")
+	ErrInvalidIssuer       = errors.New("jwt: invalid issuer")
+	ErrInvalidAudience     = errors.New("jwt: invalid audience")
+	ErrMissingExpiration   = errors.New("jwt: missing exp claim")
+)
+
+// 吊销列表出错，不能说明Token无效，调用方应返回5xx，而不是让客户端丢弃Token
+type RevocationStoreError struct {
+	Err error
+}
+
+func (e *RevocationStoreError) Error() string {
+	return "jwt: revocation store: " + e.Err.Error()
+}
+
+func (e *RevocationStoreError) Unwrap() error {
+	return e.Err
+}
+
+const DefaultLeeway = time.Minute
+
+type TokenValidator struct {
+	Keyfunc           Keyfunc  // 根据Token查找校验密钥
+	Algorithms        []string // 允许的签名算法，不能为空
+	Issuer            string   // 要求的iss，为空时不检查
+	Audience          string   // 要求aud中包含本服务，为空时不检查
+	Leeway            time.Duration
+	RequireExpiration bool             // 必须包含exp，默认开启，不过期的Token泄露后无法失效
+	Revocations       RevocationStore  // 吊销列表，为空时不检查
+	DecryptionKeys    []*DecryptionKey // 解密JWE的私钥，Nested JWT先解密再校验签名
+	RequireEncryption bool             // 只接受加密的Token
+	Checks            []ClaimsCheck    // 标准声明校验通过后执行，之前先执行声明的Valid方法
+	Now               func() time.Time
+}
+
+func NewTokenValidator(keyfunc Keyfunc, algorithms ...string) *TokenValidator {
+	return &TokenValidator{
+		Keyfunc:           keyfunc,
+		Algorithms:        algorithms,
+		Leeway:            DefaultLeeway,
+		RequireExpiration: true,
+		Now:               time.Now,
+	}
+}
+
+// 使用同一个密钥校验HS256签名
+func NewHMACValidator(secret []byte) *TokenValidator {
+	return NewTokenValidator(StaticKey(secret), SigningMethodHS256.Alg())
+}
+
+// 所有Token使用同一个密钥
+func StaticKey(key interface{}) Keyfunc {
+	return func(token *Token) (interface{}, error) {
+		return key, nil
+	}
+}
+
+// 校验只包含标准声明的Token
+func (validator *TokenValidator) Validate(tokenString string) (*RegisteredClaims, error) {
+	claims := &RegisteredClaims{}
+	if _, err := validator.ValidateWithClaims(tokenString, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// 校验Token，声明解析到claims中
+func (validator *TokenValidator) ValidateWithClaims(tokenString string, claims Claims) (*Token, error) {
+	if isJWE(tokenString) {
+		plaintext, contentType, err := Decrypt(tokenString, validator.DecryptionKeys...)
+		if err != nil {
+			return nil, err
+		}
+		// 只接受签名后再加密的Token，加密本身不能证明签发方
+		if !strings.EqualFold(contentType, "JWT") {
+			return nil, ErrTokenMalformed
+		}
+		tokenString = string(plaintext)
+	} else if validator.RequireEncryption {
+		return nil, ErrEncryptionRequired
+	}
+	parser := &jwtgo.Parser{SkipClaimsValidation: true}
+	token, err := parser.ParseWithClaims(tokenString, claims, validator.keyfunc)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	if err := validator.validateClaims(claims.Registered()); err != nil {
+		return nil, err
+	}
+	if err := checkClaims(claims, validator.Checks); err != nil {
+		return nil, err
+	}
+	// 签名和声明都有效时才查吊销列表
+	if validator.Revocations != nil {
+		revoked, err := validator.Revocations.IsRevoked(claims.Registered())
+		if err != nil {
+			return nil, &RevocationStoreError{Err: err}
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return token, nil
+}
+
+// 查找密钥之前先检查算法，不使用jwt-go的ValidMethods，它不区分算法不在白名单和签名错误
+func (validator *TokenValidator) keyfunc(token *Token) (interface{}, error) {
+	if !validator.allowed(token.Method.Alg()) {
+		return nil, ErrAlgorithmNotAllowed
+	}
+	return validator.Keyfunc(token)
+}
+
+func (validator *TokenValidator) allowed(alg string) bool {
+	for _, a := range validator.Algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查标准声明
+func (validator *TokenValidator) validateClaims(claims *RegisteredClaims) error {
+	now := validator.Now()
+	leeway := int64(validator.Leeway / time.Second)
+	if claims.ExpiresAt == 0 {
+		if validator.RequireExpiration {
+			return ErrMissingExpiration
+		}
+	} else if now.Unix() > claims.ExpiresAt+leeway {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore-leeway {
+		return ErrTokenNotValidYet
+	}
+	if claims.IssuedAt != 0 && now.Unix() < claims.IssuedAt-leeway {
+		return ErrTokenNotValidYet
+	}
+	if validator.Issuer != "" && claims.Issuer != validator.Issuer {
+		return ErrInvalidIssuer
+	}
+	if validator.Audience != "" && !claims.Audience.Contains(validator.Audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// 把jwt-go的ValidationError转换为本包的错误
+func validationError(err error) error {
+	ve, ok := err.(*jwtgo.ValidationError)
+	if !ok {
+		return err
+	}
+	// Keyfunc返回的错误放在Inner中，原样返回
+	if ve.Errors&jwtgo.ValidationErrorUnverifiable != 0 {
+		if ve.Inner != nil {
+			return ve.Inner
+		}
+		// jwt-go不支持的alg
+		return ErrAlgorithmNotAllowed
+	}
+	switch {
+	case ve.Errors&jwtgo.ValidationErrorMalformed != 0:
+		return ErrTokenMalformed
+	case ve.Errors&jwtgo.ValidationErrorSignatureInvalid != 0:
+		return ErrSignatureInvalid
+	}
+	return ErrTokenUnverifiable
+}
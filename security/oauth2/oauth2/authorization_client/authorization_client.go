@@ -1,13 +1,25 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
+
+	"paradigm/security/oauth2/oauth2/pkce"
 )
 
+var public = flag.Bool("public", false, "register as a public client without secret, PKCE is required")
+
+const redirectURI = "http://localhost:9094/redirect"
+
 type OAuthCredentialResponse struct {
 	ClientId     string `json:"CLIENT_ID"`
 	ClientSecret string `json:"CLIENT_SECRET"`
@@ -20,7 +32,7 @@ type OAuthAccessResponse struct {
 // 获取ClientId和秘钥
 func GetCredential() (clientId string, clientSecret string, err error) {
 	// Build url
-	reqURL := fmt.Sprintf("http://localhost:9096/oauth/credential")
+	reqURL := fmt.Sprintf("http://localhost:9096/oauth/credential?public=%t", *public)
 	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
 	if err != nil {
 		fmt.Fprintf(os.Stdout, "could not create HTTP request: %v", err)
@@ -47,16 +59,26 @@ func GetCredential() (clientId string, clientSecret string, err error) {
 	return c.ClientId, c.ClientSecret, nil
 }
 
-// 使用code换取access_token
-func GetAccessToken(clientId string, clientSecret string, code string) (token string, errCode int) {
-	// Lets for the HTTP request to call the GitHub OAuth endpoint to get our access token
-	reqURL := fmt.Sprintf("http://localhost:9096/oauth/access_token?client_id=%s&client_secret=%s&grant_type=authorization_code&code=%s&redirect_uri=http://localhost:9094/redirect", clientId, clientSecret, code)
-	req, err := http.NewRequest(http.MethodPost, reqURL, nil)
+// 使用code换取access_token，参数放在POST表单中，不会出现在URL和访问日志里
+// 公开客户端没有clientSecret，依靠codeVerifier证明授权码是自己申请的
+func GetAccessToken(clientId string, clientSecret string, code string, codeVerifier string) (token string, errCode int) {
+	form := url.Values{
+		"client_id":     {clientId},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:9096/oauth/access_token", strings.NewReader(form.Encode()))
 	if err != nil {
 		fmt.Fprintf(os.Stdout, "could not create HTTP request: %v", err)
 		errCode = http.StatusBadRequest
 		return
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	// Send out the HTTP request
 	httpClient := http.Client{}
@@ -68,6 +90,12 @@ func GetAccessToken(clientId string, clientSecret string, code string) (token st
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stdout, "could not get access token: %s", resp.Status)
+		errCode = http.StatusUnauthorized
+		return
+	}
+
 	// Parse the request body into the `OAuthAccessResponse` struct
 	var t OAuthAccessResponse
 	body, _ := ioutil.ReadAll(resp.Body)
@@ -82,7 +110,15 @@ func GetAccessToken(clientId string, clientSecret string, code string) (token st
 	return
 }
 
+// 等待回调的授权请求，state -> code_verifier
+var pending = struct {
+	sync.Mutex
+	verifiers map[string]string
+}{verifiers: make(map[string]string)}
+
 func main() {
+	flag.Parse()
+
 	// Get credential
 	clientId, clientSecret, err := GetCredential()
 	if err != nil {
@@ -92,7 +128,31 @@ func main() {
 
 	// Service /hello
 	http.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
-		redirectUrl := fmt.Sprintf("http://localhost:9096/oauth/authorize?response_type=code&client_id=%s&redirect_uri=http://localhost:9094/redirect", clientId)
+		// 每次授权生成新的code_verifier，用随机的state关联回调
+		verifier, err := pkce.NewVerifier()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		state := hex.EncodeToString(b)
+		pending.Lock()
+		pending.verifiers[state] = verifier
+		pending.Unlock()
+
+		query := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {clientId},
+			"redirect_uri":          {redirectURI},
+			"state":                 {state},
+			"code_challenge":        {pkce.Challenge(verifier)},
+			"code_challenge_method": {pkce.MethodS256},
+		}
+		redirectUrl := "http://localhost:9096/oauth/authorize?" + query.Encode()
 		w.Header().Set("Location", redirectUrl)
 		w.WriteHeader(http.StatusFound)
 	})
@@ -108,8 +168,18 @@ func main() {
 		}
 		code := r.FormValue("code")
 
+		// state只能使用一次，不存在时不是本应用发起的授权
+		pending.Lock()
+		verifier, ok := pending.verifiers[r.FormValue("state")]
+		delete(pending.verifiers, r.FormValue("state"))
+		pending.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
 		// Second, get access token
-		token, errCode := GetAccessToken(clientId, clientSecret, code)
+		token, errCode := GetAccessToken(clientId, clientSecret, code, verifier)
 		if errCode != http.StatusOK {
 			w.WriteHeader(errCode)
 			return
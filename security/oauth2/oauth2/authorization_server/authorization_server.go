@@ -1,38 +1,81 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/google/uuid"
 	"gopkg.in/oauth2.v3"
 	"gopkg.in/oauth2.v3/errors"
+	"gopkg.in/oauth2.v3/generates"
 	"gopkg.in/oauth2.v3/manage"
-	"gopkg.in/oauth2.v3/models"
 	"gopkg.in/oauth2.v3/server"
-	"gopkg.in/oauth2.v3/store"
 	"log"
 	"net/http"
+	"time"
+
+	"paradigm/security/jwt"
+	"paradigm/security/oauth2/oauth2/login"
+	"paradigm/security/oauth2/oauth2/oidc"
+	"paradigm/security/oauth2/oauth2/pkce"
+	"paradigm/security/oauth2/oauth2/storage"
+)
+
+var (
+	dbPath   = flag.String("db", "authorization_server.db", "database file for clients and tokens")
+	keysPath = flag.String("keys", "authorization_server_keys.json", "key history file for ID Token signing keys")
+	issuer   = flag.String("issuer", "http://localhost:9096", "OpenID Connect issuer, the external URL of this server")
 )
 
 func main() {
+	flag.Parse()
 	manager := manage.NewDefaultManager()
 	cfg := manage.DefaultAuthorizeCodeTokenCfg
 	manager.SetAuthorizeCodeTokenCfg(manage.DefaultAuthorizeCodeTokenCfg)
 	manager.SetAuthorizeCodeTokenCfg(cfg)
 
-	// token memory store
-	manager.MustTokenStorage(store.NewMemoryTokenStore())
-
-	// client memory store
-	clientStore := store.NewClientStore()
+	// 客户端和token保存在文件中，重启后仍然有效
+	db, err := storage.Open(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	manager.MapTokenStorage(storage.NewTokenStore(db))
+	clientStore := storage.NewClientStore(db)
 
 	manager.MapClientStorage(clientStore)
 
+	// ID Token的签名密钥定期轮换，公钥通过JWKS发布
+	rotator, err := jwt.NewKeyRotator(*keysPath, "RS256")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := rotator.Rotate(); err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rotator.Run(ctx, time.Hour, func(err error) { log.Println("Rotate Error:", err) })
+
+	// OIDC：scope包含openid时签发ID Token
+	provider := oidc.NewProvider(*issuer, jwt.NewRotatingIssuer(rotator), rotator, demoUsers, storage.NewAuthorizationStore(db))
+	provider.Algorithms = []string{rotator.Algorithm}
+
+	// PKCE：生成授权码时保存code_challenge，换取Token时检查code_verifier；RequirePKCE的客户端必须使用
+	// 校验code_verifier之后才签发ID Token，所以OIDC包装在外层
+	p := pkce.NewServer(storage.NewChallengeStore(db), clientStore.RequirePKCE)
+	manager.MapAuthorizeGenerate(provider.AuthorizeGenerate(p.AuthorizeGenerate(generates.NewAuthorizeGenerate())))
+	manager.MapAccessGenerate(provider.AccessGenerate(p.AccessGenerate(generates.NewAccessGenerate())))
+
 	srv := server.NewDefaultServer(manager)
 	srv.SetAllowGetAccessRequest(true)
 	srv.SetAllowedGrantType(oauth2.AuthorizationCode)
-	srv.SetAllowedResponseType(oauth2.Code, oauth2.Token)
-	srv.SetClientInfoHandler(server.ClientFormHandler)
+	// 只支持授权码模式，隐式授权不能使用PKCE，和discovery文档的response_types_supported一致
+	srv.SetAllowedResponseType(oauth2.Code)
+	// 公开客户端没有client_secret
+	srv.SetClientInfoHandler(pkce.ClientFormHandler)
 	manager.SetRefreshTokenCfg(manage.DefaultRefreshTokenCfg)
 
 	srv.SetInternalErrorHandler(func(err error) (re *errors.Response) {
@@ -44,26 +87,37 @@ func main() {
 		log.Println("Response Error:", re.Error.Error())
 	})
 
-	// 引导用户进行授权，需要业务代码实现
-	// 这个函数是业务逻辑实现的关键，流程如下：
-	// 1)第三方要求进行授权时，要依次检查用户是否已经登录，是否已对此应用做过授权。如果有未完成项(未登录或未授权)，先保存请求参数到session当中，然后跳转到相应登录/授权页面。
-	// 2)取得用户授权后，需要返回userID(给上层的HandleAuthorizeRequest调用)。
-	//
-	// 注意：HandleAuthorizeRequest()后续生成授权码时，会调用AuthorizeScopeHandler设置授权域，调用AccessTokenExpHandler设置Token有效期。
-	//      所以，需要在这个函数中提前做好簿记，把相关信息存储在某个位置，让AuthorizeScopeHandler和AccessTokenExpHandler可以访问到，这样才能把整个授权链串起来。
-	// 参考 gopkg.in/oauth2.v3/example/server
-	srv.SetUserAuthorizationHandler(func(w http.ResponseWriter, r *http.Request) (userID string, err error) {
-		return "demo", nil
-	})
+	// 引导用户进行授权：未登录时跳转到登录页面，未授权时跳转到授权页面，完成后回到/oauth/authorize
+	// AuthorizeScopeHandler和AccessTokenExpHandler从会话中读取用户同意的scope，流程见login包
+	flow := login.NewFlow(login.AuthenticatorFunc(authenticate), login.NewMemorySessionStore(), storage.NewConsentStore(db))
+	srv.SetUserAuthorizationHandler(flow.UserAuthorizationHandler)
+	srv.SetAuthorizeScopeHandler(flow.AuthorizeScopeHandler)
+	srv.SetAccessTokenExpHandler(flow.AccessTokenExpHandler)
+	http.HandleFunc("/oauth/login", flow.LoginHandler)
+	http.HandleFunc("/oauth/consent", flow.ConsentHandler)
+
+	// OIDC的discovery文档、JWKS和UserInfo
+	provider.AuthTime = flow.AuthTime
+	provider.ValidateAccessToken = srv.ValidationBearerToken
+	srv.SetExtensionFieldsHandler(provider.ExtensionFieldsHandler)
+	http.HandleFunc(oidc.DiscoveryPath, provider.DiscoveryHandler)
+	http.Handle(provider.JWKSPath, provider.JWKSHandler())
+	http.HandleFunc(provider.UserInfoPath, provider.UserInfoHandler)
 
 	// 发放客户端令牌，需要业务代码实现
+	// public=true时注册公开客户端，没有秘钥，必须使用PKCE
 	http.HandleFunc("/oauth/credential", func(w http.ResponseWriter, r *http.Request) {
+		public := r.FormValue("public") == "true"
 		clientId := uuid.New().String()[:8]
 		clientSecret := uuid.New().String()[:8]
-		err := clientStore.Set(clientId, &models.Client{
-			ID:     clientId,
-			Secret: clientSecret,
-			Domain: "http://localhost:9094",
+		if public {
+			clientSecret = ""
+		}
+		err := clientStore.Set(clientId, &storage.Client{
+			ID:          clientId,
+			Secret:      clientSecret,
+			Domain:      "http://localhost:9094",
+			RequirePKCE: public,
 		})
 		if err != nil {
 			fmt.Println(err.Error())
@@ -91,6 +145,27 @@ func main() {
 	log.Fatal(http.ListenAndServe(":9096", nil))
 }
 
+// 演示用户，用户名和密码都是demo，需要业务代码替换为用户系统
+var users = map[string]string{"demo": "demo"}
+
+func authenticate(username string, password string) (string, error) {
+	if p, ok := users[username]; !ok || subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+		return "", login.ErrInvalidCredentials
+	}
+	return username, nil
+}
+
+// 演示用户的信息，实现oidc.UserRepository
+type userRepository map[string]*oidc.UserInfo
+
+func (repo userRepository) GetUser(userID string) (*oidc.UserInfo, error) {
+	return repo[userID], nil
+}
+
+var demoUsers = userRepository{
+	"demo": {Subject: "demo", Name: "Demo User", PreferredUsername: "demo", Email: "demo@example.com", EmailVerified: true},
+}
+
 func validateToken(f http.HandlerFunc, srv *server.Server) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, err := srv.ValidationBearerToken(r)
@@ -2,26 +2,33 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/google/uuid"
 	"gopkg.in/oauth2.v3/errors"
 	"gopkg.in/oauth2.v3/manage"
-	"gopkg.in/oauth2.v3/models"
 	"gopkg.in/oauth2.v3/server"
-	"gopkg.in/oauth2.v3/store"
 	"log"
 	"net/http"
+
+	"paradigm/security/oauth2/oauth2/storage"
 )
 
+var dbPath = flag.String("db", "credentials.db", "database file for clients and tokens")
+
 func main() {
+	flag.Parse()
 	manager := manage.NewDefaultManager()
 	manager.SetAuthorizeCodeTokenCfg(manage.DefaultAuthorizeCodeTokenCfg)
 
-	// token memory store
-	manager.MustTokenStorage(store.NewMemoryTokenStore())
-
-	// client memory store
-	clientStore := store.NewClientStore()
+	// 客户端和token保存在文件中，重启后仍然有效
+	db, err := storage.Open(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	manager.MapTokenStorage(storage.NewTokenStore(db))
+	clientStore := storage.NewClientStore(db)
 
 	manager.MapClientStorage(clientStore)
 
@@ -46,7 +53,7 @@ func main() {
 	http.HandleFunc("/credentials", func(w http.ResponseWriter, r *http.Request) {
 		clientId := uuid.New().String()[:8]
 		clientSecret := uuid.New().String()[:8]
-		err := clientStore.Set(clientId, &models.Client{
+		err := clientStore.Set(clientId, &storage.Client{
 			ID:     clientId,
 			Secret: clientSecret,
 			Domain: "http://localhost:9094",
@@ -0,0 +1,431 @@
+package login
+
+import (
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	oauth2errors "gopkg.in/oauth2.v3/errors"
+)
+
+//
+// 授权码流程中的用户登录和授权
+//
+// server.SetUserAuthorizationHandler需要业务实现，流程如下：
+// 1)第三方应用把用户导向/oauth/authorize，检查用户是否已经登录，未登录时把授权请求保存在会话中，跳转到登录页面
+// 2)登录成功后，检查用户是否授权过该应用(记住的授权包含申请的所有scope)，没有时跳转到授权页面
+// 3)用户在授权页面同意(可以去掉部分scope)或拒绝，决定保存在会话中，然后跳转回/oauth/authorize继续
+// 4)HandleAuthorizeRequest再次调用UserAuthorizationHandler，这时返回userID；
+//   之后调用AuthorizeScopeHandler、AccessTokenExpHandler，它们从会话中读取用户同意的scope
+// 用户拒绝时返回access_denied，由server重定向到第三方应用的redirect_uri。
+//
+// 会话保存在服务端，浏览器的Cookie中只有随机的会话ID(HttpOnly、SameSite=Lax)；登录后更换会话ID，防止会话固定攻击。
+// 登录和授权页面的表单带有随机的csrf_token，页面禁止嵌入iframe，防止第三方页面诱导用户点击同意。
+//
+// 参考 gopkg.in/oauth2.v3/example/server
+//
+
+var ErrInvalidCredentials = errors.New("login: invalid username or password")
+
+const (
+	DefaultCookieName = "oauth2_session"
+	DefaultSessionTTL = 8 * time.Hour
+)
+
+// 校验用户名和密码，返回userID
+type Authenticator interface {
+	Authenticate(username string, password string) (userID string, err error)
+}
+
+type AuthenticatorFunc func(username string, password string) (string, error)
+
+func (f AuthenticatorFunc) Authenticate(username string, password string) (string, error) {
+	return f(username, password)
+}
+
+// 记住的授权，storage.ConsentStore实现该接口
+type ConsentStore interface {
+	GetConsent(userID string, clientID string) (scope string, ok bool, err error)
+	SaveConsent(userID string, clientID string, scope string) error
+}
+
+type Flow struct {
+	Users         Authenticator
+	Sessions      SessionStore
+	Consents      ConsentStore
+	AuthorizePath string // 授权请求的地址，登录和授权后跳转回这里
+	LoginPath     string
+	ConsentPath   string
+	CookieName    string
+	SessionTTL    time.Duration
+	Secure        bool // Cookie只通过HTTPS发送，生产环境应当开启
+	// 根据用户的决定设置Access Token的有效期，返回0时使用manage.Manager的配置；为空时都使用默认配置
+	AccessTokenExp func(approval *Approval) time.Duration
+	Now            func() time.Time
+}
+
+func NewFlow(users Authenticator, sessions SessionStore, consents ConsentStore) *Flow {
+	return &Flow{
+		Users:         users,
+		Sessions:      sessions,
+		Consents:      consents,
+		AuthorizePath: "/oauth/authorize",
+		LoginPath:     "/oauth/login",
+		ConsentPath:   "/oauth/consent",
+		CookieName:    DefaultCookieName,
+		SessionTTL:    DefaultSessionTTL,
+		Now:           time.Now,
+	}
+}
+
+// 实现server.UserAuthorizationHandler，返回空的userID时已经跳转到登录或授权页面
+func (flow *Flow) UserAuthorizationHandler(w http.ResponseWriter, r *http.Request) (string, error) {
+	session, err := flow.session(r)
+	if err != nil {
+		return "", err
+	}
+	if session == nil {
+		if session, err = flow.newSession(w); err != nil {
+			return "", err
+		}
+	}
+	if err := r.ParseForm(); err != nil {
+		return "", oauth2errors.ErrInvalidRequest
+	}
+
+	if session.UserID == "" {
+		return "", flow.suspend(w, r, session, flow.LoginPath)
+	}
+
+	clientID := r.Form.Get("client_id")
+	scope := r.Form.Get("scope")
+	approval := session.Approval
+	if approval != nil && approval.ClientID == clientID && sameRequest(session.Pending, r.Form) {
+		// 从授权页面跳转回来，一个决定只用于一次授权请求
+		session.Pending = nil
+		if err := flow.Sessions.Save(session); err != nil {
+			return "", err
+		}
+		if approval.Denied {
+			return "", oauth2errors.ErrAccessDenied
+		}
+		return session.UserID, nil
+	}
+
+	if granted, ok, err := flow.Consents.GetConsent(session.UserID, clientID); err != nil {
+		return "", err
+	} else if ok && containsScopes(granted, scope) {
+		session.Approval = &Approval{ClientID: clientID, Scope: scope, Remembered: true}
+		session.Pending = nil
+		if err := flow.Sessions.Save(session); err != nil {
+			return "", err
+		}
+		return session.UserID, nil
+	}
+	session.Approval = nil
+	return "", flow.suspend(w, r, session, flow.ConsentPath)
+}
+
+// 实现server.AuthorizeScopeHandler，返回用户同意的scope
+func (flow *Flow) AuthorizeScopeHandler(w http.ResponseWriter, r *http.Request) (string, error) {
+	approval, err := flow.approval(r)
+	if err != nil || approval == nil {
+		return "", err
+	}
+	return approval.Scope, nil
+}
+
+// 实现server.AccessTokenExpHandler
+func (flow *Flow) AccessTokenExpHandler(w http.ResponseWriter, r *http.Request) (time.Duration, error) {
+	approval, err := flow.approval(r)
+	if err != nil || approval == nil || flow.AccessTokenExp == nil {
+		return 0, err
+	}
+	return flow.AccessTokenExp(approval), nil
+}
+
+// 当前会话中和授权请求的client_id一致的决定
+func (flow *Flow) approval(r *http.Request) (*Approval, error) {
+	session, err := flow.session(r)
+	if err != nil || session == nil || session.Approval == nil {
+		return nil, err
+	}
+	if session.Approval.ClientID != r.FormValue("client_id") {
+		return nil, nil
+	}
+	return session.Approval, nil
+}
+
+// 当前登录的用户，未登录时返回空字符串，供其他页面使用
+func (flow *Flow) UserID(r *http.Request) (string, error) {
+	session, err := flow.session(r)
+	if err != nil || session == nil {
+		return "", err
+	}
+	return session.UserID, nil
+}
+
+// 当前用户登录的时间，未登录时返回零值，用于OIDC的auth_time
+func (flow *Flow) AuthTime(r *http.Request) (time.Time, error) {
+	session, err := flow.session(r)
+	if err != nil || session == nil {
+		return time.Time{}, err
+	}
+	return session.AuthTime, nil
+}
+
+// 保存授权请求，跳转到登录或授权页面
+func (flow *Flow) suspend(w http.ResponseWriter, r *http.Request, session *Session, path string) error {
+	session.Pending = copyValues(r.Form)
+	if err := flow.Sessions.Save(session); err != nil {
+		return err
+	}
+	w.Header().Set("Location", path)
+	w.WriteHeader(http.StatusFound)
+	return nil
+}
+
+// 跳转回授权请求
+func (flow *Flow) resume(w http.ResponseWriter, r *http.Request, session *Session) {
+	http.Redirect(w, r, flow.AuthorizePath+"?"+session.Pending.Encode(), http.StatusFound)
+}
+
+// 登录页面
+func (flow *Flow) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := flow.session(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if session == nil || session.Pending == nil {
+		http.Error(w, "no pending authorization request", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		flow.render(w, http.StatusOK, loginTemplate, map[string]interface{}{"CSRFToken": session.CSRFToken})
+	case http.MethodPost:
+		if !flow.checkCSRF(r, session) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		userID, err := flow.Users.Authenticate(r.PostForm.Get("username"), r.PostForm.Get("password"))
+		if err != nil || userID == "" {
+			flow.render(w, http.StatusUnauthorized, loginTemplate, map[string]interface{}{"CSRFToken": session.CSRFToken, "Error": "用户名或密码错误"})
+			return
+		}
+		// 登录后更换会话ID
+		if err := flow.Sessions.Delete(session.ID); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		pending := session.Pending
+		if session, err = flow.newSession(w); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		session.UserID = userID
+		session.AuthTime = flow.Now()
+		session.Pending = pending
+		if err := flow.Sessions.Save(session); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		flow.resume(w, r, session)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// 授权页面
+func (flow *Flow) ConsentHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := flow.session(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if session == nil || session.Pending == nil {
+		http.Error(w, "no pending authorization request", http.StatusBadRequest)
+		return
+	}
+	if session.UserID == "" {
+		http.Redirect(w, r, flow.LoginPath, http.StatusFound)
+		return
+	}
+	clientID := session.Pending.Get("client_id")
+	requested := strings.Fields(session.Pending.Get("scope"))
+
+	switch r.Method {
+	case http.MethodGet:
+		flow.render(w, http.StatusOK, consentTemplate, map[string]interface{}{
+			"CSRFToken": session.CSRFToken,
+			"ClientID":  clientID,
+			"Scopes":    requested,
+		})
+	case http.MethodPost:
+		if !flow.checkCSRF(r, session) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		approval := &Approval{ClientID: clientID, Denied: r.PostForm.Get("action") != "approve"}
+		if !approval.Denied {
+			// 只接受申请过的scope
+			var scopes []string
+			for _, s := range r.PostForm["scope"] {
+				if contains(requested, s) && !contains(scopes, s) {
+					scopes = append(scopes, s)
+				}
+			}
+			// 申请了scope但一个都没有同意，按拒绝处理，否则server会使用申请的scope
+			if len(requested) > 0 && len(scopes) == 0 {
+				approval.Denied = true
+			}
+			approval.Scope = strings.Join(scopes, " ")
+		}
+		if !approval.Denied && r.PostForm.Get("remember") != "" {
+			if err := flow.Consents.SaveConsent(session.UserID, clientID, approval.Scope); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+		session.Approval = approval
+		if err := flow.Sessions.Save(session); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		flow.resume(w, r, session)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (flow *Flow) session(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(flow.CookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+	return flow.Sessions.Get(cookie.Value)
+}
+
+func (flow *Flow) newSession(w http.ResponseWriter) (*Session, error) {
+	id, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	csrfToken, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{ID: id, CSRFToken: csrfToken, ExpiresAt: flow.Now().Add(flow.SessionTTL)}
+	if err := flow.Sessions.Save(session); err != nil {
+		return nil, err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     flow.CookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   flow.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return session, nil
+}
+
+func (flow *Flow) checkCSRF(r *http.Request, session *Session) bool {
+	if err := r.ParseForm(); err != nil {
+		return false
+	}
+	token := r.PostForm.Get("csrf_token")
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) == 1
+}
+
+// 响应头要在WriteHeader之前设置
+func (flow *Flow) render(w http.ResponseWriter, status int, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	t.Execute(w, data)
+}
+
+// 跳转回来的授权请求和保存的一致，防止用户对A应用的决定被用于B应用
+func sameRequest(pending url.Values, form url.Values) bool {
+	if pending == nil {
+		return false
+	}
+	for _, key := range []string{"client_id", "redirect_uri", "scope", "response_type"} {
+		if pending.Get(key) != form.Get(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// granted是否包含requested中所有的scope
+func containsScopes(granted string, requested string) bool {
+	grantedScopes := strings.Fields(granted)
+	for _, s := range strings.Fields(requested) {
+		if !contains(grantedScopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func copyValues(values url.Values) url.Values {
+	copied := make(url.Values, len(values))
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		copied[k] = append([]string(nil), values[k]...)
+	}
+	return copied
+}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE HTML>
+<html>
+<body>
+  <h1>登录</h1>
+  {{if .Error}}<p>{{.Error}}</p>{{end}}
+  <form method="post">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <p>用户名 <input type="text" name="username"></p>
+    <p>密码 <input type="password" name="password"></p>
+    <button type="submit">登录</button>
+  </form>
+</body>
+</html>`))
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE HTML>
+<html>
+<body>
+  <h1>授权</h1>
+  <p>应用 {{.ClientID}} 申请访问你的账号</p>
+  <form method="post">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    {{range .Scopes}}<p><label><input type="checkbox" name="scope" value="{{.}}" checked> {{.}}</label></p>{{end}}
+    <p><label><input type="checkbox" name="remember" value="1"> 记住我的选择</label></p>
+    <button type="submit" name="action" value="approve">同意</button>
+    <button type="submit" name="action" value="deny">拒绝</button>
+  </form>
+</body>
+</html>`))
@@ -0,0 +1,298 @@
+package login
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/manage"
+	"gopkg.in/oauth2.v3/models"
+	"gopkg.in/oauth2.v3/server"
+	"gopkg.in/oauth2.v3/store"
+)
+
+type memoryConsents map[string]string
+
+func (c memoryConsents) GetConsent(userID string, clientID string) (string, bool, error) {
+	scope, ok := c[userID+"|"+clientID]
+	return scope, ok, nil
+}
+
+func (c memoryConsents) SaveConsent(userID string, clientID string, scope string) error {
+	c[userID+"|"+clientID] = scope
+	return nil
+}
+
+const redirectURI = "http://client.example/callback"
+
+type testServer struct {
+	*httptest.Server
+	flow     *Flow
+	tokens   oauth2.TokenStore
+	consents memoryConsents
+	client   *http.Client
+}
+
+func newTestServer(t *testing.T) *testServer {
+	manager := manage.NewDefaultManager()
+	tokens, err := store.NewMemoryTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.MapTokenStorage(tokens)
+	clients := store.NewClientStore()
+	clients.Set("c1", &models.Client{ID: "c1", Secret: "s1", Domain: "http://client.example"})
+	clients.Set("c2", &models.Client{ID: "c2", Secret: "s2", Domain: "http://client.example"})
+	manager.MapClientStorage(clients)
+
+	consents := memoryConsents{}
+	users := AuthenticatorFunc(func(username string, password string) (string, error) {
+		if username == "alice" && password == "secret" {
+			return "user-alice", nil
+		}
+		return "", ErrInvalidCredentials
+	})
+	flow := NewFlow(users, NewMemorySessionStore(), consents)
+	flow.AccessTokenExp = func(approval *Approval) time.Duration {
+		if approval.Remembered {
+			return time.Minute
+		}
+		return 0
+	}
+
+	srv := server.NewDefaultServer(manager)
+	srv.SetAllowedResponseType(oauth2.Code)
+	srv.SetUserAuthorizationHandler(flow.UserAuthorizationHandler)
+	srv.SetAuthorizeScopeHandler(flow.AuthorizeScopeHandler)
+	srv.SetAccessTokenExpHandler(flow.AccessTokenExpHandler)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		srv.HandleAuthorizeRequest(w, r)
+	})
+	mux.HandleFunc("/oauth/login", flow.LoginHandler)
+	mux.HandleFunc("/oauth/consent", flow.ConsentHandler)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		// 跳转到第三方应用时停止
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Host == "client.example" {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	return &testServer{Server: ts, flow: flow, tokens: tokens, consents: consents, client: client}
+}
+
+func (ts *testServer) authorize(t *testing.T, clientID string, scope string) *http.Response {
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {clientID},
+		"redirect_uri":  {redirectURI},
+		"scope":         {scope},
+		"state":         {"xyz"},
+	}
+	resp, err := ts.client.Get(ts.URL + "/oauth/authorize?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func (ts *testServer) post(t *testing.T, path string, form url.Values) *http.Response {
+	form.Set("csrf_token", ts.csrfToken(t, path))
+	resp, err := ts.client.PostForm(ts.URL+path, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+var csrfPattern = regexp.MustCompile(`name="csrf_token" value="([0-9a-f]+)"`)
+
+func (ts *testServer) csrfToken(t *testing.T, path string) string {
+	resp, err := ts.client.Get(ts.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := readBody(resp)
+	m := csrfPattern.FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("%s: no csrf_token in %q", path, body)
+	}
+	return m[1]
+}
+
+func readBody(resp *http.Response) string {
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	return string(body)
+}
+
+// 跳转回第三方应用的参数
+func callback(t *testing.T, resp *http.Response) url.Values {
+	t.Helper()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("status = %d, body = %q", resp.StatusCode, readBody(resp))
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), redirectURI) {
+		t.Fatalf("location = %q", resp.Header.Get("Location"))
+	}
+	return location.Query()
+}
+
+func TestLoginAndConsent(t *testing.T) {
+	ts := newTestServer(t)
+
+	// 未登录时跳转到登录页面
+	resp := ts.authorize(t, "c1", "read write")
+	if resp.Request.URL.Path != "/oauth/login" {
+		t.Fatalf("path = %s", resp.Request.URL.Path)
+	}
+	if resp.Header.Get("X-Frame-Options") != "DENY" {
+		t.Error("login page can be framed")
+	}
+
+	// 密码错误
+	resp = ts.post(t, "/oauth/login", url.Values{"username": {"alice"}, "password": {"wrong"}})
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("X-Frame-Options") != "DENY" {
+		t.Fatalf("wrong password: status = %d, headers = %v", resp.StatusCode, resp.Header)
+	}
+
+	// 登录后跳转到授权页面，会话ID改变
+	before := ts.client.Jar.Cookies(resp.Request.URL)
+	resp = ts.post(t, "/oauth/login", url.Values{"username": {"alice"}, "password": {"secret"}})
+	if resp.Request.URL.Path != "/oauth/consent" {
+		t.Fatalf("path = %s", resp.Request.URL.Path)
+	}
+	after := ts.client.Jar.Cookies(resp.Request.URL)
+	if len(before) != 1 || len(after) != 1 || before[0].Value == after[0].Value {
+		t.Errorf("session id not rotated: %v %v", before, after)
+	}
+	if body := readBody(resp); !strings.Contains(body, "c1") || !strings.Contains(body, `value="write"`) {
+		t.Errorf("consent page = %q", body)
+	}
+
+	// 只同意read
+	query := callback(t, ts.post(t, "/oauth/consent", url.Values{"action": {"approve"}, "scope": {"read", "admin"}}))
+	if query.Get("code") == "" || query.Get("state") != "xyz" {
+		t.Fatalf("query = %v", query)
+	}
+	ti, err := ts.tokens.GetByCode(query.Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.GetUserID() != "user-alice" || ti.GetScope() != "read" {
+		t.Errorf("user = %s, scope = %s", ti.GetUserID(), ti.GetScope())
+	}
+	if len(ts.consents) != 0 {
+		t.Errorf("consent remembered: %v", ts.consents)
+	}
+
+	// 没有记住授权，再次请求时显示授权页面
+	resp = ts.authorize(t, "c1", "read")
+	if resp.Request.URL.Path != "/oauth/consent" {
+		t.Fatalf("path = %s", resp.Request.URL.Path)
+	}
+}
+
+func TestRememberedConsent(t *testing.T) {
+	ts := newTestServer(t)
+	ts.authorize(t, "c1", "read write")
+	ts.post(t, "/oauth/login", url.Values{"username": {"alice"}, "password": {"secret"}})
+	callback(t, ts.post(t, "/oauth/consent", url.Values{"action": {"approve"}, "scope": {"read", "write"}, "remember": {"1"}}))
+	if ts.consents["user-alice|c1"] != "read write" {
+		t.Fatalf("consents = %v", ts.consents)
+	}
+
+	// 记住的授权包含申请的scope，直接跳转回第三方应用
+	query := callback(t, ts.authorize(t, "c1", "write"))
+	ti, err := ts.tokens.GetByCode(query.Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.GetScope() != "write" || ti.GetAccessExpiresIn() != time.Minute {
+		t.Errorf("scope = %s, exp = %v", ti.GetScope(), ti.GetAccessExpiresIn())
+	}
+
+	// 申请新的scope或其他应用时仍然需要授权
+	if resp := ts.authorize(t, "c1", "read admin"); resp.Request.URL.Path != "/oauth/consent" {
+		t.Errorf("new scope: path = %s", resp.Request.URL.Path)
+	}
+	if resp := ts.authorize(t, "c2", "read"); resp.Request.URL.Path != "/oauth/consent" {
+		t.Errorf("other client: path = %s", resp.Request.URL.Path)
+	}
+}
+
+func TestDenyConsent(t *testing.T) {
+	ts := newTestServer(t)
+	ts.authorize(t, "c1", "read")
+	ts.post(t, "/oauth/login", url.Values{"username": {"alice"}, "password": {"secret"}})
+	query := callback(t, ts.post(t, "/oauth/consent", url.Values{"action": {"deny"}, "remember": {"1"}}))
+	if query.Get("error") != "access_denied" || query.Get("code") != "" {
+		t.Errorf("query = %v", query)
+	}
+	if len(ts.consents) != 0 {
+		t.Errorf("denied consent remembered: %v", ts.consents)
+	}
+
+	// 同意但没有勾选任何scope，按拒绝处理
+	ts.authorize(t, "c1", "read")
+	query = callback(t, ts.post(t, "/oauth/consent", url.Values{"action": {"approve"}}))
+	if query.Get("error") != "access_denied" {
+		t.Errorf("empty scope: query = %v", query)
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	ts := newTestServer(t)
+	ts.authorize(t, "c1", "read")
+	for _, token := range []string{"", "bad"} {
+		resp, err := ts.client.PostForm(ts.URL+"/oauth/login", url.Values{"username": {"alice"}, "password": {"secret"}, "csrf_token": {token}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("csrf_token %q: status = %d", token, resp.StatusCode)
+		}
+	}
+
+	// 没有等待中的授权请求
+	resp, err := http.Get(ts.URL + "/oauth/consent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("no session: status = %d", resp.StatusCode)
+	}
+}
+
+func TestSameRequest(t *testing.T) {
+	pending := url.Values{"client_id": {"c1"}, "redirect_uri": {redirectURI}, "scope": {"read"}, "response_type": {"code"}, "state": {"a"}}
+	form := copyValues(pending)
+	form.Set("state", "b")
+	if !sameRequest(pending, form) {
+		t.Error("state should not matter")
+	}
+	form.Set("scope", "read write")
+	if sameRequest(pending, form) {
+		t.Error("scope changed")
+	}
+	if sameRequest(nil, form) {
+		t.Error("nil pending")
+	}
+}
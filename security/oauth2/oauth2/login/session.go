@@ -0,0 +1,93 @@
+package login
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 授权流程的会话，保存在服务端，浏览器的Cookie中只有会话ID
+type Session struct {
+	ID        string
+	UserID    string     // 登录的用户，未登录时为空
+	AuthTime  time.Time  // 登录时间
+	Pending   url.Values // 等待登录或授权的授权请求
+	Approval  *Approval  // 用户对授权请求的决定，AuthorizeScopeHandler和AccessTokenExpHandler从这里读取
+	CSRFToken string     // 登录和授权页面表单中的随机值
+	ExpiresAt time.Time
+}
+
+// 用户对一次授权请求的决定
+type Approval struct {
+	ClientID   string
+	Scope      string // 用户同意的scope，是申请的scope的子集
+	Denied     bool
+	Remembered bool // 来自记住的授权，没有显示授权页面
+}
+
+type SessionStore interface {
+	// 不存在或已过期时返回nil
+	Get(id string) (*Session, error)
+	Save(session *Session) error
+	Delete(id string) error
+}
+
+// 基于内存的SessionStore，过期的会话在Save时定期清理
+type MemorySessionStore struct {
+	sync.Mutex
+	sessions  map[string]*Session
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*Session),
+		now:      time.Now,
+	}
+}
+
+func (store *MemorySessionStore) Get(id string) (*Session, error) {
+	store.Lock()
+	defer store.Unlock()
+	session, ok := store.sessions[id]
+	if !ok || store.now().After(session.ExpiresAt) {
+		return nil, nil
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (store *MemorySessionStore) Save(session *Session) error {
+	store.Lock()
+	defer store.Unlock()
+	now := store.now()
+	if now.Sub(store.lastSweep) > time.Minute {
+		for id, s := range store.sessions {
+			if now.After(s.ExpiresAt) {
+				delete(store.sessions, id)
+			}
+		}
+		store.lastSweep = now
+	}
+	saved := *session
+	store.sessions[session.ID] = &saved
+	return nil
+}
+
+func (store *MemorySessionStore) Delete(id string) error {
+	store.Lock()
+	defer store.Unlock()
+	delete(store.sessions, id)
+	return nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
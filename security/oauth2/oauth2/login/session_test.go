@@ -0,0 +1,40 @@
+package login
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemorySessionStore(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	store := NewMemorySessionStore()
+	store.now = func() time.Time { return now }
+
+	store.Save(&Session{ID: "s1", UserID: "alice", ExpiresAt: now.Add(time.Hour)})
+	store.Save(&Session{ID: "s2", ExpiresAt: now.Add(time.Second)})
+
+	// 返回的是副本，修改后需要Save
+	session, err := store.Get("s1")
+	if err != nil || session == nil || session.UserID != "alice" {
+		t.Fatalf("session = %+v, err = %v", session, err)
+	}
+	session.UserID = "bob"
+	if s, _ := store.Get("s1"); s.UserID != "alice" {
+		t.Error("session modified without Save")
+	}
+
+	// 过期后Get返回nil，下次Save时清理
+	now = now.Add(2 * time.Minute)
+	if s, _ := store.Get("s2"); s != nil {
+		t.Error("expired session returned")
+	}
+	store.Save(&Session{ID: "s3", ExpiresAt: now.Add(time.Hour)})
+	if _, ok := store.sessions["s2"]; ok {
+		t.Error("expired session not swept")
+	}
+
+	store.Delete("s1")
+	if s, _ := store.Get("s1"); s != nil {
+		t.Error("deleted session returned")
+	}
+}
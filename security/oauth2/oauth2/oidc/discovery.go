@@ -0,0 +1,58 @@
+package oidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+// discovery文档，应用据此找到各个端点和JWKS
+//
+// 参考 https://openid.net/specs/openid-connect-discovery-1_0.html
+type Configuration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	ClaimsSupported                   []string `json:"claims_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+func (provider *Provider) Configuration() *Configuration {
+	issuer := strings.TrimRight(provider.Issuer, "/")
+	return &Configuration{
+		Issuer:                            provider.Issuer,
+		AuthorizationEndpoint:             issuer + provider.AuthorizePath,
+		TokenEndpoint:                     issuer + provider.TokenPath,
+		UserInfoEndpoint:                  issuer + provider.UserInfoPath,
+		JWKSURI:                           issuer + provider.JWKSPath,
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  provider.Algorithms,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_post", "none"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "preferred_username", "picture", "email", "email_verified"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	}
+}
+
+// discovery文档，挂在DiscoveryPath上
+func (provider *Provider) DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(provider.Configuration())
+}
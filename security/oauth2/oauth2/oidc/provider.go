@@ -0,0 +1,202 @@
+package oidc
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"gopkg.in/oauth2.v3"
+	oauth2errors "gopkg.in/oauth2.v3/errors"
+
+	"paradigm/security/jwt"
+)
+
+//
+// OpenID Connect Provider
+//
+// OIDC在OAuth2的基础上增加了身份认证：授权请求的scope包含openid时，Token响应中除了Access Token还有一个ID Token，
+// 它是授权服务器签名的JWT，说明是谁(sub)、在什么时候(auth_time)、为哪个应用(aud)登录的，应用校验签名后就可以确认用户身份。
+// 流程如下：
+// 1)应用把用户导向/oauth/authorize，scope包含openid，带上随机的nonce
+// 2)生成授权码时保存nonce和用户的登录时间，有效期和授权码一致
+// 3)应用用授权码换取Token时签发ID Token，放入Token响应的id_token字段；nonce原样放入ID Token，应用据此防止重放
+// 4)应用需要更多的用户信息时，用Access Token访问/userinfo
+//
+// 和pkce包一样，这里包装manage.Manager的授权码生成器和Token生成器，ID Token通过server.ExtensionFieldsHandler返回。
+// 签名密钥使用jwt.KeyRotator轮换，公钥通过JWKS发布，应用从/.well-known/openid-configuration中找到JWKS的地址。
+//
+// 参考 https://openid.net/specs/openid-connect-core-1_0.html
+//
+
+// ID Token的声明
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"` // 用户登录的时间，Unix时间戳(秒)
+}
+
+// 保存授权码对应的nonce和登录时间，storage.AuthorizationStore实现该接口
+type AuthorizationStore interface {
+	SaveAuthorization(code string, nonce string, authTime time.Time, expiresAt time.Time) error
+	// 不存在或已过期时ok为false
+	GetAuthorization(code string) (nonce string, authTime time.Time, ok bool, err error)
+}
+
+type Provider struct {
+	Issuer         string           // iss，也是discovery文档所在的地址，例如https://auth.example.com
+	IDTokens       *jwt.TokenIssuer // 签发ID Token，一般使用jwt.NewRotatingIssuer，有效期不能超过KeyRotator.TokenTTL
+	Keys           jwt.KeySource    // 发布在JWKS中的公钥
+	Algorithms     []string         // ID Token的签名算法，发布在discovery文档中
+	Users          UserRepository
+	Authorizations AuthorizationStore
+	// 用户登录的时间，例如login.Flow.AuthTime；为空时ID Token中没有auth_time
+	AuthTime func(r *http.Request) (time.Time, error)
+	// 校验UserInfo请求中的Access Token，例如server.ValidationBearerToken
+	ValidateAccessToken func(r *http.Request) (oauth2.TokenInfo, error)
+
+	AuthorizePath string
+	TokenPath     string
+	UserInfoPath  string
+	JWKSPath      string
+
+	mu     sync.Mutex
+	issued map[string]*issuedIDToken // Access Token -> 等待放入Token响应的ID Token
+}
+
+type issuedIDToken struct {
+	idToken  string
+	issuedAt time.Time
+}
+
+func NewProvider(issuer string, idTokens *jwt.TokenIssuer, keys jwt.KeySource, users UserRepository, authorizations AuthorizationStore) *Provider {
+	return &Provider{
+		Issuer:         issuer,
+		IDTokens:       idTokens,
+		Keys:           keys,
+		Algorithms:     []string{"RS256"},
+		Users:          users,
+		Authorizations: authorizations,
+		AuthorizePath:  "/oauth/authorize",
+		TokenPath:      "/oauth/access_token",
+		UserInfoPath:   "/userinfo",
+		JWKSPath:       "/.well-known/jwks.json",
+		issued:         make(map[string]*issuedIDToken),
+	}
+}
+
+// 包装授权码生成器，scope包含openid时保存nonce和登录时间
+func (provider *Provider) AuthorizeGenerate(next oauth2.AuthorizeGenerate) oauth2.AuthorizeGenerate {
+	return &authorizeGenerate{provider: provider, next: next}
+}
+
+// 包装Token生成器，授权码换取Token时签发ID Token
+// 应当包装在pkce.Server.AccessGenerate外层，校验code_verifier失败时不签发
+func (provider *Provider) AccessGenerate(next oauth2.AccessGenerate) oauth2.AccessGenerate {
+	return &accessGenerate{provider: provider, next: next}
+}
+
+type authorizeGenerate struct {
+	provider *Provider
+	next     oauth2.AuthorizeGenerate
+}
+
+func (g *authorizeGenerate) Token(data *oauth2.GenerateBasic) (string, error) {
+	code, err := g.next.Token(data)
+	if err != nil || !hasScope(data.TokenInfo.GetScope(), ScopeOpenID) {
+		return code, err
+	}
+	var authTime time.Time
+	if g.provider.AuthTime != nil {
+		if authTime, err = g.provider.AuthTime(data.Request); err != nil {
+			return "", err
+		}
+	}
+	ti := data.TokenInfo
+	expiresAt := ti.GetCodeCreateAt().Add(ti.GetCodeExpiresIn())
+	if err := g.provider.Authorizations.SaveAuthorization(code, data.Request.FormValue("nonce"), authTime, expiresAt); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+type accessGenerate struct {
+	provider *Provider
+	next     oauth2.AccessGenerate
+}
+
+func (g *accessGenerate) Token(data *oauth2.GenerateBasic, isGenRefresh bool) (string, string, error) {
+	r := data.Request
+	if r == nil || r.FormValue("grant_type") != oauth2.AuthorizationCode.String() || !hasScope(data.TokenInfo.GetScope(), ScopeOpenID) {
+		return g.next.Token(data, isGenRefresh)
+	}
+	nonce, authTime, ok, err := g.provider.Authorizations.GetAuthorization(r.FormValue("code"))
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", oauth2errors.ErrInvalidGrant
+	}
+	access, refresh, err := g.next.Token(data, isGenRefresh)
+	if err != nil {
+		return "", "", err
+	}
+	idToken, err := g.provider.issueIDToken(data.Client.GetID(), data.UserID, nonce, authTime)
+	if err != nil {
+		return "", "", err
+	}
+	g.provider.pushIDToken(access, idToken)
+	return access, refresh, nil
+}
+
+func (provider *Provider) issueIDToken(clientID string, userID string, nonce string, authTime time.Time) (string, error) {
+	claims := &IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   provider.Issuer,
+			Subject:  userID,
+			Audience: jwt.Audience{clientID},
+		},
+		Nonce: nonce,
+	}
+	if !authTime.IsZero() {
+		claims.AuthTime = authTime.Unix()
+	}
+	return provider.IDTokens.Issue(claims)
+}
+
+// 生成Token和写响应在同一个请求中，ID Token只需要短暂保存；没有取走的(例如保存Token失败)一分钟后清理
+func (provider *Provider) pushIDToken(access string, idToken string) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	now := time.Now()
+	for k, v := range provider.issued {
+		if now.Sub(v.issuedAt) > time.Minute {
+			delete(provider.issued, k)
+		}
+	}
+	provider.issued[access] = &issuedIDToken{idToken: idToken, issuedAt: now}
+}
+
+func (provider *Provider) popIDToken(access string) string {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	issued, ok := provider.issued[access]
+	if !ok {
+		return ""
+	}
+	delete(provider.issued, access)
+	return issued.idToken
+}
+
+// 实现server.ExtensionFieldsHandler，把ID Token放入Token响应
+func (provider *Provider) ExtensionFieldsHandler(ti oauth2.TokenInfo) map[string]interface{} {
+	idToken := provider.popIDToken(ti.GetAccess())
+	if idToken == "" {
+		return nil
+	}
+	return map[string]interface{}{"id_token": idToken}
+}
+
+// 发布ID Token签名公钥的JWKS
+func (provider *Provider) JWKSHandler() http.Handler {
+	return jwt.NewJWKSHandler(provider.Keys)
+}
@@ -0,0 +1,242 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/generates"
+	"gopkg.in/oauth2.v3/manage"
+	"gopkg.in/oauth2.v3/models"
+	"gopkg.in/oauth2.v3/server"
+	"gopkg.in/oauth2.v3/store"
+
+	"paradigm/security/jwt"
+)
+
+type memoryAuthorizations struct {
+	sync.Mutex
+	nonces    map[string]string
+	authTimes map[string]time.Time
+}
+
+func (m *memoryAuthorizations) SaveAuthorization(code string, nonce string, authTime time.Time, expiresAt time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	m.nonces[code] = nonce
+	m.authTimes[code] = authTime
+	return nil
+}
+
+func (m *memoryAuthorizations) GetAuthorization(code string) (string, time.Time, bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	nonce, ok := m.nonces[code]
+	return nonce, m.authTimes[code], ok, nil
+}
+
+type memoryUsers map[string]*UserInfo
+
+func (users memoryUsers) GetUser(userID string) (*UserInfo, error) {
+	return users[userID], nil
+}
+
+const redirectURI = "http://client.example/callback"
+
+var authTime = time.Unix(1600000000, 0)
+
+type testProvider struct {
+	*httptest.Server
+	provider *Provider
+	keyring  *jwt.Keyring
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := jwt.NewSigningKey("k1", privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := jwt.NewKeyring(signingKey.Public())
+
+	manager := manage.NewDefaultManager()
+	manager.MustTokenStorage(store.NewMemoryTokenStore())
+	clients := store.NewClientStore()
+	clients.Set("c1", &models.Client{ID: "c1", Secret: "s1", Domain: "http://client.example"})
+	manager.MapClientStorage(clients)
+
+	users := memoryUsers{"alice": {Subject: "alice", Name: "Alice", PreferredUsername: "alice", Email: "alice@example.com", EmailVerified: true}}
+	authorizations := &memoryAuthorizations{nonces: make(map[string]string), authTimes: make(map[string]time.Time)}
+	provider := NewProvider("http://issuer.example", signingKey.Issuer(), keyring, users, authorizations)
+	provider.AuthTime = func(r *http.Request) (time.Time, error) { return authTime, nil }
+	manager.MapAuthorizeGenerate(provider.AuthorizeGenerate(generates.NewAuthorizeGenerate()))
+	manager.MapAccessGenerate(provider.AccessGenerate(generates.NewAccessGenerate()))
+
+	srv := server.NewDefaultServer(manager)
+	srv.SetAllowedResponseType(oauth2.Code)
+	srv.SetAllowedGrantType(oauth2.AuthorizationCode)
+	srv.SetClientInfoHandler(server.ClientFormHandler)
+	srv.SetUserAuthorizationHandler(func(w http.ResponseWriter, r *http.Request) (string, error) {
+		return "alice", nil
+	})
+	srv.SetExtensionFieldsHandler(provider.ExtensionFieldsHandler)
+	provider.ValidateAccessToken = srv.ValidationBearerToken
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(provider.AuthorizePath, func(w http.ResponseWriter, r *http.Request) {
+		srv.HandleAuthorizeRequest(w, r)
+	})
+	mux.HandleFunc(provider.TokenPath, func(w http.ResponseWriter, r *http.Request) {
+		srv.HandleTokenRequest(w, r)
+	})
+	mux.HandleFunc(DiscoveryPath, provider.DiscoveryHandler)
+	mux.Handle(provider.JWKSPath, provider.JWKSHandler())
+	mux.HandleFunc(provider.UserInfoPath, provider.UserInfoHandler)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return &testProvider{Server: ts, provider: provider, keyring: keyring}
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+	Error       string `json:"error"`
+}
+
+// 授权并用授权码换取Token
+func (tp *testProvider) login(t *testing.T, scope string, nonce string) *tokenResponse {
+	t.Helper()
+	query := url.Values{"response_type": {"code"}, "client_id": {"c1"}, "redirect_uri": {redirectURI}, "scope": {scope}, "nonce": {nonce}}
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(tp.URL + tp.provider.AuthorizePath + "?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	code := location.Query().Get("code")
+	if code == "" {
+		t.Fatalf("location = %q", resp.Header.Get("Location"))
+	}
+
+	resp, err = http.PostForm(tp.URL+tp.provider.TokenPath, url.Values{
+		"grant_type": {"authorization_code"}, "client_id": {"c1"}, "client_secret": {"s1"}, "code": {code}, "redirect_uri": {redirectURI},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken == "" {
+		t.Fatalf("token error = %q", token.Error)
+	}
+	return &token
+}
+
+func (tp *testProvider) userInfo(t *testing.T, accessToken string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, tp.URL+tp.provider.UserInfoPath, nil)
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var info map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&info)
+	return resp, info
+}
+
+func TestIDToken(t *testing.T) {
+	tp := newTestProvider(t)
+	token := tp.login(t, "openid profile", "n-0S6_WzA2Mj")
+	if token.IDToken == "" {
+		t.Fatal("no id_token")
+	}
+
+	validator := jwt.NewKeyringValidator(tp.keyring)
+	validator.Issuer = "http://issuer.example"
+	validator.Audience = "c1"
+	var claims IDTokenClaims
+	if _, err := validator.ValidateWithClaims(token.IDToken, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice" || claims.Nonce != "n-0S6_WzA2Mj" || claims.AuthTime != authTime.Unix() {
+		t.Errorf("claims = %+v", claims)
+	}
+	if claims.ExpiresAt-claims.IssuedAt != int64(jwt.DefaultTokenTTL/time.Second) {
+		t.Errorf("ttl = %d", claims.ExpiresAt-claims.IssuedAt)
+	}
+
+	// 没有openid时只有Access Token
+	if token := tp.login(t, "profile", ""); token.IDToken != "" {
+		t.Error("id_token without openid scope")
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	tp := newTestProvider(t)
+
+	token := tp.login(t, "openid email", "")
+	resp, info := tp.userInfo(t, token.AccessToken)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	// 只返回scope允许的声明
+	if info["sub"] != "alice" || info["email"] != "alice@example.com" || info["email_verified"] != true || info["name"] != nil {
+		t.Errorf("info = %v", info)
+	}
+
+	if resp, _ := tp.userInfo(t, ""); resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("no token: status = %d", resp.StatusCode)
+	}
+	if resp, _ := tp.userInfo(t, "invalid"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("invalid token: status = %d", resp.StatusCode)
+	}
+	token = tp.login(t, "profile", "")
+	if resp, _ := tp.userInfo(t, token.AccessToken); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("without openid: status = %d", resp.StatusCode)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	tp := newTestProvider(t)
+	resp, err := http.Get(tp.URL + DiscoveryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var config Configuration
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Issuer != "http://issuer.example" || config.TokenEndpoint != "http://issuer.example/oauth/access_token" ||
+		config.JWKSURI != "http://issuer.example/.well-known/jwks.json" || config.IDTokenSigningAlgValuesSupported[0] != "RS256" {
+		t.Errorf("config = %+v", config)
+	}
+
+	// JWKS中的公钥可以校验ID Token
+	keys := jwt.NewRemoteKeySet(tp.URL + tp.provider.JWKSPath)
+	token := tp.login(t, "openid", "")
+	if _, err := jwt.NewTokenValidator(keys.Keyfunc, "RS256").Validate(token.IDToken); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,89 @@
+package oidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"paradigm/security/jwt"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// 用户信息，字段名使用OIDC的标准声明
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+}
+
+// 用户仓库，需要业务代码实现
+type UserRepository interface {
+	// 不存在时返回nil
+	GetUser(userID string) (*UserInfo, error)
+}
+
+// 只返回scope允许的声明：profile对应name、preferred_username、picture，email对应email、email_verified
+func (info *UserInfo) filter(scope string) *UserInfo {
+	filtered := &UserInfo{Subject: info.Subject}
+	if hasScope(scope, ScopeProfile) {
+		filtered.Name = info.Name
+		filtered.PreferredUsername = info.PreferredUsername
+		filtered.Picture = info.Picture
+	}
+	if hasScope(scope, ScopeEmail) {
+		filtered.Email = info.Email
+		filtered.EmailVerified = info.EmailVerified
+	}
+	return filtered
+}
+
+// UserInfo端点，需要带有openid scope的Access Token
+//
+// 校验Access Token使用server.ValidationBearerToken，错误按RFC 6750返回WWW-Authenticate。
+func (provider *Provider) UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	ti, err := provider.ValidateAccessToken(r)
+	if err != nil || ti == nil {
+		jwt.WriteBearerError(w, "", http.StatusUnauthorized, "invalid_token", "")
+		return
+	}
+	if !hasScope(ti.GetScope(), ScopeOpenID) {
+		jwt.WriteBearerError(w, "", http.StatusForbidden, "insufficient_scope", "openid scope required")
+		return
+	}
+	info, err := provider.Users.GetUser(ti.GetUserID())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if info == nil {
+		// 用户已经删除，Token也就无效了
+		jwt.WriteBearerError(w, "", http.StatusUnauthorized, "invalid_token", "user not found")
+		return
+	}
+	filtered := info.filter(ti.GetScope())
+	filtered.Subject = ti.GetUserID()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(filtered)
+}
+
+func hasScope(scope string, s string) bool {
+	for _, v := range strings.Fields(scope) {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package oidc
+
+import "testing"
+
+func TestUserInfoFilter(t *testing.T) {
+	info := &UserInfo{Subject: "alice", Name: "Alice", PreferredUsername: "alice", Picture: "http://example.com/a.png", Email: "alice@example.com", EmailVerified: true}
+	if got := *info.filter("openid"); got != (UserInfo{Subject: "alice"}) {
+		t.Errorf("openid: %+v", got)
+	}
+	if got := *info.filter("openid profile"); got.Name != "Alice" || got.Picture == "" || got.Email != "" {
+		t.Errorf("profile: %+v", got)
+	}
+	if got := *info.filter("email openid"); got.Email != "alice@example.com" || !got.EmailVerified || got.Name != "" {
+		t.Errorf("email: %+v", got)
+	}
+}
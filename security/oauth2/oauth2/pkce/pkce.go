@@ -0,0 +1,216 @@
+package pkce
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"gopkg.in/oauth2.v3"
+	oauth2errors "gopkg.in/oauth2.v3/errors"
+)
+
+//
+// PKCE(RFC 7636)
+//
+// 公开客户端(手机应用、单页应用)无法保存client_secret，授权码被截获后可以直接换取Token。PKCE的流程如下：
+// 1)客户端生成随机的code_verifier，计算code_challenge = BASE64URL(SHA256(code_verifier))，
+//   授权请求中带上code_challenge和code_challenge_method=S256
+// 2)服务端生成授权码时保存code_challenge，有效期和授权码一致
+// 3)客户端用授权码换取Token时带上code_verifier，服务端重新计算后和保存的code_challenge比较
+// 截获授权码的攻击者没有code_verifier，无法换取Token。
+//
+// gopkg.in/oauth2.v3不支持PKCE，这里包装manage.Manager的授权码生成器和Token生成器：
+// 生成授权码时可以读到授权请求，生成Token时授权码已经校验并删除，可以读到Token请求。
+// 不支持plain方式，只支持S256。
+//
+// 参考 https://tools.ietf.org/html/rfc7636
+//
+
+var (
+	ErrInvalidVerifier = errors.New("pkce: invalid code_verifier")
+)
+
+const (
+	MethodS256 = "S256"
+	// code_verifier的长度是43到128个字符
+	minVerifierLength = 43
+	maxVerifierLength = 128
+)
+
+// 生成code_verifier，32字节随机数的BASE64URL编码，43个字符
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 计算S256方式的code_challenge
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// 检查code_verifier和code_challenge是否匹配
+func Verify(verifier string, challenge string) error {
+	if !validVerifier(verifier) {
+		return ErrInvalidVerifier
+	}
+	if subtle.ConstantTimeCompare([]byte(Challenge(verifier)), []byte(challenge)) != 1 {
+		return ErrInvalidVerifier
+	}
+	return nil
+}
+
+// code_verifier只能包含[A-Z] [a-z] [0-9] "-" "." "_" "~"
+func validVerifier(verifier string) bool {
+	if len(verifier) < minVerifierLength || len(verifier) > maxVerifierLength {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// 保存授权码对应的code_challenge，storage.ChallengeStore实现该接口
+type ChallengeStore interface {
+	SaveChallenge(code string, challenge string, expiresAt time.Time) error
+	// 不存在或已过期时返回空字符串
+	GetChallenge(code string) (string, error)
+}
+
+type Server struct {
+	Challenges ChallengeStore
+	// 客户端是否必须使用PKCE，为空时所有客户端都可以不使用
+	Required func(clientID string) (bool, error)
+}
+
+func NewServer(challenges ChallengeStore, required func(clientID string) (bool, error)) *Server {
+	return &Server{Challenges: challenges, Required: required}
+}
+
+func (s *Server) required(clientID string) (bool, error) {
+	if s.Required == nil {
+		return false, nil
+	}
+	return s.Required(clientID)
+}
+
+// 包装授权码生成器，保存授权请求中的code_challenge
+// 返回的错误由server重定向到redirect_uri，例如error=invalid_request
+func (s *Server) AuthorizeGenerate(next oauth2.AuthorizeGenerate) oauth2.AuthorizeGenerate {
+	return &authorizeGenerate{server: s, next: next}
+}
+
+// 包装Token生成器，授权码换取Token时检查code_verifier
+// 返回的错误由server作为Token请求的错误返回，例如error=invalid_grant
+func (s *Server) AccessGenerate(next oauth2.AccessGenerate) oauth2.AccessGenerate {
+	return &accessGenerate{server: s, next: next}
+}
+
+type authorizeGenerate struct {
+	server *Server
+	next   oauth2.AuthorizeGenerate
+}
+
+func (g *authorizeGenerate) Token(data *oauth2.GenerateBasic) (string, error) {
+	challenge, err := g.challenge(data.Client.GetID(), data.Request)
+	if err != nil {
+		return "", err
+	}
+	code, err := g.next.Token(data)
+	if err != nil || challenge == "" {
+		return code, err
+	}
+	ti := data.TokenInfo
+	if err := g.server.Challenges.SaveChallenge(code, challenge, ti.GetCodeCreateAt().Add(ti.GetCodeExpiresIn())); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+func (g *authorizeGenerate) challenge(clientID string, r *http.Request) (string, error) {
+	challenge := r.FormValue("code_challenge")
+	if challenge == "" {
+		if required, err := g.server.required(clientID); err != nil {
+			return "", err
+		} else if required {
+			return "", oauth2errors.ErrInvalidRequest
+		}
+		return "", nil
+	}
+	// 省略code_challenge_method时默认是plain，不支持
+	if r.FormValue("code_challenge_method") != MethodS256 {
+		return "", oauth2errors.ErrInvalidRequest
+	}
+	// SHA256的BASE64URL编码是43个字符
+	if len(challenge) != 43 {
+		return "", oauth2errors.ErrInvalidRequest
+	}
+	return challenge, nil
+}
+
+type accessGenerate struct {
+	server *Server
+	next   oauth2.AccessGenerate
+}
+
+func (g *accessGenerate) Token(data *oauth2.GenerateBasic, isGenRefresh bool) (string, string, error) {
+	if r := data.Request; r != nil && r.FormValue("grant_type") == oauth2.AuthorizationCode.String() {
+		if err := g.verify(data.Client.GetID(), r); err != nil {
+			return "", "", err
+		}
+	}
+	// 隐式授权(response_type=token)直接从授权端点返回Token，绕过了PKCE，必须使用PKCE的客户端不允许
+	if r := data.Request; r != nil && r.FormValue("response_type") == oauth2.Token.String() {
+		if required, err := g.server.required(data.Client.GetID()); err != nil {
+			return "", "", err
+		} else if required {
+			return "", "", oauth2errors.ErrUnauthorizedClient
+		}
+	}
+	return g.next.Token(data, isGenRefresh)
+}
+
+func (g *accessGenerate) verify(clientID string, r *http.Request) error {
+	challenge, err := g.server.Challenges.GetChallenge(r.FormValue("code"))
+	if err != nil {
+		return err
+	}
+	verifier := r.FormValue("code_verifier")
+	if challenge == "" {
+		required, err := g.server.required(clientID)
+		if err != nil {
+			return err
+		}
+		// 授权请求没有code_challenge，Token请求却带有code_verifier，可能是降级攻击
+		if required || verifier != "" {
+			return oauth2errors.ErrInvalidGrant
+		}
+		return nil
+	}
+	if Verify(verifier, challenge) != nil {
+		return oauth2errors.ErrInvalidGrant
+	}
+	return nil
+}
+
+// 从表单中读取client_id和client_secret，和server.ClientFormHandler不同，允许公开客户端没有client_secret
+// manage.Manager会比较client_secret，有密钥的客户端仍然需要提供密钥
+func ClientFormHandler(r *http.Request) (string, string, error) {
+	clientID := r.Form.Get("client_id")
+	if clientID == "" {
+		return "", "", oauth2errors.ErrInvalidClient
+	}
+	return clientID, r.Form.Get("client_secret"), nil
+}
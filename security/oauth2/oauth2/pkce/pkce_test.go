@@ -0,0 +1,247 @@
+package pkce
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/generates"
+	"gopkg.in/oauth2.v3/manage"
+	"gopkg.in/oauth2.v3/models"
+	"gopkg.in/oauth2.v3/server"
+	"gopkg.in/oauth2.v3/store"
+)
+
+// RFC 7636 附录B的例子
+func TestChallenge(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got := Challenge(verifier); got != challenge {
+		t.Errorf("challenge = %s", got)
+	}
+	if err := Verify(verifier, challenge); err != nil {
+		t.Error(err)
+	}
+	if err := Verify(verifier[:42]+"Y", challenge); err != ErrInvalidVerifier {
+		t.Errorf("wrong verifier: %v", err)
+	}
+	// 长度和字符集
+	for _, v := range []string{"", "short", strings.Repeat("a", 129), strings.Repeat("a", 42) + "+"} {
+		if err := Verify(v, Challenge(v)); err != ErrInvalidVerifier {
+			t.Errorf("%q: %v", v, err)
+		}
+	}
+
+	v1, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, _ := NewVerifier()
+	if len(v1) != 43 || v1 == v2 || !validVerifier(v1) {
+		t.Errorf("verifiers = %q %q", v1, v2)
+	}
+}
+
+type memoryChallenges struct {
+	sync.Mutex
+	challenges map[string]string
+}
+
+func (m *memoryChallenges) SaveChallenge(code string, challenge string, expiresAt time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	m.challenges[code] = challenge
+	return nil
+}
+
+func (m *memoryChallenges) GetChallenge(code string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.challenges[code], nil
+}
+
+const redirectURI = "http://client.example/callback"
+
+func newTestServer(t *testing.T) *httptest.Server {
+	manager := manage.NewDefaultManager()
+	manager.MustTokenStorage(store.NewMemoryTokenStore())
+	clients := store.NewClientStore()
+	clients.Set("confidential", &models.Client{ID: "confidential", Secret: "secret", Domain: "http://client.example"})
+	clients.Set("public", &models.Client{ID: "public", Domain: "http://client.example"})
+	manager.MapClientStorage(clients)
+
+	p := NewServer(&memoryChallenges{challenges: make(map[string]string)}, func(clientID string) (bool, error) {
+		return clientID == "public", nil
+	})
+	manager.MapAuthorizeGenerate(p.AuthorizeGenerate(generates.NewAuthorizeGenerate()))
+	manager.MapAccessGenerate(p.AccessGenerate(generates.NewAccessGenerate()))
+
+	srv := server.NewDefaultServer(manager)
+	srv.SetAllowedResponseType(oauth2.Code, oauth2.Token)
+	srv.SetAllowedGrantType(oauth2.AuthorizationCode)
+	srv.SetClientInfoHandler(ClientFormHandler)
+	srv.SetUserAuthorizationHandler(func(w http.ResponseWriter, r *http.Request) (string, error) {
+		return "alice", nil
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		srv.HandleAuthorizeRequest(w, r)
+	})
+	mux.HandleFunc("/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		srv.HandleTokenRequest(w, r)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+var noRedirect = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// 返回授权码，失败时返回redirect_uri中的error
+func authorize(t *testing.T, ts *httptest.Server, clientID string, challenge string, method string) (code string, errCode string) {
+	t.Helper()
+	query := url.Values{"response_type": {"code"}, "client_id": {clientID}, "redirect_uri": {redirectURI}}
+	if challenge != "" {
+		query.Set("code_challenge", challenge)
+		query.Set("code_challenge_method", method)
+	}
+	resp, err := noRedirect.Get(ts.URL + "/oauth/authorize?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("status = %d, location = %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	return location.Query().Get("code"), location.Query().Get("error")
+}
+
+// 返回access_token，失败时返回error
+func exchange(t *testing.T, ts *httptest.Server, form url.Values) (token string, errCode string) {
+	t.Helper()
+	form.Set("grant_type", "authorization_code")
+	form.Set("redirect_uri", redirectURI)
+	resp, err := http.PostForm(ts.URL+"/oauth/access_token", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body.AccessToken, body.Error
+}
+
+func TestPublicClient(t *testing.T) {
+	ts := newTestServer(t)
+	verifier, _ := NewVerifier()
+	challenge := Challenge(verifier)
+
+	// 必须使用PKCE，只支持S256
+	if _, e := authorize(t, ts, "public", "", ""); e != "invalid_request" {
+		t.Errorf("no challenge: error = %q", e)
+	}
+	if _, e := authorize(t, ts, "public", verifier, "plain"); e != "invalid_request" {
+		t.Errorf("plain: error = %q", e)
+	}
+
+	code, e := authorize(t, ts, "public", challenge, MethodS256)
+	if code == "" {
+		t.Fatalf("error = %q", e)
+	}
+	if token, e := exchange(t, ts, url.Values{"client_id": {"public"}, "code": {code}, "code_verifier": {verifier}}); token == "" {
+		t.Errorf("exchange: error = %q", e)
+	}
+
+	// 授权码只能使用一次
+	if _, e := exchange(t, ts, url.Values{"client_id": {"public"}, "code": {code}, "code_verifier": {verifier}}); e != "invalid_grant" {
+		t.Errorf("reuse: error = %q", e)
+	}
+
+	// 截获授权码但没有code_verifier
+	code, _ = authorize(t, ts, "public", challenge, MethodS256)
+	if _, e := exchange(t, ts, url.Values{"client_id": {"public"}, "code": {code}}); e != "invalid_grant" {
+		t.Errorf("no verifier: error = %q", e)
+	}
+	other, _ := NewVerifier()
+	code, _ = authorize(t, ts, "public", challenge, MethodS256)
+	if _, e := exchange(t, ts, url.Values{"client_id": {"public"}, "code": {code}, "code_verifier": {other}}); e != "invalid_grant" {
+		t.Errorf("wrong verifier: error = %q", e)
+	}
+}
+
+func TestConfidentialClient(t *testing.T) {
+	ts := newTestServer(t)
+
+	// PKCE是可选的，但仍然需要client_secret
+	code, _ := authorize(t, ts, "confidential", "", "")
+	if _, e := exchange(t, ts, url.Values{"client_id": {"confidential"}, "code": {code}}); e != "invalid_client" {
+		t.Errorf("no secret: error = %q", e)
+	}
+	code, _ = authorize(t, ts, "confidential", "", "")
+	if token, e := exchange(t, ts, url.Values{"client_id": {"confidential"}, "client_secret": {"secret"}, "code": {code}}); token == "" {
+		t.Errorf("without pkce: error = %q", e)
+	}
+
+	// 授权请求没有code_challenge时不接受code_verifier
+	verifier, _ := NewVerifier()
+	code, _ = authorize(t, ts, "confidential", "", "")
+	if _, e := exchange(t, ts, url.Values{"client_id": {"confidential"}, "client_secret": {"secret"}, "code": {code}, "code_verifier": {verifier}}); e != "invalid_grant" {
+		t.Errorf("downgrade: error = %q", e)
+	}
+
+	// 使用了PKCE就必须校验
+	code, _ = authorize(t, ts, "confidential", Challenge(verifier), MethodS256)
+	if _, e := exchange(t, ts, url.Values{"client_id": {"confidential"}, "client_secret": {"secret"}, "code": {code}}); e != "invalid_grant" {
+		t.Errorf("no verifier: error = %q", e)
+	}
+	code, _ = authorize(t, ts, "confidential", Challenge(verifier), MethodS256)
+	if token, e := exchange(t, ts, url.Values{"client_id": {"confidential"}, "client_secret": {"secret"}, "code": {code}, "code_verifier": {verifier}}); token == "" {
+		t.Errorf("with pkce: error = %q", e)
+	}
+}
+
+// 隐式授权绕过了PKCE，必须使用PKCE的客户端不能使用
+func TestImplicitGrant(t *testing.T) {
+	ts := newTestServer(t)
+	implicit := func(clientID string) url.Values {
+		query := url.Values{"response_type": {"token"}, "client_id": {clientID}, "redirect_uri": {redirectURI}}
+		resp, err := noRedirect.Get(ts.URL + "/oauth/authorize?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		location, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil || resp.StatusCode != http.StatusFound {
+			t.Fatalf("status = %d, location = %q", resp.StatusCode, resp.Header.Get("Location"))
+		}
+		// 成功时参数在fragment中，失败时在query中
+		if location.Fragment != "" {
+			values, _ := url.ParseQuery(location.Fragment)
+			return values
+		}
+		return location.Query()
+	}
+	if values := implicit("public"); values.Get("error") != "unauthorized_client" || values.Get("access_token") != "" {
+		t.Errorf("public: %v", values)
+	}
+	if values := implicit("confidential"); values.Get("access_token") == "" {
+		t.Errorf("confidential: %v", values)
+	}
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+const authorizationPrefix = "oidc:"
+
+// 授权码对应的OIDC nonce和用户登录时间，和授权码同时过期
+type AuthorizationStore struct {
+	db *DB
+}
+
+func NewAuthorizationStore(db *DB) *AuthorizationStore {
+	return &AuthorizationStore{db: db}
+}
+
+type authorization struct {
+	Nonce    string    `json:"nonce,omitempty"`
+	AuthTime time.Time `json:"authTime"`
+}
+
+func (store *AuthorizationStore) SaveAuthorization(code string, nonce string, authTime time.Time, expiresAt time.Time) error {
+	data, err := json.Marshal(authorization{Nonce: nonce, AuthTime: authTime})
+	if err != nil {
+		return err
+	}
+	return store.db.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(authorizationPrefix+code, string(data), ttlOptions(expiresAt))
+		return err
+	})
+}
+
+// 不存在或已过期时ok为false
+func (store *AuthorizationStore) GetAuthorization(code string) (nonce string, authTime time.Time, ok bool, err error) {
+	var a authorization
+	err = store.db.db.View(func(tx *buntdb.Tx) error {
+		value, err := tx.Get(authorizationPrefix + code)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(value), &a)
+	})
+	if err == buntdb.ErrNotFound {
+		return "", time.Time{}, false, nil
+	}
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	return a.Nonce, a.AuthTime, true, nil
+}
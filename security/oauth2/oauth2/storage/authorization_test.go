@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthorizationStore(t *testing.T) {
+	store := NewAuthorizationStore(openTestDB(t))
+	if _, _, ok, err := store.GetAuthorization("code1"); ok || err != nil {
+		t.Errorf("empty: ok = %v, err = %v", ok, err)
+	}
+
+	authTime := time.Unix(1600000000, 0)
+	if err := store.SaveAuthorization("code1", "n-0S6_WzA2Mj", authTime, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	nonce, got, ok, err := store.GetAuthorization("code1")
+	if !ok || err != nil || nonce != "n-0S6_WzA2Mj" || !got.Equal(authTime) {
+		t.Errorf("nonce = %q, authTime = %v, ok = %v, err = %v", nonce, got, ok, err)
+	}
+
+	// 授权码过期后不再返回
+	store.SaveAuthorization("code2", "", authTime, time.Now().Add(-time.Second))
+	if _, _, ok, _ := store.GetAuthorization("code2"); ok {
+		t.Error("expired authorization returned")
+	}
+}
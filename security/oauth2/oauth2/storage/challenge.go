@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+const challengePrefix = "pkce:"
+
+// 授权码对应的PKCE code_challenge，和授权码同时过期
+type ChallengeStore struct {
+	db *DB
+}
+
+func NewChallengeStore(db *DB) *ChallengeStore {
+	return &ChallengeStore{db: db}
+}
+
+func (store *ChallengeStore) SaveChallenge(code string, challenge string, expiresAt time.Time) error {
+	return store.db.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(challengePrefix+code, challenge, ttlOptions(expiresAt))
+		return err
+	})
+}
+
+// 不存在或已过期时返回空字符串
+func (store *ChallengeStore) GetChallenge(code string) (string, error) {
+	var challenge string
+	err := store.db.db.View(func(tx *buntdb.Tx) error {
+		var err error
+		challenge, err = tx.Get(challengePrefix + code)
+		return err
+	})
+	if err == buntdb.ErrNotFound {
+		return "", nil
+	}
+	return challenge, err
+}
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChallengeStore(t *testing.T) {
+	store := NewChallengeStore(openTestDB(t))
+	if challenge, err := store.GetChallenge("code1"); challenge != "" || err != nil {
+		t.Errorf("empty: %q %v", challenge, err)
+	}
+
+	if err := store.SaveChallenge("code1", "challenge1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if challenge, err := store.GetChallenge("code1"); challenge != "challenge1" || err != nil {
+		t.Errorf("challenge = %q, err = %v", challenge, err)
+	}
+
+	// 授权码过期后不再返回
+	store.SaveChallenge("code2", "challenge2", time.Now().Add(-time.Second))
+	if challenge, _ := store.GetChallenge("code2"); challenge != "" {
+		t.Errorf("expired challenge = %q", challenge)
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/tidwall/buntdb"
+	"gopkg.in/oauth2.v3"
+)
+
+var ErrClientNotFound = errors.New("storage: client not found")
+
+const clientPrefix = "client:"
+
+// 客户端信息，实现oauth2.ClientInfo
+type Client struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+	Domain string `json:"domain"`
+	UserID string `json:"userId,omitempty"`
+	// 必须使用PKCE，没有Secret的公开客户端应当开启
+	RequirePKCE bool `json:"requirePkce,omitempty"`
+}
+
+func (c *Client) GetID() string     { return c.ID }
+func (c *Client) GetSecret() string { return c.Secret }
+func (c *Client) GetDomain() string { return c.Domain }
+func (c *Client) GetUserID() string { return c.UserID }
+
+// 基于buntdb的oauth2.ClientStore
+type ClientStore struct {
+	db *DB
+}
+
+func NewClientStore(db *DB) *ClientStore {
+	return &ClientStore{db: db}
+}
+
+// 根据ID查找客户端，实现oauth2.ClientStore
+// 不存在时返回nil，由manage.Manager转换为invalid_client，而不是500
+func (store *ClientStore) GetByID(id string) (oauth2.ClientInfo, error) {
+	client, err := store.Get(id)
+	if err == ErrClientNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (store *ClientStore) Get(id string) (*Client, error) {
+	var client Client
+	err := store.db.db.View(func(tx *buntdb.Tx) error {
+		value, err := tx.Get(clientPrefix + id)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(value), &client)
+	})
+	if err == buntdb.ErrNotFound {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// 保存客户端，已存在时覆盖；参数与store.ClientStore.Set一致
+func (store *ClientStore) Set(id string, info oauth2.ClientInfo) error {
+	client, ok := info.(*Client)
+	if !ok {
+		client = &Client{
+			Secret: info.GetSecret(),
+			Domain: info.GetDomain(),
+			UserID: info.GetUserID(),
+		}
+	}
+	saved := *client
+	saved.ID = id
+	data, err := json.Marshal(&saved)
+	if err != nil {
+		return err
+	}
+	return store.db.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(clientPrefix+id, string(data), nil)
+		return err
+	})
+}
+
+// 删除客户端，不存在时忽略；已经签发的Token在过期之前仍然保留
+func (store *ClientStore) Delete(id string) error {
+	err := store.db.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(clientPrefix + id)
+		return err
+	})
+	if err == buntdb.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// 客户端是否必须使用PKCE，用于pkce.Server.Required；不存在的客户端由manage.Manager返回invalid_client
+func (store *ClientStore) RequirePKCE(id string) (bool, error) {
+	client, err := store.Get(id)
+	if err == ErrClientNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return client.RequirePKCE, nil
+}
+
+var _ oauth2.ClientStore = (*ClientStore)(nil)
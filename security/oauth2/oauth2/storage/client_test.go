@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"testing"
+
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestClientStore(t *testing.T) {
+	store := NewClientStore(openTestDB(t))
+	if err := store.Set("c1", &Client{ID: "ignored", Secret: "s1", Domain: "http://localhost:9094", UserID: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := store.GetByID("c1")
+	if err != nil || info.GetID() != "c1" || info.GetSecret() != "s1" || info.GetDomain() != "http://localhost:9094" || info.GetUserID() != "alice" {
+		t.Errorf("info = %+v, err = %v", info, err)
+	}
+
+	// 其他oauth2.ClientInfo的实现
+	if err := store.Set("c2", &models.Client{ID: "c2", Secret: "s2", Domain: "http://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if client, err := store.Get("c2"); err != nil || client.Secret != "s2" || client.Domain != "http://example.com" {
+		t.Errorf("client = %+v, err = %v", client, err)
+	}
+
+	if err := store.Set("c3", &Client{Domain: "http://localhost:9094", RequirePKCE: true}); err != nil {
+		t.Fatal(err)
+	}
+	if required, err := store.RequirePKCE("c3"); !required || err != nil {
+		t.Errorf("c3: required = %v, err = %v", required, err)
+	}
+	if required, err := store.RequirePKCE("c2"); required || err != nil {
+		t.Errorf("c2: required = %v, err = %v", required, err)
+	}
+
+	// 不存在时GetByID返回nil，manage.Manager转换为invalid_client
+	if info, err := store.GetByID("unknown"); info != nil || err != nil {
+		t.Errorf("unknown: %v %v", info, err)
+	}
+	if _, err := store.Get("unknown"); err != ErrClientNotFound {
+		t.Errorf("unknown: err = %v", err)
+	}
+
+	if err := store.Delete("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("c1"); err != ErrClientNotFound {
+		t.Errorf("deleted: err = %v", err)
+	}
+	if err := store.Delete("c1"); err != nil {
+		t.Errorf("delete twice: %v", err)
+	}
+}
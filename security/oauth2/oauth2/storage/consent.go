@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+const consentPrefix = "consent:"
+
+// 用户记住的授权，同一个用户再次授权同一个客户端时，申请的scope都已授权过就不再显示授权页面
+type ConsentStore struct {
+	db *DB
+}
+
+func NewConsentStore(db *DB) *ConsentStore {
+	return &ConsentStore{db: db}
+}
+
+type consent struct {
+	Scope     string    `json:"scope"`
+	GrantedAt time.Time `json:"grantedAt"`
+}
+
+// userID和clientID中可能包含冒号，转义后再拼接
+func consentKey(userID string, clientID string) string {
+	return consentPrefix + url.QueryEscape(userID) + ":" + url.QueryEscape(clientID)
+}
+
+// 返回已授权的scope，没有授权过时ok为false
+func (store *ConsentStore) GetConsent(userID string, clientID string) (scope string, ok bool, err error) {
+	err = store.db.db.View(func(tx *buntdb.Tx) error {
+		value, err := tx.Get(consentKey(userID, clientID))
+		if err != nil {
+			return err
+		}
+		var c consent
+		if err := json.Unmarshal([]byte(value), &c); err != nil {
+			return err
+		}
+		scope, ok = c.Scope, true
+		return nil
+	})
+	if err == buntdb.ErrNotFound {
+		return "", false, nil
+	}
+	return scope, ok, err
+}
+
+// 记住授权，和已授权的scope合并
+func (store *ConsentStore) SaveConsent(userID string, clientID string, scope string) error {
+	key := consentKey(userID, clientID)
+	return store.db.db.Update(func(tx *buntdb.Tx) error {
+		scopes := make(map[string]bool)
+		if value, err := tx.Get(key); err == nil {
+			var c consent
+			if err := json.Unmarshal([]byte(value), &c); err == nil {
+				for _, s := range strings.Fields(c.Scope) {
+					scopes[s] = true
+				}
+			}
+		} else if err != buntdb.ErrNotFound {
+			return err
+		}
+		for _, s := range strings.Fields(scope) {
+			scopes[s] = true
+		}
+		merged := make([]string, 0, len(scopes))
+		for s := range scopes {
+			merged = append(merged, s)
+		}
+		sort.Strings(merged)
+		data, err := json.Marshal(consent{Scope: strings.Join(merged, " "), GrantedAt: time.Now().UTC()})
+		if err != nil {
+			return err
+		}
+		_, _, err = tx.Set(key, string(data), nil)
+		return err
+	})
+}
+
+// 撤销授权，不存在时忽略；已经签发的Token不受影响
+func (store *ConsentStore) RevokeConsent(userID string, clientID string) error {
+	err := store.db.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(consentKey(userID, clientID))
+		return err
+	})
+	if err == buntdb.ErrNotFound {
+		return nil
+	}
+	return err
+}
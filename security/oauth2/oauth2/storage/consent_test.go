@@ -0,0 +1,38 @@
+package storage
+
+import "testing"
+
+func TestConsentStore(t *testing.T) {
+	store := NewConsentStore(openTestDB(t))
+	if _, ok, err := store.GetConsent("alice", "c1"); ok || err != nil {
+		t.Errorf("empty: ok = %v, err = %v", ok, err)
+	}
+
+	store.SaveConsent("alice", "c1", "read")
+	store.SaveConsent("alice", "c1", "write read")
+	if scope, ok, err := store.GetConsent("alice", "c1"); !ok || err != nil || scope != "read write" {
+		t.Errorf("scope = %q, ok = %v, err = %v", scope, ok, err)
+	}
+
+	// 没有scope的授权也记录下来
+	store.SaveConsent("alice", "c2", "")
+	if scope, ok, _ := store.GetConsent("alice", "c2"); !ok || scope != "" {
+		t.Errorf("empty scope: %q %v", scope, ok)
+	}
+
+	// key中的冒号不会混淆
+	store.SaveConsent("a:b", "c", "read")
+	if _, ok, _ := store.GetConsent("a", "b:c"); ok {
+		t.Error("key collision")
+	}
+
+	if err := store.RevokeConsent("alice", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.GetConsent("alice", "c1"); ok {
+		t.Error("revoked consent found")
+	}
+	if err := store.RevokeConsent("alice", "c1"); err != nil {
+		t.Errorf("revoke twice: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"os"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+//
+// 授权服务器的持久化存储
+//
+// gopkg.in/oauth2.v3/store中的NewMemoryTokenStore和NewClientStore只保存在内存中，重启后所有的客户端和Token都丢失了。
+// 这里使用嵌入式的文件数据库buntdb(https://github.com/tidwall/buntdb)实现oauth2.TokenStore和oauth2.ClientStore：
+// 1)持久化：每次写入都追加到文件(AOF)，默认每秒fsync一次，重启时重放文件恢复数据，文件变大后在后台压缩
+// 2)过期：Token按有效期设置TTL，buntdb在后台每秒清理过期的记录，读取时也不会返回已过期的记录
+// 3)并发：写事务串行执行，读事务可以并发，多个Handler goroutine同时访问是安全的
+//
+// 客户端和Token保存在同一个文件中，用key的前缀区分：
+//   client:<id>        客户端
+//   token:<id>         Token的完整信息
+//   code:<code>        授权码 -> token id
+//   access:<access>    Access Token -> token id
+//   refresh:<refresh>  Refresh Token -> token id
+//   consent:<user>:<client>  用户记住的授权
+//   pkce:<code>        授权码对应的PKCE code_challenge
+//   oidc:<code>        授权码对应的OIDC nonce和登录时间
+//
+// 注意：文件中保存了客户端的秘钥和Token，Open时把文件权限设置为0600，只有授权服务器可以读写。
+//
+
+type DB struct {
+	db *buntdb.DB
+}
+
+// 打开数据库文件，不存在时创建；":memory:"为内存数据库，用于测试
+func Open(path string) (*DB, error) {
+	db, err := buntdb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if path != ":memory:" {
+		if err := os.Chmod(path, 0600); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &DB{db: db}, nil
+}
+
+// 关闭前会把未同步的数据写入文件
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+// 过期时间为零值时不过期，已经过期的记录写入后立即不可见
+func ttlOptions(expireAt time.Time) *buntdb.SetOptions {
+	if expireAt.IsZero() {
+		return nil
+	}
+	return &buntdb.SetOptions{Expires: true, TTL: time.Until(expireAt)}
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tidwall/buntdb"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
+)
+
+const (
+	tokenPrefix   = "token:"
+	codePrefix    = "code:"
+	accessPrefix  = "access:"
+	refreshPrefix = "refresh:"
+)
+
+// 基于buntdb的oauth2.TokenStore
+//
+// 授权码、Access Token、Refresh Token分别按自己的有效期过期，Token的完整信息保留到最晚的一个过期为止。
+// 和store.TokenStore不同，RemoveByAccess之后Refresh Token仍然可以使用(刷新时manage.Manager先删除旧的Access Token)，
+// 三个都被删除或过期后才删除Token信息，不会留下无法访问的记录。
+type TokenStore struct {
+	db *DB
+}
+
+func NewTokenStore(db *DB) *TokenStore {
+	return &TokenStore{db: db}
+}
+
+// 有效期为0时不过期
+func expireAt(createAt time.Time, expiresIn time.Duration) time.Time {
+	if expiresIn == 0 {
+		return time.Time{}
+	}
+	return createAt.Add(expiresIn)
+}
+
+// 保存Token，实现oauth2.TokenStore
+func (store *TokenStore) Create(info oauth2.TokenInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	indexes := make(map[string]time.Time)
+	if code := info.GetCode(); code != "" {
+		indexes[codePrefix+code] = expireAt(info.GetCodeCreateAt(), info.GetCodeExpiresIn())
+	}
+	if access := info.GetAccess(); access != "" {
+		indexes[accessPrefix+access] = expireAt(info.GetAccessCreateAt(), info.GetAccessExpiresIn())
+	}
+	if refresh := info.GetRefresh(); refresh != "" {
+		indexes[refreshPrefix+refresh] = expireAt(info.GetRefreshCreateAt(), info.GetRefreshExpiresIn())
+	}
+
+	// Token信息保留到最晚过期的索引
+	var latest time.Time
+	for _, t := range indexes {
+		if t.IsZero() {
+			latest = time.Time{}
+			break
+		}
+		if t.After(latest) {
+			latest = t
+		}
+	}
+
+	id := uuid.New().String()
+	return store.db.db.Update(func(tx *buntdb.Tx) error {
+		if _, _, err := tx.Set(tokenPrefix+id, string(data), ttlOptions(latest)); err != nil {
+			return err
+		}
+		for key, t := range indexes {
+			if _, _, err := tx.Set(key, id, ttlOptions(t)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *TokenStore) RemoveByCode(code string) error {
+	return store.remove(codePrefix + code)
+}
+
+func (store *TokenStore) RemoveByAccess(access string) error {
+	return store.remove(accessPrefix + access)
+}
+
+func (store *TokenStore) RemoveByRefresh(refresh string) error {
+	return store.remove(refreshPrefix + refresh)
+}
+
+// 删除索引，没有其他索引指向Token信息时一起删除；不存在时忽略
+func (store *TokenStore) remove(key string) error {
+	return store.db.db.Update(func(tx *buntdb.Tx) error {
+		id, err := tx.Delete(key)
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		value, err := tx.Get(tokenPrefix + id)
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var token models.Token
+		if err := json.Unmarshal([]byte(value), &token); err != nil {
+			return err
+		}
+		for _, other := range []string{codePrefix + token.Code, accessPrefix + token.Access, refreshPrefix + token.Refresh} {
+			if other == key {
+				continue
+			}
+			if v, err := tx.Get(other); err == nil && v == id {
+				return nil
+			}
+		}
+		_, err = tx.Delete(tokenPrefix + id)
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+func (store *TokenStore) GetByCode(code string) (oauth2.TokenInfo, error) {
+	return store.get(codePrefix + code)
+}
+
+func (store *TokenStore) GetByAccess(access string) (oauth2.TokenInfo, error) {
+	return store.get(accessPrefix + access)
+}
+
+func (store *TokenStore) GetByRefresh(refresh string) (oauth2.TokenInfo, error) {
+	return store.get(refreshPrefix + refresh)
+}
+
+// 不存在或已过期时返回nil，由manage.Manager转换为对应的错误
+func (store *TokenStore) get(key string) (oauth2.TokenInfo, error) {
+	var token models.Token
+	err := store.db.db.View(func(tx *buntdb.Tx) error {
+		id, err := tx.Get(key)
+		if err != nil {
+			return err
+		}
+		value, err := tx.Get(tokenPrefix + id)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(value), &token)
+	})
+	if err == buntdb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+var _ oauth2.TokenStore = (*TokenStore)(nil)
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/manage"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func openTestDB(t *testing.T) *DB {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tempPath(t *testing.T, name string) string {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, name)
+}
+
+func newTestToken(access string, refresh string) *models.Token {
+	now := time.Now()
+	return &models.Token{
+		ClientID:         "client",
+		UserID:           "alice",
+		Scope:            "read",
+		Access:           access,
+		AccessCreateAt:   now,
+		AccessExpiresIn:  time.Hour,
+		Refresh:          refresh,
+		RefreshCreateAt:  now,
+		RefreshExpiresIn: 24 * time.Hour,
+	}
+}
+
+func count(t *testing.T, db *DB, pattern string) int {
+	n := 0
+	err := db.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(pattern, func(key, value string) bool {
+			n++
+			return true
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestTokenStore(t *testing.T) {
+	db := openTestDB(t)
+	store := NewTokenStore(db)
+	if err := store.Create(newTestToken("a1", "r1")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, get := range []func() (oauth2.TokenInfo, error){
+		func() (oauth2.TokenInfo, error) { return store.GetByAccess("a1") },
+		func() (oauth2.TokenInfo, error) { return store.GetByRefresh("r1") },
+	} {
+		info, err := get()
+		if err != nil || info == nil || info.GetUserID() != "alice" || info.GetAccess() != "a1" || info.GetScope() != "read" {
+			t.Errorf("info = %+v, err = %v", info, err)
+		}
+	}
+	if info, err := store.GetByAccess("unknown"); info != nil || err != nil {
+		t.Errorf("unknown: %v %v", info, err)
+	}
+
+	// 删除Access Token后Refresh Token仍然有效，都删除后Token信息也被删除
+	if err := store.RemoveByAccess("a1"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := store.GetByAccess("a1"); info != nil {
+		t.Error("access token not removed")
+	}
+	if info, _ := store.GetByRefresh("r1"); info == nil {
+		t.Error("refresh token removed with access token")
+	}
+	if err := store.RemoveByRefresh("r1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "*"); n != 0 {
+		t.Errorf("%d keys left", n)
+	}
+	if err := store.RemoveByRefresh("r1"); err != nil {
+		t.Errorf("remove twice: %v", err)
+	}
+}
+
+func TestTokenStoreCode(t *testing.T) {
+	db := openTestDB(t)
+	store := NewTokenStore(db)
+	store.Create(&models.Token{ClientID: "client", UserID: "alice", Code: "c1", CodeCreateAt: time.Now(), CodeExpiresIn: 10 * time.Minute})
+	if info, err := store.GetByCode("c1"); err != nil || info == nil || info.GetUserID() != "alice" {
+		t.Errorf("info = %v, err = %v", info, err)
+	}
+	store.RemoveByCode("c1")
+	if info, _ := store.GetByCode("c1"); info != nil {
+		t.Error("code not removed")
+	}
+	if n := count(t, db, "*"); n != 0 {
+		t.Errorf("%d keys left", n)
+	}
+}
+
+func TestTokenStoreExpiration(t *testing.T) {
+	db := openTestDB(t)
+	store := NewTokenStore(db)
+	token := newTestToken("a1", "r1")
+	token.AccessCreateAt = time.Now().Add(-2 * time.Hour)
+	store.Create(token)
+	if info, _ := store.GetByAccess("a1"); info != nil {
+		t.Error("expired access token returned")
+	}
+	if info, _ := store.GetByRefresh("r1"); info == nil {
+		t.Error("refresh token expired with access token")
+	}
+
+	// 后台清理过期的记录
+	short := newTestToken("a2", "")
+	short.AccessExpiresIn = 100 * time.Millisecond
+	store.Create(short)
+	time.Sleep(1500 * time.Millisecond)
+	err := db.db.View(func(tx *buntdb.Tx) error {
+		_, err := tx.Get(accessPrefix+"a2", true)
+		return err
+	})
+	if err != buntdb.ErrNotFound {
+		t.Errorf("expired key not swept: %v", err)
+	}
+
+	// 有效期为0时不过期
+	forever := newTestToken("a3", "")
+	forever.AccessExpiresIn = 0
+	store.Create(forever)
+	db.db.View(func(tx *buntdb.Tx) error {
+		if ttl, err := tx.TTL(accessPrefix + "a3"); err != nil || ttl >= 0 {
+			t.Errorf("ttl = %v, err = %v", ttl, err)
+		}
+		return nil
+	})
+}
+
+func TestTokenStorePersistence(t *testing.T) {
+	path := tempPath(t, "oauth2.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewTokenStore(db).Create(newTestToken("a1", "r1"))
+	NewClientStore(db).Set("client", &Client{Secret: "secret", Domain: "http://localhost:9094"})
+	db.Close()
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, err = %v", fi.Mode(), err)
+	}
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if info, _ := NewTokenStore(db).GetByRefresh("r1"); info == nil || info.GetAccess() != "a1" {
+		t.Errorf("token after reopen = %v", info)
+	}
+	if client, err := NewClientStore(db).Get("client"); err != nil || client.Secret != "secret" {
+		t.Errorf("client after reopen = %v, err = %v", client, err)
+	}
+}
+
+func TestTokenStoreConcurrent(t *testing.T) {
+	store := NewTokenStore(openTestDB(t))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				access := fmt.Sprintf("a-%d-%d", i, j)
+				if err := store.Create(newTestToken(access, "r-"+access)); err != nil {
+					t.Error(err)
+					return
+				}
+				if info, err := store.GetByAccess(access); err != nil || info == nil {
+					t.Errorf("%s: %v %v", access, info, err)
+					return
+				}
+				if err := store.RemoveByAccess(access); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// 作为manage.Manager的存储使用
+func TestManager(t *testing.T) {
+	db := openTestDB(t)
+	clients := NewClientStore(db)
+	clients.Set("client", &Client{Secret: "secret", Domain: "http://localhost:9094"})
+	manager := manage.NewDefaultManager()
+	manager.MapTokenStorage(NewTokenStore(db))
+	manager.MapClientStorage(clients)
+
+	info, err := manager.GenerateAccessToken(oauth2.ClientCredentials, &oauth2.TokenGenerateRequest{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scope:        "read",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := manager.LoadAccessToken(info.GetAccess()); err != nil || loaded.GetClientID() != "client" {
+		t.Errorf("loaded = %v, err = %v", loaded, err)
+	}
+	if _, err := manager.GenerateAccessToken(oauth2.ClientCredentials, &oauth2.TokenGenerateRequest{ClientID: "unknown"}); err == nil || err.Error() != "invalid_client" {
+		t.Errorf("unknown client: err = %v", err)
+	}
+	if err := manager.RemoveAccessToken(info.GetAccess()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.LoadAccessToken(info.GetAccess()); err == nil {
+		t.Error("removed token loaded")
+	}
+}
@@ -0,0 +1,104 @@
+package rp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"paradigm/security/oauth2/oauth2/pkce"
+)
+
+var (
+	ErrShortCookieSecret = errors.New("rp: cookie secret must be at least 32 bytes")
+	errInvalidCookie     = errors.New("rp: invalid cookie")
+)
+
+// 一次登录的随机值，保存在Cookie中
+type loginState struct {
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"` // PKCE的code_verifier
+	ExpiresAt time.Time `json:"exp"`
+}
+
+func newLoginState(expiresAt time.Time) (*loginState, error) {
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := pkce.NewVerifier()
+	if err != nil {
+		return nil, err
+	}
+	return &loginState{State: state, Nonce: nonce, Verifier: verifier, ExpiresAt: expiresAt}, nil
+}
+
+// Cookie的格式：BASE64URL(JSON).BASE64URL(HMAC-SHA256)
+type cookieCodec struct {
+	secret []byte
+}
+
+func newCookieCodec(secret []byte) (*cookieCodec, error) {
+	if len(secret) < 32 {
+		return nil, ErrShortCookieSecret
+	}
+	return &cookieCodec{secret: append([]byte(nil), secret...)}, nil
+}
+
+func (codec *cookieCodec) sign(payload string) string {
+	mac := hmac.New(sha256.New, codec.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (codec *cookieCodec) encode(login *loginState) (string, error) {
+	data, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + codec.sign(payload), nil
+}
+
+func (codec *cookieCodec) decode(value string) (*loginState, error) {
+	i := strings.IndexByte(value, '.')
+	if i < 0 {
+		return nil, errInvalidCookie
+	}
+	payload, signature := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(codec.sign(payload))) {
+		return nil, errInvalidCookie
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidCookie
+	}
+	var login loginState
+	if err := json.Unmarshal(data, &login); err != nil {
+		return nil, errInvalidCookie
+	}
+	return &login, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 空字符串不相等，防止双方都缺失时通过
+func constantTimeEqual(a string, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
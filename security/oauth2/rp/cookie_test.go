@@ -0,0 +1,35 @@
+package rp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookieCodec(t *testing.T) {
+	codec, err := newCookieCodec(cookieSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	login, err := newLoginState(time.Unix(1600000000, 0).UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := codec.encode(login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.decode(value)
+	if err != nil || *decoded != *login {
+		t.Fatalf("decoded = %+v, err = %v", decoded, err)
+	}
+
+	// 篡改内容或签名、其他密钥签名的Cookie都不接受
+	other, _ := newCookieCodec([]byte(strings.Repeat("x", 32)))
+	otherValue, _ := other.encode(login)
+	for _, v := range []string{"", "no-dot", "A" + value, value + "A", otherValue} {
+		if _, err := codec.decode(v); err != errInvalidCookie {
+			t.Errorf("%q: err = %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ 使用本地的OIDC Provider(authorization_server)登录的web应用，替代原来手写的GitHub登录流程。
+ 先启动 security/oauth2/oauth2/authorization_server，再启动本程序，访问 http://localhost:9094/ 点击登录，
+ 用户名和密码都是demo，登录后页面显示ID Token中的声明和UserInfo。
+
+ 和手写流程的区别：端点地址从discovery文档读取；state、nonce随机生成并保存在签名的Cookie中；
+ 授权码通过PKCE绑定到本次登录；ID Token校验签名、iss、aud、exp和nonce。
+*/
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"paradigm/security/oauth2/rp"
+)
+
+var issuer = flag.String("issuer", "http://localhost:9096", "OpenID Connect issuer")
+
+type credentialResponse struct {
+	ClientID     string `json:"CLIENT_ID"`
+	ClientSecret string `json:"CLIENT_SECRET"`
+}
+
+// 在authorization_server注册应用，回调地址必须是http://localhost:9094下的地址
+func register() (*credentialResponse, error) {
+	resp, err := http.Get(*issuer + "/oauth/credential")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var c credentialResponse
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func main() {
+	flag.Parse()
+	credential, err := register()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Cookie的签名密钥，重启后未完成的登录失效
+	cookieSecret := make([]byte, 32)
+	if _, err := rand.Read(cookieSecret); err != nil {
+		log.Fatal(err)
+	}
+	party, err := rp.New(*issuer, credential.ClientID, credential.ClientSecret, "http://localhost:9094/callback", cookieSecret, "profile", "email")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!DOCTYPE HTML><html><body><a href="/login">Login with OpenID Connect</a></body></html>`)
+	})
+	http.HandleFunc("/login", party.LoginHandler)
+	http.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		result, err := party.Exchange(w, r)
+		if err != nil {
+			log.Println("Login Error:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, err := party.UserInfo(result.Token.AccessToken, result.Claims.Subject)
+		if err != nil {
+			log.Println("UserInfo Error:", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"id_token": result.Claims, "userinfo": user})
+	})
+
+	log.Fatal(http.ListenAndServe(":9094", nil))
+}
@@ -0,0 +1,333 @@
+package rp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"paradigm/security/jwt"
+	"paradigm/security/oauth2/oauth2/oidc"
+	"paradigm/security/oauth2/oauth2/pkce"
+)
+
+//
+// OpenID Connect Relying Party
+//
+// 使用第三方账号登录的应用(RP)，流程如下：
+// 1)从Provider的/.well-known/openid-configuration读取各个端点和JWKS的地址，iss必须和配置的一致
+// 2)用户点击登录时生成随机的state、nonce和PKCE的code_verifier，放在签名的Cookie中，然后跳转到授权端点
+// 3)回调时比较Cookie中的state和回调参数，防止CSRF；Cookie只能使用一次，有效期10分钟
+// 4)用授权码和code_verifier换取Token，校验ID Token的签名(公钥来自JWKS)、iss、aud、exp，以及nonce和Cookie中的一致，防止重放
+// 5)需要更多的用户信息时用Access Token访问UserInfo端点，返回的sub必须和ID Token一致
+//
+// Cookie用HMAC-SHA256签名，防止篡改；state、nonce不是秘密，code_verifier只在HttpOnly的Cookie中，页面脚本无法读取。
+//
+// 参考 https://openid.net/specs/openid-connect-core-1_0.html#CodeFlowAuth
+//
+
+var (
+	ErrInvalidIssuer    = errors.New("rp: discovery issuer mismatch")
+	ErrUnsupportedAlg   = errors.New("rp: no supported id_token signing algorithm")
+	ErrInvalidState     = errors.New("rp: invalid state")
+	ErrMissingCode      = errors.New("rp: missing authorization code")
+	ErrMissingIDToken   = errors.New("rp: missing id_token")
+	ErrInvalidNonce     = errors.New("rp: invalid nonce")
+	ErrSubjectMismatch  = errors.New("rp: userinfo subject mismatch")
+	ErrProviderResponse = errors.New("rp: invalid provider response")
+)
+
+const (
+	DefaultCookieName = "oidc_login"
+	DefaultLoginTTL   = 10 * time.Minute
+	DefaultTimeout    = 10 * time.Second // 访问Provider的超时时间
+)
+
+// Provider返回的错误，例如用户拒绝授权时的access_denied
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return "rp: " + e.Code
+	}
+	return fmt.Sprintf("rp: %s: %s", e.Code, e.Description)
+}
+
+// 读取discovery文档，iss必须和issuer一致，防止被引导到其他Provider
+func Discover(client *http.Client, issuer string) (*oidc.Configuration, error) {
+	resp, err := client.Get(strings.TrimRight(issuer, "/") + oidc.DiscoveryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrProviderResponse
+	}
+	var config oidc.Configuration
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, ErrProviderResponse
+	}
+	if config.Issuer != issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" || config.JWKSURI == "" {
+		return nil, ErrProviderResponse
+	}
+	return &config, nil
+}
+
+type RelyingParty struct {
+	ClientID     string
+	ClientSecret string // 公开客户端为空
+	RedirectURL  string
+	Scopes       []string // 总是包含openid
+	Provider     *oidc.Configuration
+	IDTokens     *jwt.TokenValidator // 校验ID Token，Issuer和Audience为Provider和ClientID
+	CookieName   string
+	LoginTTL     time.Duration // 从跳转到授权端点到回调的最长时间
+	Secure       bool          // Cookie只通过HTTPS发送，生产环境应当开启
+	Client       *http.Client  // 换取Token和访问UserInfo，JWKS使用创建时的Client
+	Now          func() time.Time
+
+	cookie *cookieCodec
+}
+
+// 读取discovery文档并创建RelyingParty，cookieSecret用于签名Cookie，长度不少于32字节
+func New(issuer string, clientID string, clientSecret string, redirectURL string, cookieSecret []byte, scopes ...string) (*RelyingParty, error) {
+	return NewWithClient(nil, issuer, clientID, clientSecret, redirectURL, cookieSecret, scopes...)
+}
+
+// client用于discovery、换取Token、UserInfo和下载JWKS，为空时使用超时DefaultTimeout的Client
+// 不要使用没有超时的http.DefaultClient，Provider没有响应时回调会一直等待
+func NewWithClient(client *http.Client, issuer string, clientID string, clientSecret string, redirectURL string, cookieSecret []byte, scopes ...string) (*RelyingParty, error) {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	config, err := Discover(client, issuer)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithConfiguration(client, config, clientID, clientSecret, redirectURL, cookieSecret, scopes...)
+}
+
+func NewWithConfiguration(client *http.Client, config *oidc.Configuration, clientID string, clientSecret string, redirectURL string, cookieSecret []byte, scopes ...string) (*RelyingParty, error) {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	// 只接受非对称算法，Provider声明支持的算法和本地支持的取交集
+	var algorithms []string
+	for _, alg := range config.IDTokenSigningAlgValuesSupported {
+		for _, supported := range jwt.AsymmetricAlgorithms {
+			if alg == supported {
+				algorithms = append(algorithms, alg)
+			}
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil, ErrUnsupportedAlg
+	}
+	cookie, err := newCookieCodec(cookieSecret)
+	if err != nil {
+		return nil, err
+	}
+	keys := jwt.NewRemoteKeySet(config.JWKSURI)
+	keys.Client = client
+	validator := jwt.NewTokenValidator(keys.Keyfunc, algorithms...)
+	validator.Issuer = config.Issuer
+	validator.Audience = clientID
+
+	if !containsString(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	return &RelyingParty{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		Provider:     config,
+		IDTokens:     validator,
+		cookie:       cookie,
+		CookieName:   DefaultCookieName,
+		LoginTTL:     DefaultLoginTTL,
+		Client:       client,
+		Now:          time.Now,
+	}, nil
+}
+
+// 生成state、nonce和code_verifier，写入Cookie，返回授权端点的地址
+func (rp *RelyingParty) AuthCodeURL(w http.ResponseWriter) (string, error) {
+	login, err := newLoginState(rp.Now().Add(rp.LoginTTL))
+	if err != nil {
+		return "", err
+	}
+	value, err := rp.cookie.encode(login)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     rp.CookieName,
+		Value:    value,
+		Path:     "/",
+		Expires:  login.ExpiresAt,
+		HttpOnly: true,
+		Secure:   rp.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rp.ClientID},
+		"redirect_uri":          {rp.RedirectURL},
+		"scope":                 {strings.Join(rp.Scopes, " ")},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {pkce.Challenge(login.Verifier)},
+		"code_challenge_method": {pkce.MethodS256},
+	}
+	endpoint := rp.Provider.AuthorizationEndpoint
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + query.Encode(), nil
+	}
+	return endpoint + "?" + query.Encode(), nil
+}
+
+// 跳转到授权端点
+func (rp *RelyingParty) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	authURL, err := rp.AuthCodeURL(w)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Token端点的响应
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token"`
+}
+
+// 登录结果
+type Result struct {
+	Token  *Token
+	Claims *oidc.IDTokenClaims // 已经校验过的ID Token
+}
+
+// 处理回调：校验state，用授权码换取Token，校验ID Token和nonce
+// 无论成功与否都删除Cookie，一次登录的state只能使用一次
+func (rp *RelyingParty) Exchange(w http.ResponseWriter, r *http.Request) (*Result, error) {
+	cookie, err := r.Cookie(rp.CookieName)
+	http.SetCookie(w, &http.Cookie{Name: rp.CookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, Secure: rp.Secure, SameSite: http.SameSiteLaxMode})
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	login, err := rp.cookie.decode(cookie.Value)
+	if err != nil || rp.Now().After(login.ExpiresAt) || !constantTimeEqual(login.State, r.FormValue("state")) {
+		return nil, ErrInvalidState
+	}
+	if code := r.FormValue("error"); code != "" {
+		return nil, &Error{Code: code, Description: r.FormValue("error_description")}
+	}
+
+	code := r.FormValue("code")
+	if code == "" {
+		return nil, ErrMissingCode
+	}
+	token, err := rp.exchange(code, login.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, ErrMissingIDToken
+	}
+	var claims oidc.IDTokenClaims
+	if _, err := rp.IDTokens.ValidateWithClaims(token.IDToken, &claims); err != nil {
+		return nil, err
+	}
+	if !constantTimeEqual(claims.Nonce, login.Nonce) {
+		return nil, ErrInvalidNonce
+	}
+	return &Result{Token: token, Claims: &claims}, nil
+}
+
+func (rp *RelyingParty) exchange(code string, verifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {rp.ClientID},
+		"code":          {code},
+		"redirect_uri":  {rp.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if rp.ClientSecret != "" {
+		form.Set("client_secret", rp.ClientSecret)
+	}
+	resp, err := rp.Client.PostForm(rp.Provider.TokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e Error
+		if json.Unmarshal(body, &e) == nil && e.Code != "" {
+			return nil, &e
+		}
+		return nil, ErrProviderResponse
+	}
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return nil, ErrProviderResponse
+	}
+	return &token, nil
+}
+
+// 访问UserInfo端点；subject不为空时要求返回的sub一致，防止Token被替换
+func (rp *RelyingParty) UserInfo(accessToken string, subject string) (*oidc.UserInfo, error) {
+	if rp.Provider.UserInfoEndpoint == "" {
+		return nil, ErrProviderResponse
+	}
+	req, err := http.NewRequest(http.MethodGet, rp.Provider.UserInfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := rp.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrProviderResponse
+	}
+	var info oidc.UserInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil || info.Subject == "" {
+		return nil, ErrProviderResponse
+	}
+	if subject != "" && info.Subject != subject {
+		return nil, ErrSubjectMismatch
+	}
+	return &info, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
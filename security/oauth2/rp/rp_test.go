@@ -0,0 +1,315 @@
+package rp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/oauth2.v3"
+	oauth2errors "gopkg.in/oauth2.v3/errors"
+	"gopkg.in/oauth2.v3/generates"
+	"gopkg.in/oauth2.v3/manage"
+	"gopkg.in/oauth2.v3/models"
+	"gopkg.in/oauth2.v3/server"
+	"gopkg.in/oauth2.v3/store"
+
+	"paradigm/security/jwt"
+	"paradigm/security/oauth2/oauth2/oidc"
+	"paradigm/security/oauth2/oauth2/pkce"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	values map[string]string
+}
+
+func (m *memoryStore) SaveChallenge(code string, challenge string, expiresAt time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	m.values["pkce:"+code] = challenge
+	return nil
+}
+
+func (m *memoryStore) GetChallenge(code string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.values["pkce:"+code], nil
+}
+
+func (m *memoryStore) SaveAuthorization(code string, nonce string, authTime time.Time, expiresAt time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	m.values["oidc:"+code] = nonce
+	return nil
+}
+
+func (m *memoryStore) GetAuthorization(code string) (string, time.Time, bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	nonce, ok := m.values["oidc:"+code]
+	return nonce, time.Time{}, ok, nil
+}
+
+type memoryUsers map[string]*oidc.UserInfo
+
+func (users memoryUsers) GetUser(userID string) (*oidc.UserInfo, error) {
+	return users[userID], nil
+}
+
+var cookieSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// 本地的OIDC Provider，和authorization_server的配置一致(不包括登录页面)
+type testProvider struct {
+	*httptest.Server
+	deny bool // 模拟用户拒绝授权
+}
+
+func newTestProvider(t *testing.T, clientDomain string) *testProvider {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := jwt.NewSigningKey("k1", privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	tp := &testProvider{Server: httptest.NewServer(mux)}
+	t.Cleanup(tp.Close)
+
+	manager := manage.NewDefaultManager()
+	manager.MustTokenStorage(store.NewMemoryTokenStore())
+	clients := store.NewClientStore()
+	clients.Set("c1", &models.Client{ID: "c1", Secret: "s1", Domain: clientDomain})
+	clients.Set("public", &models.Client{ID: "public", Domain: clientDomain})
+	manager.MapClientStorage(clients)
+
+	stores := &memoryStore{values: make(map[string]string)}
+	users := memoryUsers{"alice": {Subject: "alice", Name: "Alice", Email: "alice@example.com", EmailVerified: true}}
+	provider := oidc.NewProvider(tp.URL, signingKey.Issuer(), jwt.NewKeyring(signingKey.Public()), users, stores)
+	p := pkce.NewServer(stores, func(clientID string) (bool, error) { return clientID == "public", nil })
+	manager.MapAuthorizeGenerate(provider.AuthorizeGenerate(p.AuthorizeGenerate(generates.NewAuthorizeGenerate())))
+	manager.MapAccessGenerate(provider.AccessGenerate(p.AccessGenerate(generates.NewAccessGenerate())))
+
+	srv := server.NewDefaultServer(manager)
+	srv.SetAllowedResponseType(oauth2.Code)
+	srv.SetAllowedGrantType(oauth2.AuthorizationCode)
+	srv.SetClientInfoHandler(pkce.ClientFormHandler)
+	srv.SetUserAuthorizationHandler(func(w http.ResponseWriter, r *http.Request) (string, error) {
+		if tp.deny {
+			return "", oauth2errors.ErrAccessDenied
+		}
+		return "alice", nil
+	})
+	srv.SetExtensionFieldsHandler(provider.ExtensionFieldsHandler)
+	provider.ValidateAccessToken = srv.ValidationBearerToken
+
+	mux.HandleFunc(provider.AuthorizePath, func(w http.ResponseWriter, r *http.Request) {
+		srv.HandleAuthorizeRequest(w, r)
+	})
+	mux.HandleFunc(provider.TokenPath, func(w http.ResponseWriter, r *http.Request) {
+		srv.HandleTokenRequest(w, r)
+	})
+	mux.HandleFunc(oidc.DiscoveryPath, provider.DiscoveryHandler)
+	mux.Handle(provider.JWKSPath, provider.JWKSHandler())
+	mux.HandleFunc(provider.UserInfoPath, provider.UserInfoHandler)
+	return tp
+}
+
+type loginResult struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+	Error   string `json:"error"`
+}
+
+// 应用：/login跳转到Provider，/callback处理回调，返回用户信息或错误
+func newTestApp(t *testing.T, clientID string, clientSecret string) (*httptest.Server, *testProvider, *RelyingParty) {
+	mux := http.NewServeMux()
+	app := httptest.NewServer(mux)
+	t.Cleanup(app.Close)
+	tp := newTestProvider(t, app.URL)
+
+	rp, err := New(tp.URL, clientID, clientSecret, app.URL+"/callback", cookieSecret, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.HandleFunc("/login", rp.LoginHandler)
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		result, err := rp.Exchange(w, r)
+		if err != nil {
+			json.NewEncoder(w).Encode(loginResult{Error: err.Error()})
+			return
+		}
+		info, err := rp.UserInfo(result.Token.AccessToken, result.Claims.Subject)
+		if err != nil {
+			json.NewEncoder(w).Encode(loginResult{Error: err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(loginResult{Subject: result.Claims.Subject, Email: info.Email})
+	})
+	return app, tp, rp
+}
+
+func get(t *testing.T, client *http.Client, url string) *loginResult {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result loginResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return &result
+}
+
+func newBrowser() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar}
+}
+
+func TestLogin(t *testing.T) {
+	for _, c := range []struct{ clientID, secret string }{{"c1", "s1"}, {"public", ""}} {
+		app, _, _ := newTestApp(t, c.clientID, c.secret)
+		result := get(t, newBrowser(), app.URL+"/login")
+		if result.Error != "" || result.Subject != "alice" || result.Email != "alice@example.com" {
+			t.Errorf("%s: result = %+v", c.clientID, result)
+		}
+	}
+}
+
+func TestCallbackErrors(t *testing.T) {
+	app, tp, _ := newTestApp(t, "c1", "s1")
+
+	// 没有Cookie：不是本应用发起的登录
+	if result := get(t, newBrowser(), app.URL+"/callback?code=x&state=y"); result.Error != ErrInvalidState.Error() {
+		t.Errorf("no cookie: %+v", result)
+	}
+
+	// Cookie中的state和回调参数不一致
+	browser := newBrowser()
+	browser.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := browser.Get(app.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), tp.URL) {
+		t.Fatalf("location = %q", resp.Header.Get("Location"))
+	}
+	if result := get(t, browser, app.URL+"/callback?code=x&state=forged"); result.Error != ErrInvalidState.Error() {
+		t.Errorf("forged state: %+v", result)
+	}
+	// Cookie只能使用一次，失败后也不能再用正确的state
+	if result := get(t, browser, app.URL+"/callback?code=x&state="+location.Query().Get("state")); result.Error != ErrInvalidState.Error() {
+		t.Errorf("reused cookie: %+v", result)
+	}
+
+	// 回调没有code，不访问Token端点
+	resp, err = browser.Get(app.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, _ = url.Parse(resp.Header.Get("Location"))
+	if result := get(t, browser, app.URL+"/callback?state="+location.Query().Get("state")); result.Error != ErrMissingCode.Error() {
+		t.Errorf("missing code: %+v", result)
+	}
+
+	// 用户拒绝授权
+	tp.deny = true
+	if result := get(t, newBrowser(), app.URL+"/login"); !strings.Contains(result.Error, "access_denied") {
+		t.Errorf("denied: %+v", result)
+	}
+}
+
+func TestIDTokenValidation(t *testing.T) {
+	_, tp, rp := newTestApp(t, "c1", "s1")
+
+	// 声明正确但不是Provider签名的ID Token
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	signingKey, _ := jwt.NewSigningKey("other", privateKey)
+	forged, _ := signingKey.Issuer().Issue(&oidc.IDTokenClaims{RegisteredClaims: jwt.RegisteredClaims{Issuer: tp.URL, Audience: jwt.Audience{"c1"}}})
+	if _, err := rp.IDTokens.Validate(forged); err == nil {
+		t.Error("token signed by unknown key accepted")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tp := newTestProvider(t, "http://client.example")
+	config, err := Discover(http.DefaultClient, tp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TokenEndpoint != tp.URL+"/oauth/access_token" {
+		t.Errorf("config = %+v", config)
+	}
+	// iss和配置的不一致
+	if _, err := Discover(http.DefaultClient, tp.URL+"/"); err != ErrInvalidIssuer {
+		t.Errorf("issuer mismatch: %v", err)
+	}
+
+	if _, err := NewWithConfiguration(nil, &oidc.Configuration{IDTokenSigningAlgValuesSupported: []string{"HS256"}}, "c1", "", "", cookieSecret); err != ErrUnsupportedAlg {
+		t.Errorf("HS256: %v", err)
+	}
+	if _, err := NewWithConfiguration(nil, config, "c1", "", "", []byte("short")); err != ErrShortCookieSecret {
+		t.Errorf("short secret: %v", err)
+	}
+}
+
+// Provider没有响应时，回调在Client的超时时间内返回
+func TestProviderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer stalled.Close()
+	defer close(release)
+
+	config := &oidc.Configuration{
+		Issuer:                           stalled.URL,
+		AuthorizationEndpoint:            stalled.URL + "/oauth/authorize",
+		TokenEndpoint:                    stalled.URL + "/oauth/access_token",
+		JWKSURI:                          stalled.URL + "/jwks",
+		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+	}
+	rp, err := NewWithConfiguration(&http.Client{Timeout: 100 * time.Millisecond}, config, "c1", "s1", "http://app.example/callback", cookieSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	authURL, err := rp.AuthCodeURL(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, _ := url.Parse(authURL)
+	r := httptest.NewRequest(http.MethodGet, "/callback?code=x&state="+location.Query().Get("state"), nil)
+	r.AddCookie(w.Result().Cookies()[0])
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := rp.Exchange(httptest.NewRecorder(), r)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("exchange succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("exchange did not time out")
+	}
+}